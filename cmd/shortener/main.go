@@ -7,19 +7,26 @@ import (
 	"net/http"
 	"os/signal"
 	"syscall"
+	"time"
 
 	_ "github.com/lib/pq"
 	"golang.org/x/sync/errgroup"
 
 	"go.uber.org/zap"
 
+	"github.com/VladKvetkin/shortener/internal/app/auth"
 	"github.com/VladKvetkin/shortener/internal/app/config"
 	"github.com/VladKvetkin/shortener/internal/app/handler"
+	"github.com/VladKvetkin/shortener/internal/app/middleware"
+	"github.com/VladKvetkin/shortener/internal/app/policy"
 	"github.com/VladKvetkin/shortener/internal/app/router"
 	"github.com/VladKvetkin/shortener/internal/app/server"
 	"github.com/VladKvetkin/shortener/internal/app/storage"
 )
 
+// policyReloadInterval - период проверки файла политики на изменения.
+const policyReloadInterval = 5 * time.Second
+
 var (
 	buildVersion = "N/A"
 	buildDate    = "N/A"
@@ -43,7 +50,19 @@ func main() {
 
 	defer storage.Close()
 
-	handler := handler.NewHandler(storage, config)
+	policy, err := policy.NewEngine(config.PolicyFilePath)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := auth.Configure(config); err != nil {
+		panic(err)
+	}
+
+	middleware.Configure(config)
+	middleware.ConfigureRateLimits(config)
+
+	handler := handler.NewHandler(storage, config, policy)
 	router := router.NewRouter(handler)
 	server := server.NewServer(config, router.Router)
 
@@ -52,6 +71,11 @@ func main() {
 
 	eg, ctx := errgroup.WithContext(ctx)
 
+	eg.Go(func() error {
+		policy.Watch(ctx, policyReloadInterval)
+		return nil
+	})
+
 	eg.Go(func() error {
 		zap.L().Info("Running server", zap.String("Address", config.Address))
 
@@ -74,6 +98,11 @@ func main() {
 		return nil
 	})
 
+	eg.Go(func() error {
+		handler.ClicksWg.Wait()
+		return nil
+	})
+
 	eg.Go(func() error {
 		if err := server.Stop(); err != nil {
 			zap.L().Info("error stopping server", zap.Error(err))
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const (
+	// apiKeyPrefix - начало всех ключей API, по нему ключ легко найти в логах и сканерами секретов.
+	apiKeyPrefix = "shk_"
+	// apiKeyBytes - количество случайных байт в ключе API.
+	apiKeyBytes = 32
+	// apiKeyVisibleLength - длина начала ключа, которое хранится и показывается в списке ключей.
+	apiKeyVisibleLength = len(apiKeyPrefix) + 8
+)
+
+// GenerateAPIKey - функция, которая генерирует новый ключ API.
+// Возвращает ключ, который показывается пользователю один раз, его начало и хеш для хранения.
+func GenerateAPIKey() (key string, prefix string, hash string, err error) {
+	secret := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	return key, key[:apiKeyVisibleLength], HashAPIKey(key), nil
+}
+
+// HashAPIKey - функция, которая возвращает хеш ключа API, по которому ключ ищется в базе данных.
+// В ключе 256 случайных бит, поэтому медленный хеш, как для паролей, не нужен.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
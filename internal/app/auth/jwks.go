@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// minRSAKeyBits - минимальный размер ключа RSA.
+const minRSAKeyBits = 2048
+
+var (
+	// ErrInvalidKeyFile - ошибка, которая означает, что в файле нет ключа в формате PEM.
+	ErrInvalidKeyFile = errors.New("invalid jwt key file")
+	// ErrUnsupportedKey - ошибка, которая означает, что тип ключа не поддерживается.
+	ErrUnsupportedKey = errors.New("unsupported jwt key type")
+	// ErrWeakRSAKey - ошибка, которая означает, что ключ RSA слишком короткий.
+	ErrWeakRSAKey = errors.New("rsa jwt key must be at least 2048 bits long")
+	// ErrNoPrivateKey - ошибка, которая означает, что для подписи токенов передан открытый ключ.
+	ErrNoPrivateKey = errors.New("jwt signing key must be a private key")
+)
+
+// JSONWebKey - открытый ключ в формате JWK (RFC 7517).
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// N и E - модуль и экспонента ключа RSA.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve и X - кривая и открытый ключ Ed25519.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JSONWebKeySet - набор открытых ключей в формате JWKS.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS - функция, которая возвращает открытые ключи из набора ключей, заданного через SetKeyRing.
+// Секреты HMAC не публикуются.
+func JWKS() JSONWebKeySet {
+	return keyRing.Load().JWKS()
+}
+
+// JWKS - функция, которая возвращает открытые ключи RSA и Ed25519 из набора, текущий ключ идет первым.
+func (r *KeyRing) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(r.keys))}
+
+	if jwk, ok := publicJWK(r.current.verifyKey); ok {
+		jwk.KeyID = r.current.ID
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	for _, key := range r.keys {
+		if key.ID == r.current.ID {
+			continue
+		}
+
+		if jwk, ok := publicJWK(key.verifyKey); ok {
+			jwk.KeyID = key.ID
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	return set
+}
+
+// LoadPEMKey - функция, которая читает ключ RSA или Ed25519 из PEM-файла.
+// Из открытого ключа получается ключ, которым можно только проверять токены.
+func LoadPEMKey(path string) (Key, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return Key{}, ErrInvalidKeyFile
+	}
+
+	var parsedKey interface{}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsedKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsedKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsedKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsedKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return Key{}, ErrInvalidKeyFile
+	}
+
+	if err != nil {
+		return Key{}, err
+	}
+
+	return NewAsymmetricKey(parsedKey)
+}
+
+// NewAsymmetricKey - конструктор Key для подписи RS256 или EdDSA.
+// Идентификатор ключа - отпечаток открытого ключа по RFC 7638.
+func NewAsymmetricKey(parsedKey interface{}) (Key, error) {
+	var key Key
+
+	switch parsedKey := parsedKey.(type) {
+	case *rsa.PrivateKey:
+		key = Key{Method: jwt.SigningMethodRS256, signKey: parsedKey, verifyKey: &parsedKey.PublicKey}
+	case *rsa.PublicKey:
+		key = Key{Method: jwt.SigningMethodRS256, verifyKey: parsedKey}
+	case ed25519.PrivateKey:
+		key = Key{Method: jwt.SigningMethodEdDSA, signKey: parsedKey, verifyKey: parsedKey.Public()}
+	case ed25519.PublicKey:
+		key = Key{Method: jwt.SigningMethodEdDSA, verifyKey: parsedKey}
+	default:
+		return Key{}, ErrUnsupportedKey
+	}
+
+	if rsaKey, ok := key.verifyKey.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minRSAKeyBits {
+		return Key{}, ErrWeakRSAKey
+	}
+
+	jwk, _ := publicJWK(key.verifyKey)
+
+	thumbprint, err := jwkThumbprint(jwk)
+	if err != nil {
+		return Key{}, err
+	}
+
+	key.ID = thumbprint
+
+	return key, nil
+}
+
+func publicJWK(verifyKey interface{}) (JSONWebKey, bool) {
+	switch verifyKey := verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JSONWebKey{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: jwt.SigningMethodRS256.Alg(),
+			N:         base64.RawURLEncoding.EncodeToString(verifyKey.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(verifyKey.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JSONWebKey{
+			KeyType:   "OKP",
+			Use:       "sig",
+			Algorithm: jwt.SigningMethodEdDSA.Alg(),
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(verifyKey),
+		}, true
+	default:
+		return JSONWebKey{}, false
+	}
+}
+
+// jwkThumbprint вычисляет отпечаток ключа по RFC 7638: SHA-256 от обязательных полей JWK в алфавитном порядке.
+func jwkThumbprint(jwk JSONWebKey) (string, error) {
+	var members interface{}
+
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E       string `json:"e"`
+			KeyType string `json:"kty"`
+			N       string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	case "OKP":
+		members = struct {
+			Curve   string `json:"crv"`
+			KeyType string `json:"kty"`
+			X       string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	default:
+		return "", ErrUnsupportedKey
+	}
+
+	content, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -3,60 +3,240 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
+
+	"github.com/VladKvetkin/shortener/internal/app/config"
+)
+
+var (
+	// ErrSessionExpired - ошибка, которая означает, что истек абсолютный срок жизни сессии и токен нельзя продлить.
+	ErrSessionExpired = errors.New("session expired")
 )
 
+// RoleAdmin - роль администратора, которой доступно API администратора.
+const RoleAdmin = "admin"
+
 type claims struct {
 	jwt.RegisteredClaims
 	UserID string
+	// Role - роль пользователя. Пустая у обычных пользователей.
+	Role string `json:"role,omitempty"`
+	// AuthTime - время выпуска первого токена сессии, от него отсчитывается абсолютный срок жизни.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	// SessionID - jti первого токена сессии, сохраняется в продленных токенах. У первого токена не задается.
+	SessionID string `json:"sid,omitempty"`
 }
 
-const secretKey = "testsecretkey"
-const tokenExp = time.Hour * 3
+const (
+	// defaultTokenLifetime - срок жизни токена по умолчанию.
+	defaultTokenLifetime = time.Hour * 3
+	// defaultAbsoluteLifetime - срок жизни сессии по умолчанию, до вызова SetLifetime.
+	defaultAbsoluteLifetime = time.Hour * 24 * 30
+)
 
-// BuildJWTToken - генерирует JWT-токен, который содержит идентификатор пользователя.
-func BuildJWTToken() (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExp)),
-		},
-		UserID: uuid.NewString(),
-	})
+// Session - структура, которая описывает сессию пользователя из JWT-токена.
+type Session struct {
+	// ID - идентификатор сессии, общий для всех продленных токенов. По нему сессия отзывается.
+	// Пустой у токенов, выпущенных до появления идентификаторов, такие токены отозвать нельзя.
+	ID string
+	// TokenID - идентификатор токена (jti).
+	TokenID   string
+	UserID    string
+	Role      string
+	StartedAt time.Time
+	ExpiresAt time.Time
+}
 
-	tokenString, err := token.SignedString([]byte(secretKey))
+// keyRing - набор ключей, которым подписываются и проверяются токены.
+// До вызова SetKeyRing используется набор со случайным ключом.
+var keyRing atomic.Pointer[KeyRing]
+
+var (
+	// tokenLifetime - срок жизни одного токена.
+	tokenLifetime atomic.Int64
+	// absoluteLifetime - срок жизни сессии, после которого токен не продлевается. 0 - без ограничения.
+	// По умолчанию ограничен, чтобы перехваченный токен нельзя было продлевать бесконечно.
+	absoluteLifetime atomic.Int64
+	// strictMode - запрет выпускать токены новым пользователям при запросах к API.
+	strictMode atomic.Bool
+)
+
+// now возвращает текущее время, в тестах подменяется.
+var now = time.Now
+
+func init() {
+	randomKeyRing, err := newRandomKeyRing()
 	if err != nil {
-		return "", err
+		panic(err)
 	}
 
-	return tokenString, nil
+	keyRing.Store(randomKeyRing)
+	tokenLifetime.Store(int64(defaultTokenLifetime))
+	absoluteLifetime.Store(int64(defaultAbsoluteLifetime))
 }
 
-// GetUserID - получает из tokenString идентификатор пользователя.
-func GetUserID(tokenString string) (string, error) {
-	claims := &claims{}
+// Configure - функция, которая загружает ключи и сроки жизни токенов из конфигурации.
+func Configure(config config.Config) error {
+	loadedKeyRing, err := LoadKeyRing(config)
+	if err != nil {
+		return err
+	}
 
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		claims,
-		func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-			}
-			return []byte(secretKey), nil
-		},
+	SetKeyRing(loadedKeyRing)
+	SetLifetime(
+		time.Duration(config.JWTLifetime)*time.Second,
+		time.Duration(config.JWTAbsoluteLifetime)*time.Second,
 	)
+	SetStrictMode(config.AuthStrict)
+
+	return nil
+}
+
+// SetKeyRing - функция, которая задает набор ключей для подписи и проверки токенов.
+func SetKeyRing(r *KeyRing) {
+	keyRing.Store(r)
+}
+
+// SetLifetime - функция, которая задает срок жизни токена и абсолютный срок жизни сессии.
+// Если lifetime не задан, то используется 3 часа. Если absolute равен 0, то сессия продлевается без ограничения.
+func SetLifetime(lifetime time.Duration, absolute time.Duration) {
+	if lifetime <= 0 {
+		lifetime = defaultTokenLifetime
+	}
+
+	tokenLifetime.Store(int64(lifetime))
+	absoluteLifetime.Store(int64(absolute))
+}
+
+// TokenLifetime - функция, которая возвращает срок жизни одного токена.
+func TokenLifetime() time.Duration {
+	return time.Duration(tokenLifetime.Load())
+}
+
+// SetStrictMode - функция, которая включает строгий режим: запросы к API без действующего токена отклоняются,
+// а не получают токен нового пользователя.
+func SetStrictMode(strict bool) {
+	strictMode.Store(strict)
+}
+
+// StrictMode - функция, которая проверяет, включен ли строгий режим.
+func StrictMode() bool {
+	return strictMode.Load()
+}
+
+// BuildJWTToken - генерирует JWT-токен, который содержит идентификатор нового пользователя.
+func BuildJWTToken() (string, error) {
+	return signSession(uuid.NewString(), "", "", now())
+}
+
+// BuildUserJWTToken - генерирует JWT-токен новой сессии пользователя userID с ролью role, например после входа в учетную запись.
+// Роль хранится в токене до конца сессии, в том числе в продленных токенах.
+func BuildUserJWTToken(userID string, role string) (string, error) {
+	return signSession(userID, role, "", now())
+}
 
+// GetUserID - получает из tokenString идентификатор пользователя.
+func GetUserID(tokenString string) (string, error) {
+	session, err := ParseJWTToken(tokenString)
 	if err != nil {
 		return "", err
 	}
 
-	if !token.Valid || claims.UserID == "" {
-		return "", fmt.Errorf("token is not valid")
+	return session.UserID, nil
+}
+
+// ParseJWTToken - функция, которая проверяет tokenString и возвращает сессию пользователя.
+func ParseJWTToken(tokenString string) (Session, error) {
+	claims := &claims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyRing.Load().keyFunc)
+	if err != nil {
+		return Session{}, err
+	}
+
+	if !token.Valid || claims.UserID == "" || claims.ExpiresAt == nil {
+		return Session{}, fmt.Errorf("token is not valid")
+	}
+
+	session := Session{
+		ID:        claims.SessionID,
+		TokenID:   claims.ID,
+		UserID:    claims.UserID,
+		Role:      claims.Role,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+
+	switch {
+	case claims.AuthTime != nil:
+		session.StartedAt = claims.AuthTime.Time
+	case claims.IssuedAt != nil:
+		session.StartedAt = claims.IssuedAt.Time
+	default:
+		session.StartedAt = now()
+	}
+
+	if session.ID == "" {
+		session.ID = session.TokenID
+	}
+
+	return session, nil
+}
+
+// NeedsRenewal - функция, которая проверяет, что до истечения токена осталось меньше половины срока жизни
+// и сессию еще можно продлить.
+func (s Session) NeedsRenewal() bool {
+	if s.expired() {
+		return false
+	}
+
+	return s.ExpiresAt.Sub(now()) < time.Duration(tokenLifetime.Load())/2
+}
+
+// RenewJWTToken - функция, которая выпускает новый токен для того же пользователя.
+// Токен не переживет абсолютный срок жизни сессии. Если он уже истек, то возвращается ErrSessionExpired.
+func RenewJWTToken(session Session) (string, error) {
+	if session.expired() {
+		return "", ErrSessionExpired
+	}
+
+	return signSession(session.UserID, session.Role, session.ID, session.StartedAt)
+}
+
+func (s Session) expired() bool {
+	absolute := time.Duration(absoluteLifetime.Load())
+
+	return absolute > 0 && !now().Before(s.StartedAt.Add(absolute))
+}
+
+// signSession подписывает токен сессии sessionID. Если sessionID пустой, то токен начинает новую сессию.
+func signSession(userID string, role string, sessionID string, startedAt time.Time) (string, error) {
+	issuedAt := now()
+	expiresAt := issuedAt.Add(time.Duration(tokenLifetime.Load()))
+
+	if absolute := time.Duration(absoluteLifetime.Load()); absolute > 0 && startedAt.Add(absolute).Before(expiresAt) {
+		expiresAt = startedAt.Add(absolute)
+	}
+
+	tokenString, err := keyRing.Load().sign(claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		UserID:    userID,
+		Role:      role,
+		AuthTime:  jwt.NewNumericDate(startedAt),
+		SessionID: sessionID,
+	})
+	if err != nil {
+		return "", err
 	}
 
-	return claims.UserID, nil
+	return tokenString, nil
 }
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+
+	"github.com/VladKvetkin/shortener/internal/app/config"
+)
+
+// minSecretLength - минимальная длина секрета HMAC в байтах, меньше размера подписи HS256 брать небезопасно.
+const minSecretLength = 32
+
+var (
+	// ErrWeakSecret - ошибка, которая означает, что секрет для подписи JWT-токенов слишком короткий.
+	ErrWeakSecret = errors.New("jwt secret must be at least 32 bytes long")
+	// ErrUnknownKey - ошибка, которая означает, что токен подписан ключом, которого нет в наборе.
+	ErrUnknownKey = errors.New("unknown jwt key")
+)
+
+// Key - ключ, которым подписываются и проверяются JWT-токены.
+type Key struct {
+	// ID - идентификатор ключа, который записывается в заголовок kid токена.
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHMACKey - конструктор Key для подписи HS256. Идентификатор ключа вычисляется по секрету.
+func NewHMACKey(secret []byte) (Key, error) {
+	if len(secret) < minSecretLength {
+		return Key{}, ErrWeakSecret
+	}
+
+	sum := sha256.Sum256(secret)
+
+	return Key{
+		ID:        hex.EncodeToString(sum[:8]),
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}, nil
+}
+
+// KeyRing - набор ключей. Новые токены подписываются текущим ключом,
+// а проверяются ключом из заголовка kid, поэтому токены с предыдущими ключами действуют, пока ключ есть в наборе.
+type KeyRing struct {
+	current Key
+	keys    map[string]Key
+}
+
+// NewKeyRing - конструктор KeyRing.
+func NewKeyRing(current Key, previous ...Key) *KeyRing {
+	keyRing := &KeyRing{
+		current: current,
+		keys:    make(map[string]Key, len(previous)+1),
+	}
+
+	for _, key := range previous {
+		keyRing.keys[key.ID] = key
+	}
+
+	keyRing.keys[current.ID] = current
+
+	return keyRing
+}
+
+// LoadKeyRing - функция, которая создает KeyRing из конфигурации.
+// Текущий ключ берется из JWTKeyFile, JWTSecretFile или JWTSecret.
+// Если ключ не задан, то генерируется случайный секрет: токены перестанут действовать после перезапуска.
+func LoadKeyRing(config config.Config) (*KeyRing, error) {
+	previous := make([]Key, 0, len(config.JWTPreviousSecrets)+len(config.JWTPreviousKeyFiles))
+
+	for _, previousSecret := range config.JWTPreviousSecrets {
+		key, err := NewHMACKey([]byte(previousSecret))
+		if err != nil {
+			return nil, err
+		}
+
+		previous = append(previous, key)
+	}
+
+	for _, previousKeyFile := range config.JWTPreviousKeyFiles {
+		key, err := LoadPEMKey(previousKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		previous = append(previous, key)
+	}
+
+	if config.JWTKeyFile != "" {
+		current, err := LoadPEMKey(config.JWTKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if current.signKey == nil {
+			return nil, ErrNoPrivateKey
+		}
+
+		return NewKeyRing(current, previous...), nil
+	}
+
+	secret := config.JWTSecret
+
+	if config.JWTSecretFile != "" {
+		content, err := os.ReadFile(config.JWTSecretFile)
+		if err != nil {
+			return nil, err
+		}
+
+		secret = strings.TrimSpace(string(content))
+	}
+
+	if secret == "" {
+		zap.L().Warn("JWT secret is not configured, tokens will not be valid after restart")
+
+		randomKeyRing, err := newRandomKeyRing()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewKeyRing(randomKeyRing.current, previous...), nil
+	}
+
+	current, err := NewHMACKey([]byte(secret))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKeyRing(current, previous...), nil
+}
+
+func newRandomKeyRing() (*KeyRing, error) {
+	secret := make([]byte, minSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	key, err := NewHMACKey(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKeyRing(key), nil
+}
+
+// sign - функция, которая подписывает токен текущим ключом.
+func (r *KeyRing) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(r.current.Method, claims)
+	token.Header["kid"] = r.current.ID
+
+	return token.SignedString(r.current.signKey)
+}
+
+// keyFunc - функция, которая выбирает ключ проверки по заголовку kid и проверяет алгоритм подписи.
+func (r *KeyRing) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	key, ok := r.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+
+	return key.verifyKey, nil
+}
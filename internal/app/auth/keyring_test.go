@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VladKvetkin/shortener/internal/app/config"
+)
+
+func TestKeyRingRotation(t *testing.T) {
+	oldSecret := strings.Repeat("o", minSecretLength)
+	newSecret := strings.Repeat("n", minSecretLength)
+
+	oldKeyRing, err := LoadKeyRing(config.Config{JWTSecret: oldSecret})
+	require.NoError(t, err)
+
+	SetKeyRing(oldKeyRing)
+	oldToken, err := BuildJWTToken()
+	require.NoError(t, err)
+
+	rotatedKeyRing, err := LoadKeyRing(config.Config{
+		JWTSecret:          newSecret,
+		JWTPreviousSecrets: []string{oldSecret},
+	})
+	require.NoError(t, err)
+
+	SetKeyRing(rotatedKeyRing)
+	newToken, err := BuildJWTToken()
+	require.NoError(t, err)
+
+	_, err = GetUserID(oldToken)
+	assert.NoError(t, err, "token signed with previous key must verify")
+
+	_, err = GetUserID(newToken)
+	assert.NoError(t, err)
+
+	parsedToken, _, err := jwt.NewParser().ParseUnverified(newToken, &claims{})
+	require.NoError(t, err)
+	assert.Equal(t, rotatedKeyRing.current.ID, parsedToken.Header["kid"])
+
+	retiredKeyRing, err := LoadKeyRing(config.Config{JWTSecret: newSecret})
+	require.NoError(t, err)
+
+	SetKeyRing(retiredKeyRing)
+
+	_, err = GetUserID(oldToken)
+	assert.Error(t, err, "token signed with retired key must not verify")
+}
+
+func TestKeyRingRejectsForgedTokens(t *testing.T) {
+	keyRing, err := LoadKeyRing(config.Config{JWTSecret: strings.Repeat("s", minSecretLength)})
+	require.NoError(t, err)
+
+	SetKeyRing(keyRing)
+
+	tests := []struct {
+		name  string
+		token func() string
+	}{
+		{
+			name: "token with the former hard-coded secret",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{UserID: "forged"})
+				tokenString, _ := token.SignedString([]byte("testsecretkey"))
+				return tokenString
+			},
+		},
+		{
+			name: "token with known kid and another secret",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{UserID: "forged"})
+				token.Header["kid"] = keyRing.current.ID
+				tokenString, _ := token.SignedString([]byte(strings.Repeat("x", minSecretLength)))
+				return tokenString
+			},
+		},
+		{
+			name: "unsigned token",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodNone, claims{UserID: "forged"})
+				token.Header["kid"] = keyRing.current.ID
+				tokenString, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+				return tokenString
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GetUserID(tt.token())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadKeyRingWeakSecret(t *testing.T) {
+	_, err := LoadKeyRing(config.Config{JWTSecret: "testsecretkey"})
+	assert.ErrorIs(t, err, ErrWeakSecret)
+}
+
+func TestKeyRingAsymmetricKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	require.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	rsaDER := x509.MarshalPKCS1PrivateKey(rsaKey)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	rsaPath := filepath.Join(dir, "rsa.pem")
+	edPath := filepath.Join(dir, "ed25519.pem")
+
+	require.NoError(t, os.WriteFile(rsaPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: rsaDER}), 0o600))
+	require.NoError(t, os.WriteFile(edPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER}), 0o600))
+
+	tests := []struct {
+		name    string
+		keyFile string
+		alg     string
+		kty     string
+	}{
+		{
+			name:    "RS256",
+			keyFile: rsaPath,
+			alg:     "RS256",
+			kty:     "RSA",
+		},
+		{
+			name:    "EdDSA",
+			keyFile: edPath,
+			alg:     "EdDSA",
+			kty:     "OKP",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyRing, err := LoadKeyRing(config.Config{
+				JWTKeyFile:         tt.keyFile,
+				JWTPreviousSecrets: []string{strings.Repeat("o", minSecretLength)},
+			})
+			require.NoError(t, err)
+
+			SetKeyRing(keyRing)
+
+			token, err := BuildJWTToken()
+			require.NoError(t, err)
+
+			parsedToken, _, err := jwt.NewParser().ParseUnverified(token, &claims{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, parsedToken.Header["alg"])
+
+			_, err = GetUserID(token)
+			assert.NoError(t, err)
+
+			jwks := JWKS()
+			require.Len(t, jwks.Keys, 1, "hmac secrets must not be published")
+			assert.Equal(t, tt.kty, jwks.Keys[0].KeyType)
+			assert.Equal(t, tt.alg, jwks.Keys[0].Algorithm)
+			assert.Equal(t, parsedToken.Header["kid"], jwks.Keys[0].KeyID)
+		})
+	}
+
+	t.Run("public key cannot sign", func(t *testing.T) {
+		publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+		require.NoError(t, err)
+
+		publicPath := filepath.Join(dir, "public.pem")
+		require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0o600))
+
+		_, err = LoadKeyRing(config.Config{JWTKeyFile: publicPath})
+		assert.ErrorIs(t, err, ErrNoPrivateKey)
+	})
+
+	t.Run("hmac token with asymmetric kid is rejected", func(t *testing.T) {
+		keyRing, err := LoadKeyRing(config.Config{JWTKeyFile: rsaPath})
+		require.NoError(t, err)
+
+		SetKeyRing(keyRing)
+
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{UserID: "forged"})
+		token.Header["kid"] = keyRing.current.ID
+		tokenString, err := token.SignedString(x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey))
+		require.NoError(t, err)
+
+		_, err = GetUserID(tokenString)
+		assert.Error(t, err)
+	})
+}
+
+func TestSessionRenewal(t *testing.T) {
+	keyRing, err := LoadKeyRing(config.Config{JWTSecret: strings.Repeat("s", minSecretLength)})
+	require.NoError(t, err)
+
+	SetKeyRing(keyRing)
+	SetLifetime(time.Hour, 5*time.Hour)
+
+	// Время проверки токенов в jwt тоже подменяется, иначе продленные токены будут выпущены в будущем.
+	jwt.TimeFunc = func() time.Time { return now() }
+
+	defer func() {
+		now = time.Now
+		jwt.TimeFunc = time.Now
+		SetLifetime(0, defaultAbsoluteLifetime)
+	}()
+
+	start := time.Now().Truncate(time.Second)
+	now = func() time.Time { return start }
+
+	token, err := BuildJWTToken()
+	require.NoError(t, err)
+
+	session, err := ParseJWTToken(token)
+	require.NoError(t, err)
+	assert.False(t, session.NeedsRenewal(), "fresh token must not be renewed")
+
+	now = func() time.Time { return start.Add(40 * time.Minute) }
+	assert.True(t, session.NeedsRenewal())
+
+	renewedToken, err := RenewJWTToken(session)
+	require.NoError(t, err)
+
+	renewedSession, err := ParseJWTToken(renewedToken)
+	require.NoError(t, err)
+	assert.Equal(t, session.UserID, renewedSession.UserID)
+	assert.Equal(t, session.ID, renewedSession.ID, "renewed token must stay in the same session")
+	assert.NotEqual(t, session.TokenID, renewedSession.TokenID, "every token must have its own jti")
+	assert.Equal(t, start, renewedSession.StartedAt)
+	assert.Equal(t, start.Add(100*time.Minute), renewedSession.ExpiresAt)
+
+	now = func() time.Time { return start.Add(4*time.Hour + 30*time.Minute) }
+
+	cappedToken, err := RenewJWTToken(renewedSession)
+	require.NoError(t, err)
+
+	cappedSession, err := ParseJWTToken(cappedToken)
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(5*time.Hour), cappedSession.ExpiresAt, "token must not outlive the session")
+
+	now = func() time.Time { return start.Add(5 * time.Hour) }
+	assert.False(t, cappedSession.NeedsRenewal())
+
+	_, err = RenewJWTToken(cappedSession)
+	assert.ErrorIs(t, err, ErrSessionExpired)
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// MinPasswordLength - минимальная длина пароля.
+	MinPasswordLength = 8
+	// MaxPasswordLength - максимальная длина пароля в байтах, bcrypt не учитывает байты после 72-го.
+	MaxPasswordLength = 72
+
+	passwordCost = bcrypt.DefaultCost
+)
+
+var (
+	// ErrWeakPassword - ошибка, которая означает, что пароль короче MinPasswordLength.
+	ErrWeakPassword = errors.New("password is too short")
+	// ErrPasswordTooLong - ошибка, которая означает, что пароль длиннее MaxPasswordLength байт.
+	ErrPasswordTooLong = errors.New("password is too long")
+	// ErrWrongPassword - ошибка, которая означает, что пароль не совпадает с хешем.
+	ErrWrongPassword = errors.New("wrong password")
+)
+
+// dummyPasswordHash - хеш, с которым сравнивается пароль, если пользователь не найден,
+// чтобы по времени ответа нельзя было узнать, занят ли логин.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), passwordCost)
+
+// HashPassword - функция, которая проверяет длину пароля и возвращает его хеш bcrypt для хранения.
+func HashPassword(password string) (string, error) {
+	if len([]rune(password)) < MinPasswordLength {
+		return "", ErrWeakPassword
+	}
+
+	if len(password) > MaxPasswordLength {
+		return "", ErrPasswordTooLong
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// CheckPassword - функция, которая сравнивает пароль с хешем. Если хеш пустой, то пароль сравнивается с фиктивным хешем
+// и всегда возвращается ErrWrongPassword.
+func CheckPassword(hash string, password string) error {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return ErrWrongPassword
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrWrongPassword
+		}
+
+		return err
+	}
+
+	return nil
+}
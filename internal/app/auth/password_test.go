@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		err      error
+	}{
+		{
+			name:     "valid password",
+			password: "correct horse",
+		},
+		{
+			name:     "short password",
+			password: "секрет",
+			err:      ErrWeakPassword,
+		},
+		{
+			name:     "long password",
+			password: strings.Repeat("p", MaxPasswordLength+1),
+			err:      ErrPasswordTooLong,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := HashPassword(tt.password)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotContains(t, hash, tt.password)
+			assert.NoError(t, CheckPassword(hash, tt.password))
+			assert.ErrorIs(t, CheckPassword(hash, tt.password+"!"), ErrWrongPassword)
+		})
+	}
+
+	assert.ErrorIs(t, CheckPassword("", "correct horse"), ErrWrongPassword, "missing user must not match any password")
+}
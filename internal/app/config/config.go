@@ -5,7 +5,9 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
+	"net/http"
 	"net/url"
 	"os"
 	"strings"
@@ -29,14 +31,89 @@ type Config struct {
 	EnableHTTPS bool `env:"ENABLE_HTTPS" json:"enable_https"`
 	// ConfigPath - путь к файлу JSON-конфигурации
 	ConfigPath string `env:"CONFIG"`
+	// AllowedSchemes - схемы оригинальных ссылок, которые разрешено сокращать.
+	AllowedSchemes []string `env:"ALLOWED_SCHEMES" envSeparator:"," json:"allowed_schemes"`
+	// PolicyFilePath - путь к файлу с правилами блокировки и разрешения доменов.
+	PolicyFilePath string `env:"POLICY_FILE" json:"policy_file"`
+	// AdminToken - токен для доступа к API администратора. Если не задан, то API администратора отключено.
+	AdminToken string `env:"ADMIN_TOKEN" json:"admin_token"`
+	// AdminLogins - логины учетных записей, которые при входе получают роль администратора.
+	AdminLogins []string `env:"ADMIN_LOGINS" envSeparator:"," json:"admin_logins"`
+	// RedirectStatus - код ответа при перенаправлении по умолчанию: 301, 302, 307 или 308. Если не задан, то 307.
+	RedirectStatus int `env:"REDIRECT_STATUS" json:"redirect_status"`
+	// RedirectMaxAge - время в секундах, на которое клиенты могут закешировать постоянное перенаправление.
+	RedirectMaxAge int `env:"REDIRECT_MAX_AGE" json:"redirect_max_age"`
+	// ShortDomains - дополнительные домены сокращенных ссылок в формате "host" или "host=fallback_url".
+	// fallback_url - страница, на которую перенаправляются запросы к несуществующим ссылкам домена.
+	// Чтобы задать страницу для домена по умолчанию, нужно указать хост из BaseShortURLAddress.
+	ShortDomains []string `env:"SHORT_DOMAINS" envSeparator:"," json:"short_domains"`
+	// TemplatesDir - директория с шаблонами страниц ошибок и главной страницы.
+	// Шаблоны, которых нет в директории, берутся встроенные.
+	TemplatesDir string `env:"TEMPLATES_DIR" json:"templates_dir"`
+	// JWTSecret - секрет, которым подписываются новые JWT-токены.
+	JWTSecret string `env:"JWT_SECRET" json:"jwt_secret"`
+	// JWTSecretFile - путь к файлу с секретом для подписи JWT-токенов. Используется вместо JWTSecret.
+	JWTSecretFile string `env:"JWT_SECRET_FILE" json:"jwt_secret_file"`
+	// JWTPreviousSecrets - предыдущие секреты, токены с которыми еще принимаются, но новыми токенами не подписываются.
+	JWTPreviousSecrets []string `env:"JWT_PREVIOUS_SECRETS" envSeparator:"," json:"jwt_previous_secrets"`
+	// JWTKeyFile - путь к PEM-файлу с закрытым ключом RSA или Ed25519 для подписи JWT-токенов.
+	// Используется вместо JWTSecret, открытый ключ публикуется в /.well-known/jwks.json.
+	JWTKeyFile string `env:"JWT_KEY_FILE" json:"jwt_key_file"`
+	// JWTPreviousKeyFiles - PEM-файлы с предыдущими ключами RSA или Ed25519, закрытыми или открытыми.
+	JWTPreviousKeyFiles []string `env:"JWT_PREVIOUS_KEY_FILES" envSeparator:"," json:"jwt_previous_key_files"`
+	// JWTLifetime - срок жизни JWT-токена в секундах. Токен продлевается, когда до его истечения остается меньше половины срока.
+	JWTLifetime int `env:"JWT_LIFETIME" json:"jwt_lifetime"`
+	// JWTAbsoluteLifetime - срок жизни сессии в секундах, после которого токен больше не продлевается.
+	// Если не задан, то 30 дней. 0 - без ограничения.
+	JWTAbsoluteLifetime int `env:"JWT_ABSOLUTE_LIFETIME" json:"jwt_absolute_lifetime"`
+	// AuthStrict - строгий режим: запросы к API без действующего JWT-токена отклоняются, новые пользователи не создаются.
+	AuthStrict bool `env:"AUTH_STRICT" json:"auth_strict"`
+	// CookieSecure - отправлять куки только по HTTPS. При EnableHTTPS включается всегда.
+	CookieSecure bool `env:"COOKIE_SECURE" json:"cookie_secure"`
+	// CookieSameSite - атрибут SameSite куки: lax, strict или none. Если не задан, то lax. Для none нужен CookieSecure.
+	CookieSameSite string `env:"COOKIE_SAME_SITE" json:"cookie_same_site"`
+	// CookieDomain - атрибут Domain куки. Если не задан, то куки доступны только хосту, который их выдал.
+	CookieDomain string `env:"COOKIE_DOMAIN" json:"cookie_domain"`
+	// RateLimitRedirect - количество переходов по сокращенным ссылкам в минуту на пользователя или IP-адрес. 0 - без ограничения.
+	RateLimitRedirect int `env:"RATE_LIMIT_REDIRECT" json:"rate_limit_redirect"`
+	// RateLimitShorten - количество сокращений одной ссылки в минуту на пользователя или IP-адрес. 0 - без ограничения.
+	RateLimitShorten int `env:"RATE_LIMIT_SHORTEN" json:"rate_limit_shorten"`
+	// RateLimitBatch - количество ссылок в пачках на сокращение в минуту на пользователя или IP-адрес.
+	// Пачка, в которой ссылок больше, отклоняется целиком. 0 - без ограничения.
+	RateLimitBatch int `env:"RATE_LIMIT_BATCH" json:"rate_limit_batch"`
+	// RateLimitImport - количество запросов на импорт ссылок в минуту на пользователя или IP-адрес. 0 - без ограничения.
+	RateLimitImport int `env:"RATE_LIMIT_IMPORT" json:"rate_limit_import"`
+	// RateLimitDelete - количество запросов на удаление ссылок в минуту на пользователя или IP-адрес. 0 - без ограничения.
+	RateLimitDelete int `env:"RATE_LIMIT_DELETE" json:"rate_limit_delete"`
 }
 
+var (
+	// ErrInvalidRedirectStatus - ошибка, которая означает, что код ответа при перенаправлении задан неверно.
+	ErrInvalidRedirectStatus = errors.New("invalid redirect status")
+	// ErrInvalidShortDomain - ошибка, которая означает, что домен сокращенных ссылок задан неверно.
+	ErrInvalidShortDomain = errors.New("invalid short domain")
+	// ErrInvalidTemplatesDir - ошибка, которая означает, что директория шаблонов не существует.
+	ErrInvalidTemplatesDir = errors.New("invalid templates directory")
+	// ErrJWTSecretConflict - ошибка, которая означает, что ключ подписи JWT-токенов задан несколькими способами.
+	ErrJWTSecretConflict = errors.New("only one of jwt secret, jwt secret file and jwt key file can be set")
+	// ErrInvalidJWTLifetime - ошибка, которая означает, что срок жизни JWT-токена задан неверно.
+	ErrInvalidJWTLifetime = errors.New("invalid jwt lifetime")
+	// ErrInvalidCookieSameSite - ошибка, которая означает, что атрибут SameSite куки задан неверно
+	// или задан none без Secure.
+	ErrInvalidCookieSameSite = errors.New("invalid cookie same site")
+	// ErrInvalidRateLimit - ошибка, которая означает, что ограничение частоты запросов задано неверно.
+	ErrInvalidRateLimit = errors.New("invalid rate limit")
+)
+
 // NewConfig – конструктор Config.
 func NewConfig() (Config, error) {
 	config := Config{
 		Address:             "localhost:8080",
 		BaseShortURLAddress: "http://localhost:8080/",
 		FileStoragePath:     "/tmp/short-url-db.json",
+		RedirectMaxAge:      3600,
+		JWTLifetime:         10800,
+		JWTAbsoluteLifetime: 2592000,
 	}
 
 	config.parseFlags()
@@ -87,6 +164,9 @@ func (c *Config) parseFlags() {
 	flag.StringVar(&c.DatabaseDSN, "d", c.DatabaseDSN, "Database data source name")
 	flag.BoolVar(&c.EnableHTTPS, "s", c.EnableHTTPS, "Enable HTTPS")
 	flag.StringVar(&c.ConfigPath, "c", c.ConfigPath, "JSON config path")
+	flag.StringVar(&c.PolicyFilePath, "p", c.PolicyFilePath, "Domain policy file path")
+	flag.IntVar(&c.RedirectStatus, "r", c.RedirectStatus, "Default redirect status code")
+	flag.StringVar(&c.TemplatesDir, "t", c.TemplatesDir, "HTML templates directory")
 	flag.Parse()
 }
 
@@ -98,6 +178,63 @@ func (c *Config) validateConfig() error {
 		}
 	}
 
+	for _, shortDomain := range c.ShortDomains {
+		host, fallbackURL, _ := strings.Cut(shortDomain, "=")
+		if strings.TrimSpace(host) == "" {
+			return ErrInvalidShortDomain
+		}
+
+		if fallbackURL != "" {
+			if _, err := url.ParseRequestURI(fallbackURL); err != nil {
+				return ErrInvalidShortDomain
+			}
+		}
+	}
+
+	signingKeys := 0
+	for _, source := range []string{c.JWTSecret, c.JWTSecretFile, c.JWTKeyFile} {
+		if source != "" {
+			signingKeys++
+		}
+	}
+
+	if signingKeys > 1 {
+		return ErrJWTSecretConflict
+	}
+
+	if c.JWTLifetime < 0 || c.JWTAbsoluteLifetime < 0 {
+		return ErrInvalidJWTLifetime
+	}
+
+	for _, rateLimit := range []int{c.RateLimitRedirect, c.RateLimitShorten, c.RateLimitBatch, c.RateLimitImport, c.RateLimitDelete} {
+		if rateLimit < 0 {
+			return ErrInvalidRateLimit
+		}
+	}
+
+	if c.TemplatesDir != "" {
+		info, err := os.Stat(c.TemplatesDir)
+		if err != nil || !info.IsDir() {
+			return ErrInvalidTemplatesDir
+		}
+	}
+
+	switch strings.ToLower(c.CookieSameSite) {
+	case "", "lax", "strict":
+	case "none":
+		if !c.CookieSecure && !c.EnableHTTPS {
+			return ErrInvalidCookieSameSite
+		}
+	default:
+		return ErrInvalidCookieSameSite
+	}
+
+	switch c.RedirectStatus {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return ErrInvalidRedirectStatus
+	}
+
 	return nil
 }
 
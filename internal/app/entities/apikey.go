@@ -0,0 +1,49 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// ScopeShorten - право сокращать ссылки и менять их.
+	ScopeShorten = "shorten"
+	// ScopeRead - право читать ссылки пользователя и их статистику.
+	ScopeRead = "read"
+	// ScopeDelete - право удалять ссылки пользователя.
+	ScopeDelete = "delete"
+)
+
+// Scopes - все права, которые можно выдать ключу API.
+var Scopes = []string{ScopeShorten, ScopeRead, ScopeDelete}
+
+// APIKey - структура, которая описывает строку таблицы api_key в базе данных.
+// Сам ключ не хранится, хранится только его хеш и начало ключа, по которому пользователь узнает ключ в списке.
+type APIKey struct {
+	ID        string         `db:"id"`
+	UserID    string         `db:"user_id"`
+	Name      string         `db:"name"`
+	Prefix    string         `db:"prefix"`
+	Hash      string         `db:"key_hash"`
+	Scopes    pq.StringArray `db:"scopes"`
+	CreatedAt time.Time      `db:"created_at"`
+	// ExpiresAt - время, после которого ключ не принимается. Если nil, то ключ бессрочный.
+	ExpiresAt *time.Time `db:"expires_at"`
+}
+
+// Expired - функция, которая проверяет, что срок действия ключа истек к моменту now.
+func (k APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// HasScope - функция, которая проверяет, что ключу выдано право scope.
+func (k APIKey) HasScope(scope string) bool {
+	for _, keyScope := range k.Scopes {
+		if keyScope == scope {
+			return true
+		}
+	}
+
+	return false
+}
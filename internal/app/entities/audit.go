@@ -0,0 +1,16 @@
+package entities
+
+import "time"
+
+// AuditEntry - структура, которая описывает строку таблицы admin_audit в базе данных: одно действие администратора.
+type AuditEntry struct {
+	ID int64 `db:"id"`
+	// Actor - кто выполнил действие: "admin-token" для токена администратора или "user:<id>" для учетной записи.
+	Actor    string `db:"actor"`
+	Action   string `db:"action"`
+	Domain   string `db:"domain"`
+	ShortURL string `db:"short_url"`
+	// Details - параметры действия, например новый владелец ссылки.
+	Details   string    `db:"details"`
+	CreatedAt time.Time `db:"created_at"`
+}
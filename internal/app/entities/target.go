@@ -0,0 +1,84 @@
+package entities
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	// DeviceIOS - устройства на iOS.
+	DeviceIOS = "ios"
+	// DeviceAndroid - устройства на Android.
+	DeviceAndroid = "android"
+	// DeviceDesktop - остальные устройства.
+	DeviceDesktop = "desktop"
+)
+
+// Target - структура, которая описывает один из вариантов оригинальной ссылки для A/B-тестов
+// и перенаправления в зависимости от устройства.
+type Target struct {
+	// Name - название варианта, которое записывается в статистику переходов.
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+	// Weight - вес варианта среди вариантов для того же устройства.
+	Weight int `json:"weight,omitempty"`
+	// Device - устройство, для которого подходит вариант. Если пустое, то вариант подходит для всех устройств.
+	Device string `json:"device,omitempty"`
+}
+
+// Targets - тип, который описывает колонку targets таблицы url в базе данных. Хранится в формате JSON.
+type Targets []Target
+
+// Value - функция, которая преобразует Targets в значение колонки базы данных.
+func (t Targets) Value() (driver.Value, error) {
+	if t == nil {
+		return []byte("[]"), nil
+	}
+
+	return json.Marshal(t)
+}
+
+// Scan - функция, которая читает Targets из значения колонки базы данных.
+func (t *Targets) Scan(src interface{}) error {
+	var data []byte
+
+	switch value := src.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		data = value
+	case string:
+		data = []byte(value)
+	default:
+		return errors.New("unsupported targets column type")
+	}
+
+	if err := json.Unmarshal(data, t); err != nil {
+		return err
+	}
+
+	if len(*t) == 0 {
+		*t = nil
+	}
+
+	return nil
+}
+
+// Click - структура, которая описывает строку таблицы url_click в базе данных.
+type Click struct {
+	ShortURL string `db:"short_url"`
+	Domain   string `db:"domain"`
+	// Variant - название варианта, на который был перенаправлен клиент. Пустое, если у ссылки нет вариантов.
+	Variant   string    `db:"variant"`
+	Device    string    `db:"device"`
+	ClickedAt time.Time `db:"clicked_at"`
+}
+
+// ClickStat - структура, которая описывает количество переходов по одному варианту сокращенной ссылки.
+type ClickStat struct {
+	Variant string `db:"variant"`
+	Count   int64  `db:"count"`
+}
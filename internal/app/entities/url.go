@@ -2,11 +2,61 @@
 
 package entities
 
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
 // URL - структура, которая описывает строку таблицы url в базе данных.
+// Domain - хост домена сокращенной ссылки, пустой для домена по умолчанию.
 type URL struct {
 	UUID        string `db:"id"`
 	ShortURL    string `db:"short_url"`
+	Domain      string `db:"domain"`
 	OriginalURL string `db:"original_url"`
 	UserID      string `db:"user_id"`
 	DeletedFlag bool   `db:"is_deleted"`
+	FlaggedFlag bool   `db:"is_flagged"`
+	// DisabledFlag - признак, что администратор отключил ссылку и переход по ней запрещен.
+	DisabledFlag bool      `db:"is_disabled"`
+	CreatedAt    time.Time `db:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at"`
+	// Title, Tags и Notes - метаданные, которые пользователь задает при сокращении ссылки.
+	Title string         `db:"title"`
+	Tags  pq.StringArray `db:"tags"`
+	Notes string         `db:"notes"`
+	// RedirectStatus - код ответа при перенаправлении. Если 0, то используется код из конфигурации.
+	RedirectStatus int `db:"redirect_status"`
+	// QueryMode - правило, по которому параметры запроса попадают в оригинальную ссылку при перенаправлении.
+	QueryMode string `db:"query_mode"`
+	// DefaultQuery - параметры, например UTM-метки, которые добавляются к оригинальной ссылке при перенаправлении.
+	DefaultQuery string `db:"default_query"`
+	// Targets - варианты оригинальной ссылки, между которыми распределяются переходы.
+	Targets Targets `db:"targets"`
+	// ExpiresAt - время, после которого переход по ссылке запрещен. Если nil, то ссылка бессрочная.
+	ExpiresAt *time.Time `db:"expires_at"`
+}
+
+// Expired - функция, которая проверяет, что срок действия ссылки истек к моменту now.
+func (u URL) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !u.ExpiresAt.After(now)
+}
+
+const (
+	// QueryModeIgnore - параметры запроса к сокращенной ссылке отбрасываются, оригинальная ссылка не меняется.
+	QueryModeIgnore = "ignore"
+	// QueryModeDefaults - к оригинальной ссылке добавляются только параметры по умолчанию.
+	QueryModeDefaults = "defaults"
+	// QueryModePassThrough - к оригинальной ссылке добавляются параметры запроса к сокращенной ссылке
+	// и параметры по умолчанию, которых нет в запросе.
+	QueryModePassThrough = "passthrough"
+)
+
+// URLHistory - структура, которая описывает строку таблицы url_history в базе данных.
+// Хранит предыдущую оригинальную ссылку, на которую указывала сокращенная ссылка.
+type URLHistory struct {
+	ShortURL    string    `db:"short_url"`
+	OriginalURL string    `db:"original_url"`
+	ChangedAt   time.Time `db:"changed_at"`
 }
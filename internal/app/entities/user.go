@@ -0,0 +1,12 @@
+package entities
+
+import "time"
+
+// User - структура, которая описывает строку таблицы users в базе данных.
+// ID совпадает с идентификатором пользователя в JWT-токене, пароль хранится только в виде хеша.
+type User struct {
+	ID           string    `db:"id"`
+	Login        string    `db:"login"`
+	PasswordHash string    `db:"password_hash"`
+	CreatedAt    time.Time `db:"created_at"`
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/VladKvetkin/shortener/internal/app/auth"
+	"github.com/VladKvetkin/shortener/internal/app/entities"
+	"github.com/VladKvetkin/shortener/internal/app/middleware"
+	"github.com/VladKvetkin/shortener/internal/app/models"
+	"github.com/VladKvetkin/shortener/internal/app/storage"
+)
+
+// loginPattern - допустимый логин учетной записи.
+var loginPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._@-]{2,63}$`)
+
+// RegisterHandler – функция-обработчик, которая создает учетную запись с логином и паролем и выпускает для нее JWT-токен.
+// Сокращенные ссылки и ключи API анонимного пользователя из текущего токена переходят к учетной записи.
+// Если логин занят, то возвращается http.StatusConflict.
+// Учетную запись администратора из конфигурации можно создать только с токеном администратора.
+func (h *Handler) RegisterHandler(res http.ResponseWriter, req *http.Request) {
+	login, password, ok := decodeCredentials(res, req)
+	if !ok {
+		return
+	}
+
+	if !loginPattern.MatchString(login) {
+		http.Error(res, "Invalid login", http.StatusBadRequest)
+		return
+	}
+
+	if h.accountRole(login) == auth.RoleAdmin && !h.hasAdminToken(req) {
+		http.Error(res, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(password)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrWeakPassword):
+			http.Error(res, "Password is too short", http.StatusBadRequest)
+		case errors.Is(err, auth.ErrPasswordTooLong):
+			http.Error(res, "Password is too long", http.StatusBadRequest)
+		default:
+			http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	account := entities.User{
+		ID:           uuid.NewString(),
+		Login:        login,
+		PasswordHash: passwordHash,
+	}
+
+	if err := h.storage.AddUser(req.Context(), account); err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			http.Error(res, "Login is already taken", http.StatusConflict)
+			return
+		}
+
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	h.mergeAnonymousUser(req, account.ID)
+	h.sendAccountToken(res, req, account, http.StatusCreated)
+}
+
+// LoginHandler – функция-обработчик, которая проверяет логин и пароль и выпускает JWT-токен учетной записи.
+// Данные анонимного пользователя из текущего токена к учетной записи не переходят, они остаются в прежнем токене.
+// Если логин или пароль неверный, то возвращается http.StatusUnauthorized.
+func (h *Handler) LoginHandler(res http.ResponseWriter, req *http.Request) {
+	login, password, ok := decodeCredentials(res, req)
+	if !ok {
+		return
+	}
+
+	account, err := h.storage.ReadUserByLogin(req.Context(), login)
+	if err != nil && !errors.Is(err, storage.ErrUserNotExists) {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if err := auth.CheckPassword(account.PasswordHash, password); err != nil {
+		if errors.Is(err, auth.ErrWrongPassword) {
+			http.Error(res, "Wrong login or password", http.StatusUnauthorized)
+			return
+		}
+
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	h.sendAccountToken(res, req, account, http.StatusOK)
+}
+
+func decodeCredentials(res http.ResponseWriter, req *http.Request) (string, string, bool) {
+	var requestModel models.APIAuthCredentialsRequest
+
+	jsonDecoder := json.NewDecoder(req.Body)
+
+	if err := jsonDecoder.Decode(&requestModel); err != nil {
+		http.Error(res, "Cannot decode request JSON body", http.StatusBadRequest)
+		return "", "", false
+	}
+
+	return strings.ToLower(strings.TrimSpace(requestModel.Login)), requestModel.Password, true
+}
+
+// mergeAnonymousUser передает данные пользователя из текущего токена учетной записи accountID.
+// Данные другой учетной записи не передаются, иначе регистрация из чужой сессии забирала бы ссылки у ее учетной записи.
+// Ошибка объединения не мешает входу и только записывается в лог.
+func (h *Handler) mergeAnonymousUser(req *http.Request, accountID string) {
+	userID, ok := req.Context().Value(middleware.UserIDKey{}).(string)
+	if !ok || userID == accountID {
+		return
+	}
+
+	if err := h.mergeUser(req.Context(), userID, accountID); err != nil {
+		zap.L().Sugar().Errorw(
+			"Cannot merge anonymous user into account",
+			"err", err,
+			"user_id", userID,
+			"account_id", accountID,
+		)
+	}
+}
+
+func (h *Handler) mergeUser(ctx context.Context, userID string, accountID string) error {
+	_, err := h.storage.ReadUserByID(ctx, userID)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, storage.ErrUserNotExists) {
+		return err
+	}
+
+	return h.storage.MergeUser(ctx, userID, accountID)
+}
+
+// accountRole возвращает роль учетной записи с логином login: администраторы перечислены в конфигурации.
+func (h *Handler) accountRole(login string) string {
+	for _, adminLogin := range h.config.AdminLogins {
+		if strings.EqualFold(strings.TrimSpace(adminLogin), login) {
+			return auth.RoleAdmin
+		}
+	}
+
+	return ""
+}
+
+// sendAccountToken выпускает токен новой сессии учетной записи и отправляет его так же, как RefreshTokenHandler.
+func (h *Handler) sendAccountToken(res http.ResponseWriter, req *http.Request, account entities.User, status int) {
+	token, err := auth.BuildUserJWTToken(account.ID, h.accountRole(account.Login))
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	session, err := auth.ParseJWTToken(token)
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if _, bearer := middleware.BearerToken(req); !bearer {
+		middleware.SetTokenCookie(res, token)
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(status)
+
+	jsonEncoder := json.NewEncoder(res)
+	if err := jsonEncoder.Encode(models.APIAuthTokenResponse{
+		Token:     token,
+		ExpiresAt: session.ExpiresAt,
+	}); err != nil {
+		http.Error(res, "Cannot encode response JSON body", http.StatusInternalServerError)
+		return
+	}
+}
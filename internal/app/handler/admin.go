@@ -0,0 +1,365 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/VladKvetkin/shortener/internal/app/auth"
+	"github.com/VladKvetkin/shortener/internal/app/entities"
+	"github.com/VladKvetkin/shortener/internal/app/middleware"
+	"github.com/VladKvetkin/shortener/internal/app/models"
+	"github.com/VladKvetkin/shortener/internal/app/storage"
+)
+
+// AdminTokenHeader - заголовок, в котором передается токен администратора.
+const AdminTokenHeader = middleware.AdminTokenHeader
+
+// Действия администратора в журнале.
+const (
+	auditActionLookup       = "lookup"
+	auditActionFlag         = "flag"
+	auditActionDisable      = "disable"
+	auditActionTransfer     = "transfer"
+	auditActionDelete       = "delete"
+	auditActionListUserURLs = "list_user_urls"
+)
+
+const (
+	// adminTokenActor - автор действий, выполненных с токеном администратора.
+	adminTokenActor = "admin-token"
+
+	defaultAuditLogLimit = 100
+	maxAuditLogLimit     = 1000
+)
+
+// adminActorKey - ключ контекста, в котором AdminOnly сохраняет автора действий для журнала.
+type adminActorKey struct{}
+
+// AdminOnly - функция, которая пропускает к API администратора только запросы с токеном администратора
+// или с JWT-токеном учетной записи с ролью администратора. Ключи API доступа к API администратора не дают.
+func (h *Handler) AdminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		actor, ok, err := h.adminActor(req)
+		if err != nil {
+			http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if !ok {
+			http.Error(res, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(res, req.WithContext(context.WithValue(req.Context(), adminActorKey{}, actor)))
+	})
+}
+
+// AdminLookupURLHandler – функция-обработчик, которая ищет любую сокращенную ссылку по коду (параметр code)
+// или по оригинальной ссылке (параметр original_url).
+func (h *Handler) AdminLookupURLHandler(res http.ResponseWriter, req *http.Request) {
+	domain, err := h.requestDomain(req)
+	if err != nil {
+		http.Error(res, "Unknown domain", http.StatusBadRequest)
+		return
+	}
+
+	code := req.URL.Query().Get("code")
+	originalURL := req.URL.Query().Get("original_url")
+
+	var url entities.URL
+
+	switch {
+	case code != "":
+		url, err = h.storage.ReadByID(req.Context(), domain.key, code)
+	case originalURL != "":
+		if normalizedURL, err := h.normalizer.Normalize(originalURL); err == nil {
+			originalURL = normalizedURL
+		}
+
+		url, err = h.storage.ReadByOriginalURL(req.Context(), domain.key, originalURL)
+	default:
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		if errors.Is(err, storage.ErrIDNotExists) {
+			http.Error(res, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(req, auditActionLookup, url.Domain, url.ShortURL, "")
+	sendJSON(res, http.StatusOK, h.adminURLResponse(url))
+}
+
+// AdminFlagURLHandler – функция-обработчик, которая помечает сокращенную ссылку или снимает с нее пометку.
+// Перед переходом по помеченной ссылке показывается страница-предупреждение.
+func (h *Handler) AdminFlagURLHandler(res http.ResponseWriter, req *http.Request) {
+	var requestModel models.APIAdminFlagURLRequest
+
+	h.adminUpdateURL(res, req, &requestModel, func(ctx context.Context, domain string, id string) (string, string, error) {
+		return auditActionFlag, "flagged=" + strconv.FormatBool(requestModel.Flagged),
+			h.storage.SetFlagged(ctx, domain, id, requestModel.Flagged)
+	})
+}
+
+// AdminDisableURLHandler – функция-обработчик, которая отключает сокращенную ссылку или включает ее обратно.
+// Переход по отключенной ссылке запрещен.
+func (h *Handler) AdminDisableURLHandler(res http.ResponseWriter, req *http.Request) {
+	var requestModel models.APIAdminDisableURLRequest
+
+	h.adminUpdateURL(res, req, &requestModel, func(ctx context.Context, domain string, id string) (string, string, error) {
+		return auditActionDisable, "disabled=" + strconv.FormatBool(requestModel.Disabled),
+			h.storage.SetDisabled(ctx, domain, id, requestModel.Disabled)
+	})
+}
+
+// AdminTransferURLHandler – функция-обработчик, которая передает сокращенную ссылку другому пользователю.
+func (h *Handler) AdminTransferURLHandler(res http.ResponseWriter, req *http.Request) {
+	var requestModel models.APIAdminTransferURLRequest
+
+	h.adminUpdateURL(res, req, &requestModel, func(ctx context.Context, domain string, id string) (string, string, error) {
+		if _, err := uuid.Parse(requestModel.UserID); err != nil {
+			return "", "", errInvalidUserID
+		}
+
+		return auditActionTransfer, "user_id=" + requestModel.UserID,
+			h.storage.SetOwner(ctx, domain, id, requestModel.UserID)
+	})
+}
+
+// AdminDeleteURLHandler – функция-обработчик, которая безвозвратно удаляет сокращенную ссылку вместе с историей и переходами.
+func (h *Handler) AdminDeleteURLHandler(res http.ResponseWriter, req *http.Request) {
+	h.adminUpdateURL(res, req, nil, func(ctx context.Context, domain string, id string) (string, string, error) {
+		return auditActionDelete, "", h.storage.Remove(ctx, domain, id)
+	})
+}
+
+// AdminGetUserURLsHandler – функция-обработчик, которая возвращает сокращенные ссылки любого пользователя, включая удаленные.
+// Поддерживает те же параметры выборки и постраничный вывод, что и GetUserUrlsHandler.
+func (h *Handler) AdminGetUserURLsHandler(res http.ResponseWriter, req *http.Request) {
+	userID := chi.URLParam(req, "userID")
+	if userID == "" {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	query, err := parseUserURLsQuery(req.URL.Query(), userID)
+	if err != nil {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	query.IncludeDeleted = true
+
+	limit := query.Limit
+	query.Limit++
+
+	userURLs, err := h.storage.GetUserURLsPage(req.Context(), query)
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if len(userURLs) > limit {
+		userURLs = userURLs[:limit]
+
+		lastURL := userURLs[len(userURLs)-1]
+		res.Header().Set("Link", nextPageLink(req.URL, storage.Cursor{
+			CreatedAt: lastURL.CreatedAt,
+			ShortURL:  lastURL.ShortURL,
+			Domain:    lastURL.Domain,
+		}))
+	}
+
+	responseModel := make([]models.APIAdminURLResponse, 0, len(userURLs))
+	for _, userURL := range userURLs {
+		responseModel = append(responseModel, h.adminURLResponse(userURL))
+	}
+
+	h.audit(req, auditActionListUserURLs, "", "", "user_id="+userID)
+	sendJSON(res, http.StatusOK, responseModel)
+}
+
+// AdminAuditLogHandler – функция-обработчик, которая возвращает последние записи журнала действий администраторов,
+// от новых к старым. Количество записей задается параметром limit, по умолчанию 100.
+func (h *Handler) AdminAuditLogHandler(res http.ResponseWriter, req *http.Request) {
+	limit := defaultAuditLogLimit
+
+	if rawLimit := req.URL.Query().Get("limit"); rawLimit != "" {
+		parsedLimit, err := strconv.Atoi(rawLimit)
+		if err != nil || parsedLimit < 1 || parsedLimit > maxAuditLogLimit {
+			http.Error(res, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		limit = parsedLimit
+	}
+
+	entries, err := h.storage.GetAuditLog(req.Context(), limit)
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	responseModel := make([]models.APIAdminAuditEntryResponse, 0, len(entries))
+	for _, entry := range entries {
+		responseModel = append(responseModel, models.APIAdminAuditEntryResponse{
+			ID:        entry.ID,
+			Actor:     entry.Actor,
+			Action:    entry.Action,
+			Domain:    entry.Domain,
+			ShortURL:  entry.ShortURL,
+			Details:   entry.Details,
+			CreatedAt: entry.CreatedAt,
+		})
+	}
+
+	sendJSON(res, http.StatusOK, responseModel)
+}
+
+// errInvalidUserID - ошибка проверки идентификатора нового владельца ссылки.
+var errInvalidUserID = errors.New("invalid user id")
+
+// adminUpdateURL разбирает тело запроса в requestModel, если он задан, выполняет update для ссылки из пути
+// и записывает действие в журнал.
+func (h *Handler) adminUpdateURL(
+	res http.ResponseWriter,
+	req *http.Request,
+	requestModel interface{},
+	update func(ctx context.Context, domain string, id string) (string, string, error),
+) {
+	id := chi.URLParam(req, "id")
+	if id == "" {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if requestModel != nil {
+		if err := json.NewDecoder(req.Body).Decode(requestModel); err != nil {
+			http.Error(res, "Cannot decode request JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	domain, err := h.requestDomain(req)
+	if err != nil {
+		http.Error(res, "Unknown domain", http.StatusBadRequest)
+		return
+	}
+
+	action, details, err := update(req.Context(), domain.key, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidUserID):
+			http.Error(res, "Invalid user id", http.StatusBadRequest)
+		case errors.Is(err, storage.ErrIDNotExists):
+			http.Error(res, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		default:
+			http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	h.audit(req, action, domain.key, id, details)
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// audit записывает действие администратора в журнал. Если запись не удалась, то действие попадает в лог приложения.
+func (h *Handler) audit(req *http.Request, action string, domain string, id string, details string) {
+	actor, _ := req.Context().Value(adminActorKey{}).(string)
+
+	entry := entities.AuditEntry{
+		Actor:    actor,
+		Action:   action,
+		Domain:   domain,
+		ShortURL: id,
+		Details:  details,
+	}
+
+	if err := h.storage.AddAuditEntry(req.Context(), entry); err != nil {
+		zap.L().Sugar().Errorw(
+			"Cannot write admin audit entry",
+			"err", err,
+			"actor", entry.Actor,
+			"action", entry.Action,
+			"domain", entry.Domain,
+			"short_url", entry.ShortURL,
+			"details", entry.Details,
+		)
+	}
+}
+
+func (h *Handler) adminURLResponse(url entities.URL) models.APIAdminURLResponse {
+	return models.APIAdminURLResponse{
+		ID:           url.ShortURL,
+		ShortURL:     h.formatShortURL(url.Domain, url.ShortURL),
+		Domain:       url.Domain,
+		OriginalURL:  url.OriginalURL,
+		UserID:       url.UserID,
+		DeletedFlag:  url.DeletedFlag,
+		FlaggedFlag:  url.FlaggedFlag,
+		DisabledFlag: url.DisabledFlag,
+		CreatedAt:    url.CreatedAt,
+		UpdatedAt:    url.UpdatedAt,
+	}
+}
+
+// adminActor возвращает автора действий администратора или false, если запрос не от администратора.
+func (h *Handler) adminActor(req *http.Request) (string, bool, error) {
+	if h.hasAdminToken(req) {
+		return adminTokenActor, true, nil
+	}
+
+	if _, ok := req.Context().Value(middleware.APIKeyScopesKey{}).([]string); ok {
+		return "", false, nil
+	}
+
+	session, ok := req.Context().Value(middleware.SessionKey{}).(auth.Session)
+	if !ok || session.Role != auth.RoleAdmin {
+		return "", false, nil
+	}
+
+	// Логин могли убрать из администраторов после выпуска токена, поэтому роль проверяется заново.
+	role, err := h.userRole(req.Context(), session.UserID)
+	if err != nil || role != auth.RoleAdmin {
+		return "", false, err
+	}
+
+	return "user:" + session.UserID, true, nil
+}
+
+// hasAdminToken проверяет токен администратора. Если токен в конфигурации не задан, то вход по токену отключен.
+func (h *Handler) hasAdminToken(req *http.Request) bool {
+	if h.config.AdminToken == "" {
+		return false
+	}
+
+	token := req.Header.Get(AdminTokenHeader)
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.config.AdminToken)) == 1
+}
+
+func sendJSON(res http.ResponseWriter, status int, responseModel interface{}) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+
+	jsonEncoder := json.NewEncoder(res)
+	if err := jsonEncoder.Encode(responseModel); err != nil {
+		http.Error(res, "Cannot encode response JSON body", http.StatusInternalServerError)
+		return
+	}
+}
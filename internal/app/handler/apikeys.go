@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+
+	"github.com/VladKvetkin/shortener/internal/app/auth"
+	"github.com/VladKvetkin/shortener/internal/app/entities"
+	"github.com/VladKvetkin/shortener/internal/app/middleware"
+	"github.com/VladKvetkin/shortener/internal/app/models"
+	"github.com/VladKvetkin/shortener/internal/app/storage"
+)
+
+// maxAPIKeyNameLength - максимальная длина названия ключа API.
+const maxAPIKeyNameLength = 64
+
+// CreateAPIKeyHandler – функция-обработчик, которая создает ключ API пользователя с названием, правами и сроком действия.
+// Ключ возвращается только в ответе на этот запрос, в базе данных хранится его хеш.
+func (h *Handler) CreateAPIKeyHandler(res http.ResponseWriter, req *http.Request) {
+	var requestModel models.APIKeyCreateRequest
+
+	userID, ok := req.Context().Value(middleware.UserIDKey{}).(string)
+	if !ok {
+		http.Error(res, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	jsonDecoder := json.NewDecoder(req.Body)
+
+	if err := jsonDecoder.Decode(&requestModel); err != nil {
+		http.Error(res, "Cannot decode request JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if requestModel.Name == "" || utf8.RuneCountInString(requestModel.Name) > maxAPIKeyNameLength {
+		http.Error(res, "Invalid API key name", http.StatusBadRequest)
+		return
+	}
+
+	scopes, ok := prepareScopes(requestModel.Scopes)
+	if !ok {
+		http.Error(res, "Invalid API key scopes", http.StatusBadRequest)
+		return
+	}
+
+	if requestModel.ExpiresAt != nil && !requestModel.ExpiresAt.After(time.Now()) {
+		http.Error(res, "Invalid API key expiry", http.StatusBadRequest)
+		return
+	}
+
+	rawKey, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	key := entities.APIKey{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      requestModel.Name,
+		Prefix:    prefix,
+		Hash:      hash,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: requestModel.ExpiresAt,
+	}
+
+	if err := h.storage.AddAPIKey(req.Context(), key); err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	responseModel := apiKeyResponse(key)
+	responseModel.Key = rawKey
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(http.StatusCreated)
+
+	jsonEncoder := json.NewEncoder(res)
+	if err := jsonEncoder.Encode(responseModel); err != nil {
+		http.Error(res, "Cannot encode response JSON body", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetAPIKeysHandler – функция-обработчик, которая возвращает ключи API пользователя без самих ключей.
+func (h *Handler) GetAPIKeysHandler(res http.ResponseWriter, req *http.Request) {
+	userID, ok := req.Context().Value(middleware.UserIDKey{}).(string)
+	if !ok {
+		http.Error(res, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := h.storage.GetUserAPIKeys(req.Context(), userID)
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	responseModel := make([]models.APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		responseModel = append(responseModel, apiKeyResponse(key))
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+
+	jsonEncoder := json.NewEncoder(res)
+	if err := jsonEncoder.Encode(responseModel); err != nil {
+		http.Error(res, "Cannot encode response JSON body", http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeleteAPIKeyHandler – функция-обработчик, которая отзывает ключ API пользователя.
+func (h *Handler) DeleteAPIKeyHandler(res http.ResponseWriter, req *http.Request) {
+	id := chi.URLParam(req, "id")
+	if id == "" {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := req.Context().Value(middleware.UserIDKey{}).(string)
+	if !ok {
+		http.Error(res, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.storage.DeleteAPIKey(req.Context(), userID, id); err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotExists) {
+			http.Error(res, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// prepareScopes проверяет права ключа API и убирает повторы. Ключ без прав не создается.
+func prepareScopes(requested []string) ([]string, bool) {
+	scopes := make([]string, 0, len(entities.Scopes))
+
+	for _, scope := range entities.Scopes {
+		for _, requestedScope := range requested {
+			if requestedScope == scope {
+				scopes = append(scopes, scope)
+				break
+			}
+		}
+	}
+
+	for _, requestedScope := range requested {
+		if !(entities.APIKey{Scopes: scopes}).HasScope(requestedScope) {
+			return nil, false
+		}
+	}
+
+	return scopes, len(scopes) > 0
+}
+
+func apiKeyResponse(key entities.APIKey) models.APIKeyResponse {
+	return models.APIKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+		ExpiresAt: key.ExpiresAt,
+	}
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/VladKvetkin/shortener/internal/app/auth"
+	"github.com/VladKvetkin/shortener/internal/app/middleware"
+	"github.com/VladKvetkin/shortener/internal/app/models"
+	"github.com/VladKvetkin/shortener/internal/app/storage"
+)
+
+// RefreshTokenHandler – функция-обработчик, которая выпускает новый JWT-токен для пользователя из текущего токена.
+// Роль в новом токене определяется заново по учетной записи и конфигурации.
+// Токен берется из заголовка Authorization: Bearer или из куки. Новый токен возвращается в формате JSON,
+// а если токен был в куки, то и записывается в нее.
+// Если токена нет, он недействителен или истек абсолютный срок жизни сессии, то возвращается http.StatusUnauthorized.
+func (h *Handler) RefreshTokenHandler(res http.ResponseWriter, req *http.Request) {
+	session, ok := requestSession(res, req)
+	if !ok {
+		return
+	}
+
+	role, err := h.userRole(req.Context(), session.UserID)
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	session.Role = role
+
+	renewedToken, err := auth.RenewJWTToken(session)
+	if err != nil {
+		middleware.Unauthorized(res, true)
+		return
+	}
+
+	renewedSession, err := auth.ParseJWTToken(renewedToken)
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Клиентам с Bearer-токеном куки не нужна, они берут токен из ответа.
+	if _, bearer := middleware.BearerToken(req); !bearer {
+		middleware.SetTokenCookie(res, renewedToken)
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(http.StatusOK)
+
+	jsonEncoder := json.NewEncoder(res)
+	if err := jsonEncoder.Encode(models.APIAuthTokenResponse{
+		Token:     renewedToken,
+		ExpiresAt: renewedSession.ExpiresAt,
+	}); err != nil {
+		http.Error(res, "Cannot encode response JSON body", http.StatusInternalServerError)
+		return
+	}
+}
+
+// LogoutHandler – функция-обработчик, которая отзывает сессию текущего JWT-токена вместе со всеми ее продленными токенами
+// и удаляет куки с токеном. Если токена нет или он недействителен, то возвращается http.StatusUnauthorized.
+func (h *Handler) LogoutHandler(res http.ResponseWriter, req *http.Request) {
+	session, ok := requestSession(res, req)
+	if !ok {
+		return
+	}
+
+	if session.ID != "" {
+		// Все токены сессии выпущены до выхода, поэтому истекут не позже чем через срок жизни токена.
+		revokedUntil := time.Now().Add(auth.TokenLifetime())
+		if session.ExpiresAt.After(revokedUntil) {
+			revokedUntil = session.ExpiresAt
+		}
+
+		if err := h.storage.RevokeToken(req.Context(), session.ID, revokedUntil); err != nil {
+			http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if _, bearer := middleware.BearerToken(req); !bearer {
+		middleware.ClearTokenCookie(res)
+	}
+
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// sessionStore - хранилище сессий для middleware.JWTCookie: отзыв сессий проверяется в базе данных,
+// а роль определяется по учетной записи и конфигурации.
+type sessionStore struct {
+	h *Handler
+}
+
+func (s sessionStore) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	return s.h.storage.IsTokenRevoked(ctx, id)
+}
+
+func (s sessionStore) UserRole(ctx context.Context, userID string) (string, error) {
+	return s.h.userRole(ctx, userID)
+}
+
+// userRole возвращает текущую роль пользователя userID. Роль администратора есть только у учетных записей,
+// логины которых перечислены в конфигурации, у анонимных пользователей роли нет.
+func (h *Handler) userRole(ctx context.Context, userID string) (string, error) {
+	account, err := h.storage.ReadUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotExists) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	return h.accountRole(account.Login), nil
+}
+
+// requestSession возвращает сессию из JWT-токена, переданного в запросе.
+// Если действительного токена нет, то отвечает http.StatusUnauthorized.
+func requestSession(res http.ResponseWriter, req *http.Request) (auth.Session, bool) {
+	session, ok := req.Context().Value(middleware.SessionKey{}).(auth.Session)
+	if !ok {
+		_, hasToken := middleware.RequestToken(req)
+		middleware.Unauthorized(res, hasToken)
+
+		return auth.Session{}, false
+	}
+
+	return session, true
+}
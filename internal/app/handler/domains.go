@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/VladKvetkin/shortener/internal/app/config"
+)
+
+var (
+	// ErrUnknownDomain - ошибка, которая означает, что домен сокращенных ссылок не настроен.
+	ErrUnknownDomain = errors.New("unknown short domain")
+)
+
+// shortDomain - структура, которая описывает домен сокращенных ссылок.
+type shortDomain struct {
+	// key - ключ домена в базе данных, пустой для домена по умолчанию.
+	key         string
+	baseURL     string
+	fallbackURL string
+}
+
+// domainRegistry - структура, которая хранит домены сокращенных ссылок из конфигурации.
+type domainRegistry struct {
+	scheme        string
+	defaultDomain shortDomain
+	defaultHost   string
+	domains       map[string]shortDomain
+}
+
+func newDomainRegistry(config config.Config) *domainRegistry {
+	registry := &domainRegistry{
+		scheme:        "http",
+		defaultDomain: shortDomain{baseURL: config.BaseShortURLAddress},
+		domains:       make(map[string]shortDomain, len(config.ShortDomains)),
+	}
+
+	if baseURL, err := url.Parse(config.BaseShortURLAddress); err == nil {
+		registry.defaultHost = normalizeHost(baseURL.Host)
+		if baseURL.Scheme != "" {
+			registry.scheme = baseURL.Scheme
+		}
+	}
+
+	for _, entry := range config.ShortDomains {
+		host, fallbackURL, _ := strings.Cut(entry, "=")
+		host = normalizeHost(host)
+
+		if host == registry.defaultHost {
+			registry.defaultDomain.fallbackURL = fallbackURL
+			continue
+		}
+
+		registry.domains[host] = shortDomain{
+			key:         host,
+			baseURL:     registry.scheme + "://" + host,
+			fallbackURL: fallbackURL,
+		}
+	}
+
+	return registry
+}
+
+// byHost возвращает домен по заголовку Host запроса. Для неизвестных хостов возвращается домен по умолчанию.
+func (r *domainRegistry) byHost(host string) shortDomain {
+	if domain, ok := r.domains[normalizeHost(host)]; ok {
+		return domain
+	}
+
+	return r.defaultDomain
+}
+
+// byName возвращает домен, который выбрал пользователь. Пустое имя означает домен по умолчанию.
+func (r *domainRegistry) byName(name string) (shortDomain, error) {
+	name = normalizeHost(name)
+	if name == "" || name == r.defaultHost {
+		return r.defaultDomain, nil
+	}
+
+	domain, ok := r.domains[name]
+	if !ok {
+		return shortDomain{}, ErrUnknownDomain
+	}
+
+	return domain, nil
+}
+
+// byKey возвращает домен сохраненной ссылки. Если домен убрали из конфигурации, то адрес строится по его хосту.
+func (r *domainRegistry) byKey(key string) shortDomain {
+	if key == "" {
+		return r.defaultDomain
+	}
+
+	if domain, ok := r.domains[key]; ok {
+		return domain
+	}
+
+	return shortDomain{key: key, baseURL: r.scheme + "://" + key}
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// requestDomain - функция, которая возвращает домен для запроса к API:
+// домен из параметра domain, если он передан, иначе домен по заголовку Host.
+func (h *Handler) requestDomain(req *http.Request) (shortDomain, error) {
+	if name := req.URL.Query().Get("domain"); name != "" {
+		return h.domains.byName(name)
+	}
+
+	return h.domains.byHost(req.Host), nil
+}
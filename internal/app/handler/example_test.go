@@ -21,7 +21,7 @@ func ExampleHandler_APIShortenHandler() {
 		BaseShortURLAddress: "http://localhost",
 	}
 
-	handler := handler.NewHandler(defaultStorage, config)
+	handler := handler.NewHandler(defaultStorage, config, nil)
 
 	recorder := httptest.NewRecorder()
 
@@ -41,7 +41,7 @@ func ExampleHandler_PostHandler() {
 		BaseShortURLAddress: "http://localhost",
 	}
 
-	handler := handler.NewHandler(defaultStorage, config)
+	handler := handler.NewHandler(defaultStorage, config, nil)
 
 	recorder := httptest.NewRecorder()
 
@@ -61,7 +61,7 @@ func ExampleHandler_GetHandler() {
 		BaseShortURLAddress: "http://localhost",
 	}
 
-	handler := handler.NewHandler(defaultStorage, config)
+	handler := handler.NewHandler(defaultStorage, config, nil)
 
 	recorder := httptest.NewRecorder()
 
@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/VladKvetkin/shortener/internal/app/entities"
+	"github.com/VladKvetkin/shortener/internal/app/middleware"
+	"github.com/VladKvetkin/shortener/internal/app/models"
+	"github.com/VladKvetkin/shortener/internal/app/storage"
+)
+
+const (
+	exportFormatNDJSON = "ndjson"
+	exportFormatCSV    = "csv"
+
+	// exportFlushEvery - количество строк выгрузки, после которого ответ отправляется клиенту.
+	exportFlushEvery = 1000
+)
+
+// exportCSVHeader - заголовок CSV-выгрузки. Теги записываются в одну ячейку через запятую,
+// параметры по умолчанию - в одну ячейку в виде строки запроса, варианты - в одну ячейку в формате JSON.
+// Срок действия бессрочной ссылки - пустая ячейка.
+var exportCSVHeader = []string{
+	"short_url", "original_url", "is_deleted", "created_at", "updated_at",
+	"title", "tags", "notes", "redirect_status", "query_mode", "default_query", "targets", "expires_at",
+}
+
+// exportWriter - интерфейс записи строк выгрузки в одном из форматов.
+type exportWriter interface {
+	Write(models.APIUserURLExportRecord) error
+	Flush() error
+}
+
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonExportWriter) Write(record models.APIUserURLExportRecord) error {
+	return w.encoder.Encode(record)
+}
+
+func (w *ndjsonExportWriter) Flush() error {
+	return nil
+}
+
+type csvExportWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (w *csvExportWriter) Write(record models.APIUserURLExportRecord) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	return w.writer.Write([]string{
+		record.ShortURL,
+		record.OriginalURL,
+		strconv.FormatBool(record.DeletedFlag),
+		record.CreatedAt.Format(time.RFC3339Nano),
+		record.UpdatedAt.Format(time.RFC3339Nano),
+		record.Title,
+		strings.Join(record.Tags, ","),
+		record.Notes,
+		formatRedirectStatus(record.RedirectStatus),
+		record.QueryMode,
+		encodeDefaultQuery(record.DefaultQuery),
+		formatTargets(record.Targets),
+		formatExpiresAt(record.ExpiresAt),
+	})
+}
+
+func formatRedirectStatus(status int) string {
+	if status == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(status)
+}
+
+func formatExpiresAt(expiresAt *time.Time) string {
+	if expiresAt == nil {
+		return ""
+	}
+
+	return expiresAt.Format(time.RFC3339Nano)
+}
+
+// formatTargets кодирует варианты ссылки в JSON для одной ячейки CSV.
+func formatTargets(targets []entities.Target) string {
+	if len(targets) == 0 {
+		return ""
+	}
+
+	data, _ := json.Marshal(targets)
+
+	return string(data)
+}
+
+// Flush отправляет записанные строки. Если строк не было, то выгрузка состоит только из заголовка.
+func (w *csvExportWriter) Flush() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// writeHeader записывает заголовок CSV перед первой строкой выгрузки.
+func (w *csvExportWriter) writeHeader() error {
+	if w.headerWritten {
+		return nil
+	}
+
+	if err := w.writer.Write(exportCSVHeader); err != nil {
+		return err
+	}
+
+	w.headerWritten = true
+
+	return nil
+}
+
+// ExportUserURLsHandler – функция-обработчик, которая выгружает все сокращенные ссылки пользователя, включая удаленные,
+// в формате NDJSON или CSV (параметр format). Строки читаются из базы данных по одной и сразу отправляются клиенту.
+func (h *Handler) ExportUserURLsHandler(res http.ResponseWriter, req *http.Request) {
+	userID, ok := req.Context().Value(middleware.UserIDKey{}).(string)
+	if !ok {
+		http.Error(res, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatNDJSON
+	}
+
+	var writer exportWriter
+
+	switch format {
+	case exportFormatNDJSON:
+		res.Header().Set("Content-Type", "application/x-ndjson")
+		writer = &ndjsonExportWriter{encoder: json.NewEncoder(res)}
+	case exportFormatCSV:
+		res.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writer = &csvExportWriter{writer: csv.NewWriter(res)}
+	default:
+		http.Error(res, "Unsupported export format", http.StatusBadRequest)
+		return
+	}
+
+	res.Header().Set("Content-Disposition", `attachment; filename="urls.`+format+`"`)
+
+	responseController := http.NewResponseController(res)
+	if err := responseController.SetWriteDeadline(time.Time{}); err != nil {
+		zap.L().Sugar().Debugw(
+			"Cannot disable write deadline for export",
+			"err", err,
+		)
+	}
+
+	res.WriteHeader(http.StatusOK)
+
+	rowsCount := 0
+
+	err := h.storage.IterateUserURLs(
+		req.Context(),
+		storage.UserURLsQuery{
+			UserID:         userID,
+			IncludeDeleted: true,
+		},
+		func(url entities.URL) error {
+			if err := writer.Write(exportRecord(url, h.formatShortURL(url.Domain, url.ShortURL))); err != nil {
+				return err
+			}
+
+			rowsCount++
+			if rowsCount%exportFlushEvery != 0 {
+				return nil
+			}
+
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+
+			return responseController.Flush()
+		},
+	)
+
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if err != nil {
+		zap.L().Sugar().Errorw(
+			"Cannot export user urls",
+			"err", err,
+			"user_id", userID,
+			"rows", rowsCount,
+		)
+	}
+}
+
+func exportRecord(url entities.URL, shortURL string) models.APIUserURLExportRecord {
+	return models.APIUserURLExportRecord{
+		ShortURL:    shortURL,
+		OriginalURL: url.OriginalURL,
+		DeletedFlag: url.DeletedFlag,
+		CreatedAt:   url.CreatedAt,
+		UpdatedAt:   url.UpdatedAt,
+		URLMetadata: userURLMetadata(url),
+	}
+}
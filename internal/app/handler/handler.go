@@ -7,41 +7,91 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-chi/chi"
+	"go.uber.org/zap"
 
 	"github.com/VladKvetkin/shortener/internal/app/config"
 	"github.com/VladKvetkin/shortener/internal/app/entities"
 	"github.com/VladKvetkin/shortener/internal/app/middleware"
 	"github.com/VladKvetkin/shortener/internal/app/models"
+	"github.com/VladKvetkin/shortener/internal/app/policy"
 	"github.com/VladKvetkin/shortener/internal/app/shortener"
 	"github.com/VladKvetkin/shortener/internal/app/storage"
+	"github.com/VladKvetkin/shortener/internal/app/urlnormalizer"
 )
 
 var (
 	// ErrOriginalURLAlreadyExists - ошибка, которая означает, что оригинальный URL уже существует в базе данных.
 	ErrOriginalURLAlreadyExists = errors.New("original URL already exists")
+	// ErrCannotCreateID - ошибка, которая означает, что не удалось подобрать свободную сокращенную ссылку.
+	ErrCannotCreateID = errors.New("cannot create unique id")
 )
 
+// maxCreateIDAttempts - количество попыток подобрать свободную сокращенную ссылку.
+// Коллизия возможна, если сокращенная ссылка была перенаправлена на другую оригинальную ссылку.
+const maxCreateIDAttempts = 10
+
+// maxBatchAttempts - количество попыток сохранить пачку ссылок, если параллельный запрос успел занять
+// ее оригинальные или сокращенные ссылки.
+const maxBatchAttempts = 3
+
 // Handler - структура обработчика HTTP-запросов.
 type Handler struct {
 	storage      storage.Storage
 	config       config.Config
+	normalizer   *urlnormalizer.Normalizer
+	policy       *policy.Engine
+	domains      *domainRegistry
+	pages        map[string]*template.Template
 	DeleteUrlsWg sync.WaitGroup
+	// ClicksWg - группа фоновых записей переходов, которую нужно дождаться при остановке сервера.
+	ClicksWg sync.WaitGroup
+}
+
+// APIKeyStore - функция, которая возвращает хранилище ключей API для middleware.APIKey.
+func (h *Handler) APIKeyStore() middleware.APIKeyStore {
+	return h.storage
+}
+
+// SessionStore - функция, которая возвращает хранилище сессий для middleware.JWTCookie.
+func (h *Handler) SessionStore() middleware.SessionStore {
+	return sessionStore{h}
 }
 
 // NewHandler – конструктор Handler.
-func NewHandler(storage storage.Storage, config config.Config) *Handler {
+// Если policy равен nil, то домены оригинальных ссылок не проверяются.
+// Если шаблоны страниц не удалось загрузить, то используются встроенные.
+func NewHandler(storage storage.Storage, config config.Config, policy *policy.Engine) *Handler {
+	pages, err := loadPages(config.TemplatesDir)
+	if err != nil {
+		zap.L().Sugar().Errorw(
+			"Cannot load page templates",
+			"err", err,
+			"dir", config.TemplatesDir,
+		)
+
+		pages = defaultPages()
+	}
+
 	return &Handler{
-		config:  config,
-		storage: storage,
+		config:     config,
+		storage:    storage,
+		normalizer: urlnormalizer.NewNormalizer(config.AllowedSchemes),
+		policy:     policy,
+		domains:    newDomainRegistry(config),
+		pages:      pages,
 	}
 }
 
 // DeleteUserUrlsHandler – функция-обработчик, которая удаляет сокращенные ссылки пользователя.
+// Ссылки удаляются в домене из параметра domain или в домене, на который пришел запрос.
 func (h *Handler) DeleteUserUrlsHandler(res http.ResponseWriter, req *http.Request) {
 	var requestModel models.APIUserDeleteURLRequest
 
@@ -51,6 +101,12 @@ func (h *Handler) DeleteUserUrlsHandler(res http.ResponseWriter, req *http.Reque
 		return
 	}
 
+	domain, err := h.requestDomain(req)
+	if err != nil {
+		http.Error(res, "Unknown domain", http.StatusBadRequest)
+		return
+	}
+
 	jsonDecoder := json.NewDecoder(req.Body)
 
 	if err := jsonDecoder.Decode(&requestModel); err != nil {
@@ -74,7 +130,7 @@ func (h *Handler) DeleteUserUrlsHandler(res http.ResponseWriter, req *http.Reque
 		case <-ctx.Done():
 			return
 		default:
-			h.storage.DeleteBatch(ctx, requestModel, userID)
+			h.storage.DeleteBatch(ctx, domain.key, requestModel, userID)
 			return
 		}
 	}(ctx)
@@ -83,9 +139,9 @@ func (h *Handler) DeleteUserUrlsHandler(res http.ResponseWriter, req *http.Reque
 }
 
 // GetUserUrlsHandler – функция-обработчик, которая возвращает сокращенные и оригинальные ссылки пользователя в формате JSON.
+// Ссылки отдаются постранично, ссылка на следующую страницу передается в заголовке Link.
 func (h *Handler) GetUserUrlsHandler(res http.ResponseWriter, req *http.Request) {
-	_, err := req.Cookie(middleware.TokenCookieName)
-	if err != nil {
+	if !middleware.HasCredentials(req) {
 		res.WriteHeader(http.StatusNoContent)
 		return
 	}
@@ -96,7 +152,16 @@ func (h *Handler) GetUserUrlsHandler(res http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	userURLs, err := h.storage.GetUserURLs(req.Context(), userID)
+	query, err := parseUserURLsQuery(req.URL.Query(), userID)
+	if err != nil {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	limit := query.Limit
+	query.Limit++
+
+	userURLs, err := h.storage.GetUserURLsPage(req.Context(), query)
 	if err != nil {
 		http.Error(res, "Invalid request", http.StatusBadRequest)
 		return
@@ -107,13 +172,215 @@ func (h *Handler) GetUserUrlsHandler(res http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	if len(userURLs) > limit {
+		userURLs = userURLs[:limit]
+
+		lastURL := userURLs[len(userURLs)-1]
+		res.Header().Set("Link", nextPageLink(req.URL, storage.Cursor{
+			CreatedAt: lastURL.CreatedAt,
+			ShortURL:  lastURL.ShortURL,
+			Domain:    lastURL.Domain,
+		}))
+	}
+
 	responseModel := make([]models.APIUserURLResponse, 0, len(userURLs))
 	for _, userURL := range userURLs {
 		responseModel = append(
 			responseModel,
-			models.APIUserURLResponse{
-				ShortURL:    h.formatShortURL(userURL.ShortURL),
-				OriginalURL: userURL.OriginalURL,
+			h.userURLResponse(userURL),
+		)
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+
+	jsonEncoder := json.NewEncoder(res)
+	if err := jsonEncoder.Encode(responseModel); err != nil {
+		http.Error(res, "Cannot encode response JSON body", http.StatusInternalServerError)
+		return
+	}
+}
+
+// UpdateUserURLHandler – функция-обработчик, которая меняет оригинальную ссылку у сокращенной ссылки пользователя.
+// Предыдущая оригинальная ссылка сохраняется в истории изменений.
+func (h *Handler) UpdateUserURLHandler(res http.ResponseWriter, req *http.Request) {
+	var requestModel models.APIUserUpdateURLRequest
+
+	id := chi.URLParam(req, "id")
+	if id == "" {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := req.Context().Value(middleware.UserIDKey{}).(string)
+	if !ok {
+		http.Error(res, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	domain, err := h.requestDomain(req)
+	if err != nil {
+		http.Error(res, "Unknown domain", http.StatusBadRequest)
+		return
+	}
+
+	jsonDecoder := json.NewDecoder(req.Body)
+
+	if err := jsonDecoder.Decode(&requestModel); err != nil {
+		http.Error(res, "Cannot decode request JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if requestModel.URL == "" {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	originalURL, err := h.prepareOriginalURL(requestModel.URL)
+	if err != nil {
+		h.sendJSONError(res, err, "")
+		return
+	}
+
+	err = h.storage.UpdateOriginalURL(req.Context(), domain.key, id, userID, originalURL)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrIDNotExists):
+			http.Error(res, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		case errors.Is(err, storage.ErrURLNotOwned):
+			http.Error(res, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		case errors.Is(err, storage.ErrURLDeleted):
+			http.Error(res, http.StatusText(http.StatusGone), http.StatusGone)
+		case errors.Is(err, storage.ErrOriginalURLExists):
+			http.Error(res, "Original URL already exists", http.StatusConflict)
+		default:
+			http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	url, err := h.storage.ReadByID(req.Context(), domain.key, id)
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	responseModel := h.userURLResponse(url)
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+
+	jsonEncoder := json.NewEncoder(res)
+	if err := jsonEncoder.Encode(responseModel); err != nil {
+		http.Error(res, "Cannot encode response JSON body", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetUserURLHistoryHandler – функция-обработчик, которая возвращает историю изменений оригинальной ссылки
+// у сокращенной ссылки пользователя в формате JSON.
+func (h *Handler) GetUserURLHistoryHandler(res http.ResponseWriter, req *http.Request) {
+	id := chi.URLParam(req, "id")
+	if id == "" {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := req.Context().Value(middleware.UserIDKey{}).(string)
+	if !ok {
+		http.Error(res, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	domain, err := h.requestDomain(req)
+	if err != nil {
+		http.Error(res, "Unknown domain", http.StatusBadRequest)
+		return
+	}
+
+	url, err := h.storage.ReadByID(req.Context(), domain.key, id)
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	if url.UserID != userID {
+		http.Error(res, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	history, err := h.storage.GetURLHistory(req.Context(), domain.key, id)
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	responseModel := make([]models.APIUserURLHistoryResponse, 0, len(history))
+	for _, item := range history {
+		responseModel = append(
+			responseModel,
+			models.APIUserURLHistoryResponse{
+				OriginalURL: item.OriginalURL,
+				ChangedAt:   item.ChangedAt,
+			},
+		)
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+
+	jsonEncoder := json.NewEncoder(res)
+	if err := jsonEncoder.Encode(responseModel); err != nil {
+		http.Error(res, "Cannot encode response JSON body", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetUserURLClicksHandler – функция-обработчик, которая возвращает количество переходов по сокращенной ссылке
+// пользователя в разрезе вариантов в формате JSON.
+func (h *Handler) GetUserURLClicksHandler(res http.ResponseWriter, req *http.Request) {
+	id := chi.URLParam(req, "id")
+	if id == "" {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := req.Context().Value(middleware.UserIDKey{}).(string)
+	if !ok {
+		http.Error(res, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	domain, err := h.requestDomain(req)
+	if err != nil {
+		http.Error(res, "Unknown domain", http.StatusBadRequest)
+		return
+	}
+
+	url, err := h.storage.ReadByID(req.Context(), domain.key, id)
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	if url.UserID != userID {
+		http.Error(res, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	stats, err := h.storage.GetClickStats(req.Context(), domain.key, id)
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	responseModel := make([]models.APIUserURLClicksResponse, 0, len(stats))
+	for _, stat := range stats {
+		responseModel = append(
+			responseModel,
+			models.APIUserURLClicksResponse{
+				Variant: stat.Variant,
+				Count:   stat.Count,
 			},
 		)
 	}
@@ -141,26 +408,61 @@ func (h *Handler) PingHandler(res http.ResponseWriter, req *http.Request) {
 }
 
 // GetHandler – функция-обработчик, которая перенаправляет клиента по оригинальной ссылке, используя сокращенную ссылку.
+// Для ссылок, помеченных администратором или политикой, вместо перенаправления отдается страница-предупреждение.
+// Если сокращенная ссылка заканчивается на "+" или передан параметр preview=1, то отдается страница предпросмотра.
+// Код ответа берется из ссылки или из конфигурации, обработчик также отвечает на HEAD-запросы.
+// Если у ссылки есть варианты, то клиент перенаправляется на вариант, выбранный по устройству и весам.
+// Ссылка ищется в домене, на который пришел запрос. Если ее нет, а у домена задана страница по умолчанию,
+// то клиент перенаправляется на эту страницу.
 func (h *Handler) GetHandler(res http.ResponseWriter, req *http.Request) {
 	id := chi.URLParam(req, "id")
-	if id == "" {
-		http.Error(res, "Invalid request", http.StatusBadRequest)
+
+	if strings.HasSuffix(id, previewSuffix) || req.URL.Query().Get("preview") == "1" {
+		h.previewURL(res, req, h.domains.byHost(req.Host), strings.TrimSuffix(id, previewSuffix))
 		return
 	}
 
-	url, err := h.storage.ReadByID(req.Context(), id)
+	domain := h.domains.byHost(req.Host)
+
+	url, decision, err := h.resolveURL(req.Context(), domain.key, id)
 	if err != nil {
-		http.Error(res, "Invalid request", http.StatusBadRequest)
+		if errors.Is(err, storage.ErrIDNotExists) && domain.fallbackURL != "" {
+			res.Header().Set("Cache-Control", "no-store")
+			http.Redirect(res, req, domain.fallbackURL, http.StatusFound)
+			return
+		}
+
+		h.sendResolveError(res, req, id, err)
 		return
 	}
 
-	if url.DeletedFlag {
-		res.WriteHeader(http.StatusGone)
+	device := deviceFromUserAgent(req.UserAgent())
+	variant := ""
+
+	if target, ok := h.selectTarget(res, req, url, device); ok {
+		decision, err = h.policy.EvaluateURL(target.URL)
+		if err != nil || decision.Action == policy.ActionBlock {
+			h.sendResolveError(res, req, id, &policy.BlockedError{Rule: decision.Rule})
+			return
+		}
+
+		url.OriginalURL = target.URL
+		variant = target.Name
+	}
+
+	location := destinationURL(url, req.URL.Query())
+
+	if url.FlaggedFlag || decision.Action == policy.ActionFlag {
+		h.sendWarningPage(res, location)
 		return
 	}
 
-	res.Header().Set("Location", url.OriginalURL)
-	res.WriteHeader(http.StatusTemporaryRedirect)
+	// Переходом считается только перенаправление по GET: HEAD-запросы и показ предупреждения переходами не являются.
+	if req.Method == http.MethodGet {
+		h.recordClick(newClick(url, variant, device))
+	}
+
+	h.sendRedirect(res, url, location)
 }
 
 // PostHandler – функция-обработчик, которая добавляет в базу данных новую сокращенную ссылку.
@@ -185,12 +487,28 @@ func (h *Handler) PostHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	id, err := h.createAndAddID(req.Context(), stringBody, userID)
+	domain, err := h.requestDomain(req)
+	if err != nil {
+		http.Error(res, "Unknown domain", http.StatusBadRequest)
+		return
+	}
+
+	originalURL, err := h.prepareOriginalURL(stringBody)
+	if err != nil {
+		h.sendJSONError(res, err, "")
+		return
+	}
+
+	id, err := h.createAndAddID(req.Context(), entities.URL{
+		OriginalURL: originalURL,
+		Domain:      domain.key,
+		UserID:      userID,
+	})
 	if err != nil {
 		if errors.Is(err, ErrOriginalURLAlreadyExists) {
 			res.Header().Set("Content-type", "text/plain")
 			res.WriteHeader(http.StatusConflict)
-			res.Write([]byte(h.formatShortURL(id)))
+			res.Write([]byte(h.formatShortURL(domain.key, id)))
 			return
 		}
 
@@ -200,10 +518,12 @@ func (h *Handler) PostHandler(res http.ResponseWriter, req *http.Request) {
 
 	res.Header().Set("Content-type", "text/plain")
 	res.WriteHeader(http.StatusCreated)
-	res.Write([]byte(h.formatShortURL(id)))
+	res.Write([]byte(h.formatShortURL(domain.key, id)))
 }
 
 // APIShortenBatchHandler – функция-обработчик, которая добавляет в базу данных массив сокращенных ссылок.
+// Для оригинальных ссылок, которые уже сокращены, возвращаются существующие сокращенные ссылки с признаком conflict,
+// а их владелец и состояние не меняются. Если новых ссылок в массиве нет, то возвращается http.StatusConflict.
 func (h *Handler) APIShortenBatchHandler(res http.ResponseWriter, req *http.Request) {
 	var requestModel []models.APIShortenBatchRequest
 
@@ -220,42 +540,67 @@ func (h *Handler) APIShortenBatchHandler(res http.ResponseWriter, req *http.Requ
 		return
 	}
 
+	domain, err := h.requestDomain(req)
+	if err != nil {
+		http.Error(res, "Unknown domain", http.StatusBadRequest)
+		return
+	}
+
+	withQR := wantQR(req)
+
 	urls := make([]entities.URL, 0, len(requestModel))
-	responseModel := make([]models.APIShortenBatchResponse, 0, len(requestModel))
+	originalURLs := make([]string, 0, len(requestModel))
 
 	for _, batchData := range requestModel {
-		shortURL, err := shortener.CreateID(batchData.OriginalURL)
+		originalURL, err := h.prepareOriginalURL(batchData.OriginalURL)
 		if err != nil {
-			http.Error(res, "Invalid request", http.StatusBadRequest)
+			h.sendJSONError(res, err, batchData.CorrelationID)
 			return
 		}
 
-		urls = append(
-			urls,
-			entities.URL{
-				OriginalURL: batchData.OriginalURL,
-				ShortURL:    shortURL,
-				UserID:      userID,
-			},
-		)
+		url := entities.URL{
+			OriginalURL: originalURL,
+			Domain:      domain.key,
+			UserID:      userID,
+		}
 
-		responseModel = append(
-			responseModel,
-			models.APIShortenBatchResponse{
-				CorrelationID: batchData.CorrelationID,
-				ShortURL:      h.formatShortURL(shortURL),
-			},
-		)
+		if err := h.applyMetadata(&url, batchData.URLMetadata); err != nil {
+			http.Error(res, "Invalid metadata", http.StatusBadRequest)
+			return
+		}
+
+		urls = append(urls, url)
+		originalURLs = append(originalURLs, originalURL)
 	}
 
-	err := h.storage.AddBatch(req.Context(), urls)
+	conflicts, created, err := h.shortenBatch(req.Context(), domain.key, urls, originalURLs)
 	if err != nil {
 		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
+	responseModel := make([]models.APIShortenBatchResponse, 0, len(urls))
+	for i, batchData := range requestModel {
+		batchResponse := models.APIShortenBatchResponse{
+			CorrelationID: batchData.CorrelationID,
+			ShortURL:      h.formatShortURL(domain.key, urls[i].ShortURL),
+			Conflict:      conflicts[i],
+		}
+
+		if withQR {
+			batchResponse.QR = h.formatQRURL(domain.key, urls[i].ShortURL)
+		}
+
+		responseModel = append(responseModel, batchResponse)
+	}
+
+	httpStatus := http.StatusCreated
+	if created == 0 && len(urls) > 0 {
+		httpStatus = http.StatusConflict
+	}
+
 	res.Header().Set("Content-Type", "application/json")
-	res.WriteHeader(http.StatusCreated)
+	res.WriteHeader(httpStatus)
 
 	jsonEncoder := json.NewEncoder(res)
 	if err := jsonEncoder.Encode(responseModel); err != nil {
@@ -264,6 +609,73 @@ func (h *Handler) APIShortenBatchHandler(res http.ResponseWriter, req *http.Requ
 	}
 }
 
+// shortenBatch - функция, которая подбирает сокращенные ссылки для urls в домене domain и сохраняет новые ссылки.
+// Возвращает признаки conflict для ссылок, которые уже были сокращены, и количество сохраненных ссылок.
+// Если параллельный запрос успел сохранить те же оригинальные или сокращенные ссылки, то пачка подбирается заново.
+func (h *Handler) shortenBatch(ctx context.Context, domain string, urls []entities.URL, originalURLs []string) ([]bool, int, error) {
+	for attempt := 1; ; attempt++ {
+		conflicts, newURLs, err := h.prepareBatch(ctx, domain, urls, originalURLs)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if len(newURLs) == 0 {
+			return conflicts, 0, nil
+		}
+
+		err = h.storage.AddBatch(ctx, newURLs)
+		if err == nil {
+			return conflicts, len(newURLs), nil
+		}
+
+		if attempt >= maxBatchAttempts || !errors.Is(err, storage.ErrOriginalURLExists) && !errors.Is(err, storage.ErrIDExists) {
+			return nil, 0, err
+		}
+	}
+}
+
+// prepareBatch записывает в urls существующие или новые сокращенные ссылки и возвращает признаки conflict
+// и ссылки, которые нужно сохранить.
+func (h *Handler) prepareBatch(ctx context.Context, domain string, urls []entities.URL, originalURLs []string) ([]bool, []entities.URL, error) {
+	existingURLs, err := h.storage.ReadByOriginalURLs(ctx, domain, originalURLs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// shortURLs хранит сокращенные ссылки оригинальных ссылок, которые уже есть в базе данных или выше в этом массиве.
+	shortURLs := make(map[string]string, len(urls))
+	for _, url := range existingURLs {
+		shortURLs[url.OriginalURL] = url.ShortURL
+	}
+
+	// takenIDs хранит сокращенные ссылки, выбранные для новых ссылок этого массива.
+	takenIDs := make(map[string]struct{}, len(urls))
+	newURLs := make([]entities.URL, 0, len(urls))
+	conflicts := make([]bool, len(urls))
+
+	for i := range urls {
+		if shortURL, ok := shortURLs[urls[i].OriginalURL]; ok {
+			_, created := takenIDs[shortURL]
+
+			urls[i].ShortURL = shortURL
+			conflicts[i] = !created
+			continue
+		}
+
+		id, err := h.createUniqueID(ctx, domain, urls[i].OriginalURL, takenIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		urls[i].ShortURL = id
+		takenIDs[id] = struct{}{}
+		shortURLs[urls[i].OriginalURL] = id
+		newURLs = append(newURLs, urls[i])
+	}
+
+	return conflicts, newURLs, nil
+}
+
 // APIShortenBatchHandler – функция-обработчик, которая добавляет в базу данных сокращенную ссылку.
 // Отличие от PostHandler заключается в том, что в HTTP-запросе ожидается JSON с оригинальной ссылкой.
 func (h *Handler) APIShortenHandler(res http.ResponseWriter, req *http.Request) {
@@ -287,10 +699,37 @@ func (h *Handler) APIShortenHandler(res http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	id, err := h.createAndAddID(req.Context(), requestModel.URL, userID)
+	domain, err := h.requestDomain(req)
+	if requestModel.Domain != "" {
+		domain, err = h.domains.byName(requestModel.Domain)
+	}
+
+	if err != nil {
+		http.Error(res, "Unknown domain", http.StatusBadRequest)
+		return
+	}
+
+	originalURL, err := h.prepareOriginalURL(requestModel.URL)
+	if err != nil {
+		h.sendJSONError(res, err, "")
+		return
+	}
+
+	url := entities.URL{
+		OriginalURL: originalURL,
+		Domain:      domain.key,
+		UserID:      userID,
+	}
+
+	if err := h.applyMetadata(&url, requestModel.URLMetadata); err != nil {
+		http.Error(res, "Invalid metadata", http.StatusBadRequest)
+		return
+	}
+
+	id, err := h.createAndAddID(req.Context(), url)
 	if err != nil {
 		if errors.Is(err, ErrOriginalURLAlreadyExists) {
-			h.sendJSONShortURL(res, id, http.StatusConflict)
+			h.sendJSONShortURL(res, domain.key, id, http.StatusConflict, wantQR(req))
 			return
 		}
 
@@ -298,42 +737,188 @@ func (h *Handler) APIShortenHandler(res http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	h.sendJSONShortURL(res, id, http.StatusCreated)
+	h.sendJSONShortURL(res, domain.key, id, http.StatusCreated, wantQR(req))
+}
+
+// resolveURL - функция, которая находит сокращенную ссылку и проверяет, можно ли по ней перейти.
+// Возвращает ErrURLDeleted, если ссылка удалена, ErrURLExpired, если истек ее срок действия,
+// и *policy.BlockedError, если домен заблокирован.
+// Перенаправление и предпросмотр используют ее, чтобы одинаково обрабатывать состояния ссылки.
+func (h *Handler) resolveURL(ctx context.Context, domain string, id string) (entities.URL, policy.Decision, error) {
+	if id == "" {
+		return entities.URL{}, policy.Decision{}, storage.ErrIDNotExists
+	}
+
+	url, err := h.storage.ReadByID(ctx, domain, id)
+	if err != nil {
+		return entities.URL{}, policy.Decision{}, err
+	}
+
+	if url.DeletedFlag {
+		return entities.URL{}, policy.Decision{}, storage.ErrURLDeleted
+	}
+
+	if url.DisabledFlag {
+		return entities.URL{}, policy.Decision{}, storage.ErrURLDisabled
+	}
+
+	if url.Expired(time.Now()) {
+		return entities.URL{}, policy.Decision{}, storage.ErrURLExpired
+	}
+
+	decision, err := h.policy.EvaluateURL(url.OriginalURL)
+	if err != nil || decision.Action == policy.ActionBlock {
+		return entities.URL{}, policy.Decision{}, &policy.BlockedError{Rule: decision.Rule}
+	}
+
+	return url, decision, nil
 }
 
-func (h *Handler) formatShortURL(id string) string {
-	return fmt.Sprintf("%s/%s", h.config.BaseShortURLAddress, id)
+// sendResolveError отвечает ошибкой, которую нельзя кешировать: ссылку могут создать, восстановить или разблокировать.
+func (h *Handler) sendResolveError(res http.ResponseWriter, req *http.Request, id string, err error) {
+	var blockedErr *policy.BlockedError
+
+	res.Header().Set("Cache-Control", "no-store")
+
+	switch {
+	case errors.Is(err, storage.ErrIDNotExists):
+		h.sendErrorPage(res, req, pageNotFound, pageData{
+			Status:  http.StatusNotFound,
+			Title:   "Link not found",
+			Message: "The short link you followed does not exist.",
+			ID:      id,
+		})
+	case errors.Is(err, storage.ErrURLDeleted):
+		h.sendErrorPage(res, req, pageGone, pageData{
+			Status:  http.StatusGone,
+			Title:   "Link deleted",
+			Message: "The short link you followed has been deleted.",
+			ID:      id,
+		})
+	case errors.Is(err, storage.ErrURLExpired):
+		h.sendErrorPage(res, req, pageExpired, pageData{
+			Status:  http.StatusGone,
+			Title:   "Link expired",
+			Message: "The short link you followed has expired.",
+			ID:      id,
+		})
+	case errors.Is(err, storage.ErrURLDisabled):
+		h.sendErrorPage(res, req, pageBlocked, pageData{
+			Status:  http.StatusForbidden,
+			Title:   "Link disabled",
+			Message: "The short link you followed has been disabled by the administrator.",
+			ID:      id,
+		})
+	case errors.As(err, &blockedErr):
+		h.sendErrorPage(res, req, pageBlocked, pageData{
+			Status:  http.StatusForbidden,
+			Title:   "Destination is blocked",
+			Message: "The destination of this short link is blocked.",
+			ID:      id,
+		})
+	default:
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
 }
 
-func (h *Handler) createAndAddID(ctx context.Context, URL string, userID string) (string, error) {
-	id, err := shortener.CreateID(URL)
+// formatShortURL - функция, которая возвращает сокращенную ссылку в домене с ключом domain.
+func (h *Handler) formatShortURL(domain string, id string) string {
+	return fmt.Sprintf("%s/%s", h.domains.byKey(domain).baseURL, id)
+}
+
+func (h *Handler) userURLResponse(url entities.URL) models.APIUserURLResponse {
+	return models.APIUserURLResponse{
+		ShortURL:    h.formatShortURL(url.Domain, url.ShortURL),
+		OriginalURL: url.OriginalURL,
+		DeletedFlag: url.DeletedFlag,
+		CreatedAt:   url.CreatedAt,
+		URLMetadata: userURLMetadata(url),
+	}
+}
+
+// prepareOriginalURL - функция, которая нормализует оригинальную ссылку и проверяет ее домен по политике.
+func (h *Handler) prepareOriginalURL(rawURL string) (string, error) {
+	originalURL, err := h.normalizer.Normalize(rawURL)
 	if err != nil {
 		return "", err
 	}
 
-	if _, err := h.storage.ReadByID(ctx, id); err != nil {
-		if errors.Is(err, storage.ErrIDNotExists) {
-			err := h.storage.Add(entities.URL{
-				ShortURL:    id,
-				OriginalURL: URL,
-				UserID:      userID,
-			})
-			if err != nil {
-				return "", err
+	if err := h.policy.Check(originalURL); err != nil {
+		return "", err
+	}
+
+	return originalURL, nil
+}
+
+func (h *Handler) createAndAddID(ctx context.Context, url entities.URL) (string, error) {
+	existingURL, err := h.storage.ReadByOriginalURL(ctx, url.Domain, url.OriginalURL)
+	if err == nil {
+		return existingURL.ShortURL, ErrOriginalURLAlreadyExists
+	}
+
+	if !errors.Is(err, storage.ErrIDNotExists) {
+		return "", err
+	}
+
+	id, err := h.createUniqueID(ctx, url.Domain, url.OriginalURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	url.ShortURL = id
+
+	if err := h.storage.Add(url); err != nil {
+		if errors.Is(err, storage.ErrOriginalURLExists) {
+			existingURL, readErr := h.storage.ReadByOriginalURL(ctx, url.Domain, url.OriginalURL)
+			if readErr == nil {
+				return existingURL.ShortURL, ErrOriginalURLAlreadyExists
 			}
+		}
+
+		return "", err
+	}
+
+	return id, nil
+}
+
+// createUniqueID подбирает сокращенную ссылку, которой нет в базе данных и в taken:
+// taken хранит сокращенные ссылки, уже выбранные для других ссылок той же пачки.
+func (h *Handler) createUniqueID(ctx context.Context, domain string, URL string, taken map[string]struct{}) (string, error) {
+	for attempt := 0; attempt < maxCreateIDAttempts; attempt++ {
+		source := URL
+		if attempt > 0 {
+			source = fmt.Sprintf("%s#%d", URL, attempt)
+		}
+
+		id, err := shortener.CreateID(source)
+		if err != nil {
+			return "", err
+		}
+
+		if _, ok := taken[id]; ok {
+			continue
+		}
 
+		_, err = h.storage.ReadByID(ctx, domain, id)
+		if errors.Is(err, storage.ErrIDNotExists) {
 			return id, nil
 		}
 
-		return "", err
+		if err != nil {
+			return "", err
+		}
 	}
 
-	return id, ErrOriginalURLAlreadyExists
+	return "", ErrCannotCreateID
 }
 
-func (h *Handler) sendJSONShortURL(res http.ResponseWriter, id string, httpStatus int) {
+func (h *Handler) sendJSONShortURL(res http.ResponseWriter, domain string, id string, httpStatus int, withQR bool) {
 	responseModel := models.APIShortenResponse{
-		Result: h.formatShortURL(id),
+		Result: h.formatShortURL(domain, id),
+	}
+
+	if withQR {
+		responseModel.QR = h.formatQRURL(domain, id)
 	}
 
 	res.Header().Set("Content-Type", "application/json")
@@ -344,3 +929,31 @@ func (h *Handler) sendJSONShortURL(res http.ResponseWriter, id string, httpStatu
 		http.Error(res, "Cannot encode response JSON body", http.StatusInternalServerError)
 	}
 }
+
+// sendJSONError - функция, которая отправляет ошибку проверки ссылки или политики в формате JSON со статусом http.StatusBadRequest.
+// correlationID передается для ошибок в элементах массива ссылок.
+func (h *Handler) sendJSONError(res http.ResponseWriter, err error, correlationID string) {
+	responseModel := models.APIErrorResponse{
+		Code:          "invalid_request",
+		Message:       err.Error(),
+		CorrelationID: correlationID,
+	}
+
+	var validationErr *urlnormalizer.ValidationError
+	if errors.As(err, &validationErr) {
+		responseModel.Code = validationErr.Code
+	}
+
+	var blockedErr *policy.BlockedError
+	if errors.As(err, &blockedErr) {
+		responseModel.Code = "domain_blocked"
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusBadRequest)
+
+	jsonEncoder := json.NewEncoder(res)
+	if err := jsonEncoder.Encode(responseModel); err != nil {
+		http.Error(res, "Cannot encode response JSON body", http.StatusInternalServerError)
+	}
+}
@@ -1,21 +1,38 @@
 package handler_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
 	"io"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/VladKvetkin/shortener/internal/app/auth"
 	"github.com/VladKvetkin/shortener/internal/app/config"
 	"github.com/VladKvetkin/shortener/internal/app/entities"
 	"github.com/VladKvetkin/shortener/internal/app/handler"
+	"github.com/VladKvetkin/shortener/internal/app/middleware"
+	"github.com/VladKvetkin/shortener/internal/app/models"
+	"github.com/VladKvetkin/shortener/internal/app/policy"
+	"github.com/VladKvetkin/shortener/internal/app/ratelimit"
 	"github.com/VladKvetkin/shortener/internal/app/router"
+	"github.com/VladKvetkin/shortener/internal/app/shortener"
 	"github.com/VladKvetkin/shortener/internal/app/storage"
 )
 
@@ -88,6 +105,44 @@ func TestRouterPostHandler(t *testing.T) {
 				body:        regexp.MustCompile(`^http://localhost/.{8}$`),
 			},
 		},
+		{
+			name:    "post request with relative URL",
+			request: "/",
+			method:  http.MethodPost,
+			body:    "/path/to/page",
+			storage: defaultStorage,
+			config: config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			},
+			headers: map[string]string{
+				"Content-Type": "text/plain",
+			},
+			want: want{
+				contentType: "application/json",
+				statusCode:  http.StatusBadRequest,
+				body:        regexp.MustCompile(`^{"code":"not_absolute_url","message":"url must be absolute"}\s*$`),
+			},
+		},
+		{
+			name:    "post request with equivalent URL of existing short URL",
+			request: "/",
+			method:  http.MethodPost,
+			body:    "  HTTPS://Practicum.Yandex.RU:443  ",
+			storage: shortURLAlreadyExistStorage,
+			config: config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			},
+			headers: map[string]string{
+				"Content-Type": "text/plain",
+			},
+			want: want{
+				contentType: "text/plain",
+				statusCode:  http.StatusConflict,
+				body:        regexp.MustCompile(`^http://localhost/QrPnX5IU`),
+			},
+		},
 		{
 			name:    "post request with body short URL already exists",
 			request: "/",
@@ -118,7 +173,7 @@ func TestRouterPostHandler(t *testing.T) {
 			}
 
 			recorder := httptest.NewRecorder()
-			router := router.NewRouter(handler.NewHandler(tt.storage, tt.config))
+			router := router.NewRouter(handler.NewHandler(tt.storage, tt.config, nil))
 
 			router.Router.ServeHTTP(recorder, request)
 
@@ -239,7 +294,7 @@ func BenchmarkRouterPostHandler(b *testing.B) {
 				}
 
 				recorder := httptest.NewRecorder()
-				router := router.NewRouter(handler.NewHandler(tt.storage, tt.config))
+				router := router.NewRouter(handler.NewHandler(tt.storage, tt.config, nil))
 
 				b.StartTimer()
 
@@ -296,9 +351,9 @@ func TestRouterGetHandler(t *testing.T) {
 				"Content-Type": "text/plain",
 			},
 			want: want{
-				statusCode: http.StatusMethodNotAllowed,
+				statusCode: http.StatusOK,
 				location:   "",
-				body:       regexp.MustCompile(`^$`),
+				body:       regexp.MustCompile(`<h1>URL shortener</h1>`),
 			},
 		},
 		{
@@ -314,9 +369,9 @@ func TestRouterGetHandler(t *testing.T) {
 				"Content-Type": "text/plain",
 			},
 			want: want{
-				statusCode: http.StatusBadRequest,
+				statusCode: http.StatusNotFound,
 				location:   "",
-				body:       regexp.MustCompile(`^Invalid request\s*$`),
+				body:       regexp.MustCompile(`<h1>Link not found</h1>`),
 			},
 		},
 		{
@@ -348,7 +403,7 @@ func TestRouterGetHandler(t *testing.T) {
 			}
 
 			recorder := httptest.NewRecorder()
-			router := router.NewRouter(handler.NewHandler(tt.storage, tt.config))
+			router := router.NewRouter(handler.NewHandler(tt.storage, tt.config, nil))
 
 			router.Router.ServeHTTP(recorder, request)
 
@@ -411,9 +466,9 @@ func BenchmarkRouterGetHandler(b *testing.B) {
 				"Content-Type": "text/plain",
 			},
 			want: want{
-				statusCode: http.StatusMethodNotAllowed,
+				statusCode: http.StatusOK,
 				location:   "",
-				body:       regexp.MustCompile(`^$`),
+				body:       regexp.MustCompile(`<h1>URL shortener</h1>`),
 			},
 		},
 		{
@@ -429,9 +484,9 @@ func BenchmarkRouterGetHandler(b *testing.B) {
 				"Content-Type": "text/plain",
 			},
 			want: want{
-				statusCode: http.StatusBadRequest,
+				statusCode: http.StatusNotFound,
 				location:   "",
-				body:       regexp.MustCompile(`^Invalid request\s*$`),
+				body:       regexp.MustCompile(`<h1>Link not found</h1>`),
 			},
 		},
 		{
@@ -465,7 +520,7 @@ func BenchmarkRouterGetHandler(b *testing.B) {
 				}
 
 				recorder := httptest.NewRecorder()
-				router := router.NewRouter(handler.NewHandler(tt.storage, tt.config))
+				router := router.NewRouter(handler.NewHandler(tt.storage, tt.config, nil))
 
 				b.StartTimer()
 
@@ -538,6 +593,83 @@ func TestRouterAPIShortenHandler(t *testing.T) {
 				body:        "Invalid request\n",
 			},
 		},
+		{
+			name:    "post request with javascript URL",
+			request: "/api/shorten",
+			method:  http.MethodPost,
+			storage: defaultStorage,
+			config: config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			},
+			headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+			body: `{"url": "javascript:alert(1)"}`,
+			want: want{
+				statusCode:  http.StatusBadRequest,
+				contentType: "application/json",
+				body: `{"code":"scheme_not_allowed","message":"scheme \"javascript\" is not allowed"}
+`,
+			},
+		},
+		{
+			name:    "post request with too long tag",
+			request: "/api/shorten",
+			method:  http.MethodPost,
+			storage: defaultStorage,
+			config: config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			},
+			headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+			body: `{"url": "https://practicum.yandex.ru", "tags": ["` + strings.Repeat("a", 65) + `"]}`,
+			want: want{
+				statusCode:  http.StatusBadRequest,
+				contentType: "text/plain; charset=utf-8",
+				body:        "Invalid metadata\n",
+			},
+		},
+		{
+			name:    "post request with unsupported redirect status",
+			request: "/api/shorten",
+			method:  http.MethodPost,
+			storage: defaultStorage,
+			config: config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			},
+			headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+			body: `{"url": "https://practicum.yandex.ru", "redirect_status": 303}`,
+			want: want{
+				statusCode:  http.StatusBadRequest,
+				contentType: "text/plain; charset=utf-8",
+				body:        "Invalid metadata\n",
+			},
+		},
+		{
+			name:    "post request with unknown query mode",
+			request: "/api/shorten",
+			method:  http.MethodPost,
+			storage: defaultStorage,
+			config: config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			},
+			headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+			body: `{"url": "https://practicum.yandex.ru", "query_mode": "merge"}`,
+			want: want{
+				statusCode:  http.StatusBadRequest,
+				contentType: "text/plain; charset=utf-8",
+				body:        "Invalid metadata\n",
+			},
+		},
 		{
 			name:    "post request with URL",
 			request: "/api/shorten",
@@ -554,7 +686,7 @@ func TestRouterAPIShortenHandler(t *testing.T) {
 			want: want{
 				statusCode:  http.StatusCreated,
 				contentType: "application/json",
-				body: `{"result":"http://localhost/ipkjUVtE"}
+				body: `{"result":"http://localhost/QrPnX5IU"}
 `,
 			},
 		},
@@ -568,7 +700,7 @@ func TestRouterAPIShortenHandler(t *testing.T) {
 			}
 
 			recorder := httptest.NewRecorder()
-			router := router.NewRouter(handler.NewHandler(tt.storage, tt.config))
+			router := router.NewRouter(handler.NewHandler(tt.storage, tt.config, nil))
 
 			router.Router.ServeHTTP(recorder, request)
 
@@ -663,7 +795,7 @@ func BenchmarkRouterAPIShortenHandler(b *testing.B) {
 			want: want{
 				statusCode:  http.StatusCreated,
 				contentType: "application/json",
-				body: `{"result":"http://localhost/ipkjUVtE"}
+				body: `{"result":"http://localhost/QrPnX5IU"}
 `,
 			},
 		},
@@ -680,7 +812,7 @@ func BenchmarkRouterAPIShortenHandler(b *testing.B) {
 				}
 
 				recorder := httptest.NewRecorder()
-				router := router.NewRouter(handler.NewHandler(tt.storage, tt.config))
+				router := router.NewRouter(handler.NewHandler(tt.storage, tt.config, nil))
 				b.StartTimer()
 
 				router.Router.ServeHTTP(recorder, request)
@@ -703,7 +835,7 @@ func TestRouterDeleteUserUrlsHandler(t *testing.T) {
 	deleteUrls := []string{"6qxTVvsy", "RTfd56hn", "Jlfd67ds"}
 
 	mockStorage := storage.NewMockStorage(ctrl)
-	mockStorage.EXPECT().DeleteBatch(gomock.Any(), deleteUrls, gomock.Any()).Return(nil).MinTimes(0)
+	mockStorage.EXPECT().DeleteBatch(gomock.Any(), "", deleteUrls, gomock.Any()).Return(nil).MinTimes(0)
 
 	tests := []struct {
 		name    string
@@ -776,7 +908,7 @@ func TestRouterDeleteUserUrlsHandler(t *testing.T) {
 			}
 
 			recorder := httptest.NewRecorder()
-			router := router.NewRouter(handler.NewHandler(tt.storage, tt.config))
+			router := router.NewRouter(handler.NewHandler(tt.storage, tt.config, nil))
 
 			router.Router.ServeHTTP(recorder, request)
 
@@ -795,7 +927,7 @@ func BenchmarkRouterDeleteUserUrlsHandler(b *testing.B) {
 	deleteUrls := []string{"6qxTVvsy", "RTfd56hn", "Jlfd67ds"}
 
 	mockStorage := storage.NewMockStorage(ctrl)
-	mockStorage.EXPECT().DeleteBatch(gomock.Any(), deleteUrls, gomock.Any()).Return(nil).MinTimes(0)
+	mockStorage.EXPECT().DeleteBatch(gomock.Any(), "", deleteUrls, gomock.Any()).Return(nil).MinTimes(0)
 
 	tests := []struct {
 		name    string
@@ -861,7 +993,7 @@ func BenchmarkRouterDeleteUserUrlsHandler(b *testing.B) {
 				}
 
 				recorder := httptest.NewRecorder()
-				router := router.NewRouter(handler.NewHandler(tt.storage, tt.config))
+				router := router.NewRouter(handler.NewHandler(tt.storage, tt.config, nil))
 				b.StartTimer()
 
 				router.Router.ServeHTTP(recorder, request)
@@ -872,3 +1004,3018 @@ func BenchmarkRouterDeleteUserUrlsHandler(b *testing.B) {
 		})
 	}
 }
+
+func TestRouterUpdateUserURLHandler(t *testing.T) {
+	type want struct {
+		statusCode int
+		body       string
+	}
+
+	token, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+
+	userID, err := auth.GetUserID(token)
+	require.NoError(t, err)
+
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		OriginalURL: "https://practicum.yandex.ru/",
+		UserID:      userID,
+		CreatedAt:   time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC),
+	})
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "QrPnX5IU",
+		OriginalURL: "https://yandex.ru/",
+		UserID:      "another-user",
+	})
+
+	tests := []struct {
+		name    string
+		request string
+		method  string
+		body    string
+		storage storage.Storage
+		config  config.Config
+		token   string
+		want    want
+	}{
+		{
+			name:    "patch request with short URL, which not in storage",
+			request: "/api/user/urls/notexist",
+			method:  http.MethodPatch,
+			body:    `{"url": "https://practicum.yandex.ru/learn/"}`,
+			storage: defaultStorage,
+			config: config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			},
+			token: token,
+			want: want{
+				statusCode: http.StatusNotFound,
+				body:       "Not Found\n",
+			},
+		},
+		{
+			name:    "patch request with short URL of another user",
+			request: "/api/user/urls/QrPnX5IU",
+			method:  http.MethodPatch,
+			body:    `{"url": "https://practicum.yandex.ru/learn/"}`,
+			storage: defaultStorage,
+			config: config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			},
+			token: token,
+			want: want{
+				statusCode: http.StatusForbidden,
+				body:       "Forbidden\n",
+			},
+		},
+		{
+			name:    "patch request with short URL of user",
+			request: "/api/user/urls/EwHXdJfB",
+			method:  http.MethodPatch,
+			body:    `{"url": "https://practicum.yandex.ru/learn/"}`,
+			storage: defaultStorage,
+			config: config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			},
+			token: token,
+			want: want{
+				statusCode: http.StatusOK,
+				body: `{"short_url":"http://localhost/EwHXdJfB","original_url":"https://practicum.yandex.ru/learn/","created_at":"2023-10-01T00:00:00Z"}
+`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.request, strings.NewReader(tt.body))
+			if tt.token != "" {
+				addSessionCookie(request, tt.token)
+			}
+
+			recorder := httptest.NewRecorder()
+			router := router.NewRouter(handler.NewHandler(tt.storage, tt.config, nil))
+
+			router.Router.ServeHTTP(recorder, request)
+
+			result := recorder.Result()
+
+			assert.Equal(t, tt.want.statusCode, result.StatusCode)
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			err = result.Body.Close()
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want.body, string(body))
+		})
+	}
+
+	history, err := defaultStorage.GetURLHistory(context.Background(), "", "EwHXdJfB")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "https://practicum.yandex.ru/", history[0].OriginalURL)
+
+	url, err := defaultStorage.ReadByOriginalURL(context.Background(), "", "https://practicum.yandex.ru/learn/")
+	require.NoError(t, err)
+	assert.Equal(t, "EwHXdJfB", url.ShortURL)
+}
+
+func TestRouterGetUserUrlsHandler(t *testing.T) {
+	token, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+
+	userID, err := auth.GetUserID(token)
+	require.NoError(t, err)
+
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	createdAt := time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC)
+	for i, originalURL := range []string{"https://practicum.yandex.ru/", "https://yandex.ru/", "https://ya.ru/"} {
+		defaultStorage.Add(entities.URL{
+			ShortURL:    fmt.Sprintf("short%d", i),
+			OriginalURL: originalURL,
+			UserID:      userID,
+			CreatedAt:   createdAt.Add(time.Duration(i) * time.Hour),
+			Tags:        []string{fmt.Sprintf("tag%d", i%2)},
+		})
+	}
+
+	router := router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+		Address:             "localhost:8080",
+		BaseShortURLAddress: "http://localhost",
+	}, nil))
+
+	doRequest := func(target string) (*http.Response, string) {
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		addSessionCookie(request, token)
+
+		recorder := httptest.NewRecorder()
+		router.Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		err = result.Body.Close()
+		require.NoError(t, err)
+
+		return result, string(body)
+	}
+
+	result, body := doRequest("/api/user/urls?limit=2")
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, `[{"short_url":"http://localhost/short2","original_url":"https://ya.ru/","created_at":"2023-10-01T02:00:00Z","tags":["tag0"]},{"short_url":"http://localhost/short1","original_url":"https://yandex.ru/","created_at":"2023-10-01T01:00:00Z","tags":["tag1"]}]
+`, body)
+
+	link := regexp.MustCompile(`^<(.+)>; rel="next"$`).FindStringSubmatch(result.Header.Get("Link"))
+	require.Len(t, link, 2)
+
+	result, body = doRequest(link[1])
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Empty(t, result.Header.Get("Link"))
+	assert.Equal(t, `[{"short_url":"http://localhost/short0","original_url":"https://practicum.yandex.ru/","created_at":"2023-10-01T00:00:00Z","tags":["tag0"]}]
+`, body)
+
+	result, body = doRequest("/api/user/urls?order=asc&search=yandex")
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, `[{"short_url":"http://localhost/short0","original_url":"https://practicum.yandex.ru/","created_at":"2023-10-01T00:00:00Z","tags":["tag0"]},{"short_url":"http://localhost/short1","original_url":"https://yandex.ru/","created_at":"2023-10-01T01:00:00Z","tags":["tag1"]}]
+`, body)
+
+	result, body = doRequest("/api/user/urls?tag=TAG1")
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, `[{"short_url":"http://localhost/short1","original_url":"https://yandex.ru/","created_at":"2023-10-01T01:00:00Z","tags":["tag1"]}]
+`, body)
+
+	result, _ = doRequest("/api/user/urls?limit=0")
+	assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+
+	for _, domain := range []string{"", "go.example.com"} {
+		defaultStorage.Add(entities.URL{
+			ShortURL:    "same",
+			OriginalURL: "https://" + domain + "/same",
+			UserID:      userID,
+			Domain:      domain,
+			CreatedAt:   createdAt.Add(3 * time.Hour),
+		})
+	}
+
+	result, firstPage := doRequest("/api/user/urls?limit=1")
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+
+	link = regexp.MustCompile(`^<(.+)>; rel="next"$`).FindStringSubmatch(result.Header.Get("Link"))
+	require.Len(t, link, 2)
+
+	result, secondPage := doRequest(link[1])
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Contains(t, firstPage, "/same")
+	assert.Contains(t, secondPage, "/same", "links with the same short URL in other domains must not be skipped")
+	assert.NotEqual(t, firstPage, secondPage)
+}
+
+func TestRouterExportUserURLsHandler(t *testing.T) {
+	type want struct {
+		statusCode  int
+		contentType string
+		body        string
+	}
+
+	token, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+
+	userID, err := auth.GetUserID(token)
+	require.NoError(t, err)
+
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	createdAt := time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC)
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		OriginalURL: "https://practicum.yandex.ru/",
+		UserID:      userID,
+		CreatedAt:   createdAt,
+		Title:       "Practicum",
+		Tags:        []string{"go", "courses"},
+		ExpiresAt:   &expiresAt,
+	})
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "QrPnX5IU",
+		OriginalURL: "https://yandex.ru/",
+		UserID:      userID,
+		CreatedAt:   createdAt.Add(time.Hour),
+	})
+	defaultStorage.DeleteBatch(context.Background(), "", []string{"QrPnX5IU"}, userID)
+
+	tests := []struct {
+		name    string
+		request string
+		want    want
+	}{
+		{
+			name:    "export in unknown format",
+			request: "/api/user/urls/export?format=xml",
+			want: want{
+				statusCode:  http.StatusBadRequest,
+				contentType: "text/plain; charset=utf-8",
+				body:        "Unsupported export format\n",
+			},
+		},
+		{
+			name:    "export in csv format",
+			request: "/api/user/urls/export?format=csv",
+			want: want{
+				statusCode:  http.StatusOK,
+				contentType: "text/csv; charset=utf-8",
+				body: "short_url,original_url,is_deleted,created_at,updated_at,title,tags,notes,redirect_status,query_mode,default_query,targets,expires_at\n" +
+					"http://localhost/EwHXdJfB,https://practicum.yandex.ru/,false,2023-10-01T00:00:00Z,2023-10-01T00:00:00Z,Practicum,\"go,courses\",,,,,,2100-01-01T00:00:00Z\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+			addSessionCookie(request, token)
+
+			recorder := httptest.NewRecorder()
+			router := router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			}, nil))
+
+			router.Router.ServeHTTP(recorder, request)
+
+			result := recorder.Result()
+
+			assert.Equal(t, tt.want.statusCode, result.StatusCode)
+			assert.Equal(t, tt.want.contentType, result.Header.Get("Content-Type"))
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			err = result.Body.Close()
+			require.NoError(t, err)
+
+			if tt.want.statusCode != http.StatusOK {
+				assert.Equal(t, tt.want.body, string(body))
+				return
+			}
+
+			lines := strings.SplitAfter(string(body), "\n")
+			require.Len(t, lines, 4)
+			assert.Equal(t, tt.want.body, lines[0]+lines[1])
+			assert.Regexp(t, `^http://localhost/QrPnX5IU,https://yandex.ru/,true,2023-10-01T01:00:00Z,`, lines[2])
+		})
+	}
+
+	t.Run("empty export in csv format has header", func(t *testing.T) {
+		otherToken, err := auth.BuildJWTToken()
+		require.NoError(t, err)
+
+		request := httptest.NewRequest(http.MethodGet, "/api/user/urls/export?format=csv", nil)
+		addSessionCookie(request, otherToken)
+
+		recorder := httptest.NewRecorder()
+		router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+			Address:             "localhost:8080",
+			BaseShortURLAddress: "http://localhost",
+		}, nil)).Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+		defer result.Body.Close()
+
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "short_url,original_url,is_deleted,created_at,updated_at,title,tags,notes,redirect_status,query_mode,default_query,targets,expires_at\n", string(body))
+	})
+}
+
+func TestRouterAPIShortenImportHandler(t *testing.T) {
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "QrPnX5IU",
+		OriginalURL: "https://practicum.yandex.ru/",
+	})
+
+	body := strings.Join([]string{
+		`{"original_url": "https://practicum.yandex.ru/"}`,
+		`{"original_url": "https://yandex.ru/", "tags": ["search"]}`,
+		`{"original_url": "https://yandex.ru/"}`,
+		`{"original_url": ""}`,
+		`not json`,
+	}, "\n")
+
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten/import", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/x-ndjson")
+
+	recorder := httptest.NewRecorder()
+	router := router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+		Address:             "localhost:8080",
+		BaseShortURLAddress: "http://localhost",
+	}, nil))
+
+	router.Router.ServeHTTP(recorder, request)
+
+	result := recorder.Result()
+
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "1", result.Header.Get("X-Import-Created"))
+	assert.Equal(t, "2", result.Header.Get("X-Import-Exists"))
+	assert.Equal(t, "2", result.Header.Get("X-Import-Invalid"))
+	assert.Equal(t, "0", result.Header.Get("X-Import-Failed"))
+
+	reportBody, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	err = result.Body.Close()
+	require.NoError(t, err)
+
+	report := strings.Split(strings.TrimSpace(string(reportBody)), "\n")
+	require.Len(t, report, 5)
+	assert.Equal(t, `{"line":1,"status":"exists","original_url":"https://practicum.yandex.ru/","short_url":"http://localhost/QrPnX5IU"}`, report[0])
+	assert.Regexp(t, `^{"line":2,"status":"created","original_url":"https://yandex.ru/","short_url":"http://localhost/.{8}"}$`, report[1])
+	assert.Regexp(t, `^{"line":3,"status":"exists",`, report[2])
+	assert.Equal(t, `{"line":4,"status":"invalid","error":"original url is empty"}`, report[3])
+	assert.Regexp(t, `^{"line":5,"status":"invalid","error":"invalid character`, report[4])
+
+	url, err := defaultStorage.ReadByOriginalURL(context.Background(), "", "https://yandex.ru/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"search"}, []string(url.Tags))
+
+	serveFormat := func(contentType string, body io.Reader) (*http.Response, []string) {
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten/import", body)
+		request.Header.Set("Content-Type", contentType)
+
+		recorder := httptest.NewRecorder()
+		router.Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+
+		reportBody, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		err = result.Body.Close()
+		require.NoError(t, err)
+
+		return result, strings.Split(strings.TrimSpace(string(reportBody)), "\n")
+	}
+
+	serve := func(body io.Reader) (*http.Response, []string) {
+		return serveFormat("application/x-ndjson", body)
+	}
+
+	t.Run("too long line is invalid", func(t *testing.T) {
+		result, report := serve(strings.NewReader(strings.Join([]string{
+			`{"original_url": "https://ya.ru/` + strings.Repeat("a", 2<<20) + `"}`,
+			`{"original_url": "https://ya.ru/"}`,
+		}, "\n")))
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "1", result.Header.Get("X-Import-Created"))
+		assert.Equal(t, "1", result.Header.Get("X-Import-Invalid"))
+
+		require.Len(t, report, 2)
+		assert.Equal(t, `{"line":1,"status":"invalid","error":"line is too long"}`, report[0])
+		assert.Regexp(t, `^{"line":2,"status":"created",`, report[1])
+	})
+
+	t.Run("read error keeps report of saved rows", func(t *testing.T) {
+		result, report := serve(io.MultiReader(
+			strings.NewReader(`{"original_url": "https://dzen.ru/"}`+"\n"),
+			iotest.ErrReader(errors.New("connection reset")),
+		))
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "1", result.Header.Get("X-Import-Created"))
+
+		require.Len(t, report, 2)
+		assert.Regexp(t, `^{"line":1,"status":"created",`, report[0])
+		assert.Equal(t, `{"line":0,"status":"error","error":"Cannot read import body: connection reset"}`, report[1])
+	})
+
+	t.Run("csv with expiry", func(t *testing.T) {
+		result, report := serveFormat("text/csv", strings.NewReader(
+			"original_url,title,expires_at\n"+
+				"https://music.yandex.ru/,Music,2100-01-01T00:00:00Z\n"+
+				"https://market.yandex.ru/,Market,tomorrow\n",
+		))
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "1", result.Header.Get("X-Import-Created"))
+		assert.Equal(t, "1", result.Header.Get("X-Import-Invalid"))
+		require.Len(t, report, 2)
+
+		url, err := defaultStorage.ReadByOriginalURL(context.Background(), "", "https://music.yandex.ru/")
+		require.NoError(t, err)
+		require.NotNil(t, url.ExpiresAt)
+		assert.Equal(t, time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC), *url.ExpiresAt)
+	})
+}
+
+func TestRouterPolicy(t *testing.T) {
+	policyPath := filepath.Join(t.TempDir(), "policy.txt")
+	require.NoError(t, os.WriteFile(policyPath, []byte("block *.phishing.example\nflag *.suspicious.example\n"), 0600))
+
+	policyEngine, err := policy.NewEngine(policyPath)
+	require.NoError(t, err)
+
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		OriginalURL: "https://bank.phishing.example/",
+	})
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "Gm3MXqZc",
+		OriginalURL: "https://shop.suspicious.example/",
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		request    string
+		body       string
+		statusCode int
+		response   string
+	}{
+		{
+			name:       "shorten blocked domain",
+			method:     http.MethodPost,
+			request:    "/api/shorten",
+			body:       `{"url": "https://login.phishing.example/"}`,
+			statusCode: http.StatusBadRequest,
+			response: `{"code":"domain_blocked","message":"domain \"login.phishing.example\" is blocked"}
+`,
+		},
+		{
+			name:       "redirect to domain blocked after shortening",
+			method:     http.MethodGet,
+			request:    "/EwHXdJfB",
+			statusCode: http.StatusForbidden,
+			response:   "<h1>Destination is blocked</h1>",
+		},
+		{
+			name:       "redirect to domain flagged by policy",
+			method:     http.MethodGet,
+			request:    "/Gm3MXqZc",
+			statusCode: http.StatusOK,
+			response:   "You are leaving for shop.suspicious.example",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.request, strings.NewReader(tt.body))
+
+			recorder := httptest.NewRecorder()
+			router := router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			}, policyEngine))
+
+			router.Router.ServeHTTP(recorder, request)
+
+			result := recorder.Result()
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			err = result.Body.Close()
+			require.NoError(t, err)
+
+			assert.Contains(t, string(body), tt.response)
+		})
+	}
+}
+
+func TestRouterAdminFlagURLHandler(t *testing.T) {
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		OriginalURL: "https://practicum.yandex.ru/",
+	})
+
+	tests := []struct {
+		name        string
+		method      string
+		request     string
+		body        string
+		adminToken  string
+		statusCode  int
+		contentType string
+		response    string
+	}{
+		{
+			name:       "flag without admin token",
+			method:     http.MethodPut,
+			request:    "/api/admin/urls/EwHXdJfB/flag",
+			body:       `{"flagged": true}`,
+			statusCode: http.StatusForbidden,
+			response:   "Forbidden",
+		},
+		{
+			name:       "flag with wrong admin token",
+			method:     http.MethodPut,
+			request:    "/api/admin/urls/EwHXdJfB/flag",
+			body:       `{"flagged": true}`,
+			adminToken: "wrong",
+			statusCode: http.StatusForbidden,
+			response:   "Forbidden",
+		},
+		{
+			name:       "flag not existing url",
+			method:     http.MethodPut,
+			request:    "/api/admin/urls/notexist/flag",
+			body:       `{"flagged": true}`,
+			adminToken: "secret",
+			statusCode: http.StatusNotFound,
+			response:   "Not Found",
+		},
+		{
+			name:       "flag url",
+			method:     http.MethodPut,
+			request:    "/api/admin/urls/EwHXdJfB/flag",
+			body:       `{"flagged": true}`,
+			adminToken: "secret",
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:        "redirect to flagged url",
+			method:      http.MethodGet,
+			request:     "/EwHXdJfB",
+			statusCode:  http.StatusOK,
+			contentType: "text/html; charset=utf-8",
+			response:    `<a href="https://practicum.yandex.ru/" rel="noopener noreferrer nofollow">Continue</a>`,
+		},
+		{
+			name:       "unflag url",
+			method:     http.MethodPut,
+			request:    "/api/admin/urls/EwHXdJfB/flag",
+			body:       `{"flagged": false}`,
+			adminToken: "secret",
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "redirect to unflagged url",
+			method:     http.MethodGet,
+			request:    "/EwHXdJfB",
+			statusCode: http.StatusTemporaryRedirect,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.request, strings.NewReader(tt.body))
+			if tt.adminToken != "" {
+				request.Header.Set(handler.AdminTokenHeader, tt.adminToken)
+			}
+
+			recorder := httptest.NewRecorder()
+			router := router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+				AdminToken:          "secret",
+			}, nil))
+
+			router.Router.ServeHTTP(recorder, request)
+
+			result := recorder.Result()
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			err = result.Body.Close()
+			require.NoError(t, err)
+
+			assert.Contains(t, string(body), tt.response)
+
+			if tt.contentType != "" {
+				assert.Equal(t, tt.contentType, result.Header.Get("Content-Type"))
+				assert.Equal(t, "no-store, no-cache, must-revalidate, max-age=0", result.Header.Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestRouterPreviewHandler(t *testing.T) {
+	token, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+	userID, err := auth.GetUserID(token)
+	require.NoError(t, err)
+
+	createdAt := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		OriginalURL: "https://practicum.yandex.ru/",
+		UserID:      userID,
+		CreatedAt:   createdAt,
+		Title:       "Practicum",
+		Tags:        []string{"edu"},
+	})
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "Gm3MXqZc",
+		OriginalURL: "https://yandex.ru/",
+		DeletedFlag: true,
+	})
+
+	tests := []struct {
+		name        string
+		request     string
+		accept      string
+		withCookie  bool
+		statusCode  int
+		contentType string
+		response    string
+	}{
+		{
+			name:        "preview with plus suffix as owner",
+			request:     "/EwHXdJfB+",
+			accept:      "application/json",
+			withCookie:  true,
+			statusCode:  http.StatusOK,
+			contentType: "application/json",
+			response: `{"short_url":"http://localhost/EwHXdJfB","original_url":"https://practicum.yandex.ru/","created_at":"2023-10-01T12:00:00Z","title":"Practicum","tags":["edu"]}
+`,
+		},
+		{
+			name:        "preview with query parameter as stranger",
+			request:     "/EwHXdJfB?preview=1",
+			accept:      "application/json",
+			statusCode:  http.StatusOK,
+			contentType: "application/json",
+			response: `{"short_url":"http://localhost/EwHXdJfB","original_url":"https://practicum.yandex.ru/","created_at":"2023-10-01T12:00:00Z"}
+`,
+		},
+		{
+			name:        "preview as html",
+			request:     "/EwHXdJfB+",
+			statusCode:  http.StatusOK,
+			contentType: "text/html; charset=utf-8",
+			response:    "<p><code>https://practicum.yandex.ru/</code></p>",
+		},
+		{
+			name:       "preview deleted url",
+			request:    "/Gm3MXqZc+",
+			statusCode: http.StatusGone,
+		},
+		{
+			name:        "preview not existing url",
+			request:     "/notexist+",
+			statusCode:  http.StatusNotFound,
+			contentType: "text/html; charset=utf-8",
+			response:    "<h1>Link not found</h1>",
+		},
+		{
+			name:        "preview not existing url in JSON",
+			request:     "/notexist+",
+			accept:      "application/json",
+			statusCode:  http.StatusNotFound,
+			contentType: "application/json",
+			response:    "{\"code\":\"not_found\",\"message\":\"The short link you followed does not exist.\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+			if tt.accept != "" {
+				request.Header.Set("Accept", tt.accept)
+			}
+			if tt.withCookie {
+				addSessionCookie(request, token)
+			}
+
+			recorder := httptest.NewRecorder()
+			router := router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			}, nil))
+
+			router.Router.ServeHTTP(recorder, request)
+
+			result := recorder.Result()
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			assert.Empty(t, result.Header.Get("Location"))
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			err = result.Body.Close()
+			require.NoError(t, err)
+
+			if tt.contentType == "application/json" {
+				assert.Equal(t, tt.response, string(body))
+			} else {
+				assert.Contains(t, string(body), tt.response)
+			}
+
+			if tt.contentType != "" {
+				assert.Equal(t, tt.contentType, result.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestRouterQRHandler(t *testing.T) {
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		OriginalURL: "https://practicum.yandex.ru/",
+	})
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "Gm3MXqZc",
+		OriginalURL: "https://yandex.ru/",
+		DeletedFlag: true,
+	})
+	defaultStorage.Add(entities.URL{
+		ShortURL:     "Dk4NpLrS",
+		OriginalURL:  "https://ya.ru/",
+		DisabledFlag: true,
+	})
+
+	expiresAt := time.Now().Add(-time.Hour)
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "Xp7KwVdT",
+		OriginalURL: "https://dzen.ru/",
+		ExpiresAt:   &expiresAt,
+	})
+
+	tests := []struct {
+		name        string
+		request     string
+		statusCode  int
+		contentType string
+	}{
+		{
+			name:        "png by default",
+			request:     "/api/qr/EwHXdJfB",
+			statusCode:  http.StatusOK,
+			contentType: "image/png",
+		},
+		{
+			name:        "svg with high error correction",
+			request:     "/api/qr/EwHXdJfB?format=svg&level=H&size=512",
+			statusCode:  http.StatusOK,
+			contentType: "image/svg+xml",
+		},
+		{
+			name:       "size too small",
+			request:    "/api/qr/EwHXdJfB?size=10",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown format",
+			request:    "/api/qr/EwHXdJfB?format=gif",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown level",
+			request:    "/api/qr/EwHXdJfB?level=X",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "not existing url",
+			request:    "/api/qr/notexist",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "deleted url",
+			request:    "/api/qr/Gm3MXqZc",
+			statusCode: http.StatusGone,
+		},
+		{
+			name:       "disabled url",
+			request:    "/api/qr/Dk4NpLrS",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "expired url",
+			request:    "/api/qr/Xp7KwVdT",
+			statusCode: http.StatusGone,
+		},
+	}
+
+	router := router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+		Address:             "localhost:8080",
+		BaseShortURLAddress: "http://localhost",
+	}, nil))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+
+			recorder := httptest.NewRecorder()
+			router.Router.ServeHTTP(recorder, request)
+
+			result := recorder.Result()
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			err = result.Body.Close()
+			require.NoError(t, err)
+
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, tt.contentType, result.Header.Get("Content-Type"))
+			assert.Equal(t, "public, max-age=86400", result.Header.Get("Cache-Control"))
+
+			switch tt.contentType {
+			case "image/png":
+				image, err := png.Decode(bytes.NewReader(body))
+				require.NoError(t, err)
+				assert.Equal(t, 256, image.Bounds().Dx())
+			case "image/svg+xml":
+				assert.True(t, strings.HasPrefix(string(body), `<svg xmlns="http://www.w3.org/2000/svg" width="512" height="512"`))
+			}
+
+			request = httptest.NewRequest(http.MethodGet, tt.request, nil)
+			request.Header.Set("If-None-Match", result.Header.Get("ETag"))
+
+			recorder = httptest.NewRecorder()
+			router.Router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, http.StatusNotModified, recorder.Result().StatusCode)
+			recorder.Result().Body.Close()
+		})
+	}
+}
+
+func TestRouterAPIShortenBatchHandler(t *testing.T) {
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		OriginalURL: "https://practicum.yandex.ru/",
+		UserID:      "owner",
+	})
+
+	token, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+
+	serve := func(method string, target string, body string) (*http.Response, []byte) {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+token)
+
+		recorder := httptest.NewRecorder()
+		router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+			Address:             "localhost:8080",
+			BaseShortURLAddress: "http://localhost",
+		}, nil)).Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+		defer result.Body.Close()
+
+		responseBody, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+
+		return result, responseBody
+	}
+
+	result, body := serve(http.MethodPost, "/api/shorten/batch", `[{"correlation_id":"1","original_url":"https://practicum.yandex.ru/"}]`)
+	require.Equal(t, http.StatusConflict, result.StatusCode, "batch of existing urls")
+
+	var responseModel []models.APIShortenBatchResponse
+	require.NoError(t, json.Unmarshal(body, &responseModel))
+	assert.Equal(t, []models.APIShortenBatchResponse{
+		{CorrelationID: "1", ShortURL: "http://localhost/EwHXdJfB", Conflict: true},
+	}, responseModel)
+
+	url, err := defaultStorage.ReadByID(context.Background(), "", "EwHXdJfB")
+	require.NoError(t, err)
+	assert.Equal(t, "owner", url.UserID, "batch must not take over an existing url")
+
+	result, _ = serve(http.MethodPatch, "/api/user/urls/EwHXdJfB", `{"url": "https://evil.example/"}`)
+	assert.Equal(t, http.StatusForbidden, result.StatusCode)
+
+	result, body = serve(http.MethodPost, "/api/shorten/batch", `[
+		{"correlation_id":"1","original_url":"https://practicum.yandex.ru/"},
+		{"correlation_id":"2","original_url":"https://practicum.yandex.ru/learn/"},
+		{"correlation_id":"3","original_url":"https://practicum.yandex.ru/learn/"}
+	]`)
+	require.Equal(t, http.StatusCreated, result.StatusCode, "batch with new urls")
+
+	responseModel = nil
+	require.NoError(t, json.Unmarshal(body, &responseModel))
+	require.Len(t, responseModel, 3)
+	assert.True(t, responseModel[0].Conflict)
+	assert.False(t, responseModel[1].Conflict)
+	assert.False(t, responseModel[2].Conflict, "repeated url of the same batch is not a conflict")
+	assert.Equal(t, responseModel[1].ShortURL, responseModel[2].ShortURL)
+
+	err = defaultStorage.Add(entities.URL{ShortURL: "EwHXdJfB", OriginalURL: "https://evil.example/", UserID: "attacker"})
+	assert.ErrorIs(t, err, storage.ErrIDExists, "existing short url must not be overwritten")
+
+	t.Run("next id of one url is the first id of another", func(t *testing.T) {
+		takenID, err := shortener.CreateID("https://yandex.ru/")
+		require.NoError(t, err)
+
+		require.NoError(t, defaultStorage.Add(entities.URL{ShortURL: takenID, OriginalURL: "https://ya.ru/", UserID: "owner"}))
+
+		result, body := serve(http.MethodPost, "/api/shorten/batch", `[
+			{"correlation_id":"1","original_url":"https://yandex.ru/"},
+			{"correlation_id":"2","original_url":"https://yandex.ru/#1"}
+		]`)
+		require.Equal(t, http.StatusCreated, result.StatusCode)
+
+		var responseModel []models.APIShortenBatchResponse
+		require.NoError(t, json.Unmarshal(body, &responseModel))
+		require.Len(t, responseModel, 2)
+		assert.NotEqual(t, responseModel[0].ShortURL, responseModel[1].ShortURL)
+	})
+}
+
+func TestRouterAPIShortenBatchHandlerConcurrentInsert(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	gomock.InOrder(
+		mockStorage.EXPECT().ReadByOriginalURLs(gomock.Any(), "", []string{"https://practicum.yandex.ru/"}).Return(nil, nil),
+		mockStorage.EXPECT().ReadByID(gomock.Any(), "", gomock.Any()).Return(entities.URL{}, storage.ErrIDNotExists),
+		mockStorage.EXPECT().AddBatch(gomock.Any(), gomock.Any()).Return(storage.ErrOriginalURLExists),
+		mockStorage.EXPECT().ReadByOriginalURLs(gomock.Any(), "", []string{"https://practicum.yandex.ru/"}).Return([]entities.URL{
+			{ShortURL: "EwHXdJfB", OriginalURL: "https://practicum.yandex.ru/"},
+		}, nil),
+	)
+
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(`[{"correlation_id":"1","original_url":"https://practicum.yandex.ru/"}]`))
+
+	recorder := httptest.NewRecorder()
+	router.NewRouter(handler.NewHandler(mockStorage, config.Config{
+		Address:             "localhost:8080",
+		BaseShortURLAddress: "http://localhost",
+	}, nil)).Router.ServeHTTP(recorder, request)
+
+	result := recorder.Result()
+	defer result.Body.Close()
+
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusConflict, result.StatusCode)
+	assert.Equal(t, `[{"correlation_id":"1","short_url":"http://localhost/EwHXdJfB","conflict":true}]`+"\n", string(body))
+}
+
+func TestRouterAPIShortenHandlerWithQR(t *testing.T) {
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten?qr=true", strings.NewReader(`{"url": "https://practicum.yandex.ru/"}`))
+
+	recorder := httptest.NewRecorder()
+	router := router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+		Address:             "localhost:8080",
+		BaseShortURLAddress: "http://localhost",
+	}, nil))
+
+	router.Router.ServeHTTP(recorder, request)
+
+	result := recorder.Result()
+
+	assert.Equal(t, http.StatusCreated, result.StatusCode)
+
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	err = result.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, `{"result":"http://localhost/QrPnX5IU","qr":"http://localhost/api/qr/QrPnX5IU"}
+`, string(body))
+}
+
+func TestRouterRedirectStatus(t *testing.T) {
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		OriginalURL: "https://practicum.yandex.ru/",
+	})
+	defaultStorage.Add(entities.URL{
+		ShortURL:       "Gm3MXqZc",
+		OriginalURL:    "https://yandex.ru/",
+		RedirectStatus: http.StatusFound,
+	})
+	defaultStorage.Add(entities.URL{
+		ShortURL:       "Kp9wTzLa",
+		OriginalURL:    "https://ya.ru/",
+		RedirectStatus: http.StatusMovedPermanently,
+		DeletedFlag:    true,
+	})
+
+	tests := []struct {
+		name         string
+		method       string
+		request      string
+		config       config.Config
+		statusCode   int
+		location     string
+		cacheControl string
+	}{
+		{
+			name:         "default redirect status",
+			method:       http.MethodGet,
+			request:      "/EwHXdJfB",
+			statusCode:   http.StatusTemporaryRedirect,
+			location:     "https://practicum.yandex.ru/",
+			cacheControl: "private, no-cache",
+		},
+		{
+			name:    "global permanent redirect status",
+			method:  http.MethodGet,
+			request: "/EwHXdJfB",
+			config: config.Config{
+				RedirectStatus: http.StatusPermanentRedirect,
+				RedirectMaxAge: 600,
+			},
+			statusCode:   http.StatusPermanentRedirect,
+			location:     "https://practicum.yandex.ru/",
+			cacheControl: "public, max-age=600",
+		},
+		{
+			name:    "link redirect status overrides global",
+			method:  http.MethodGet,
+			request: "/Gm3MXqZc",
+			config: config.Config{
+				RedirectStatus: http.StatusMovedPermanently,
+			},
+			statusCode:   http.StatusFound,
+			location:     "https://yandex.ru/",
+			cacheControl: "private, no-cache",
+		},
+		{
+			name:         "head request",
+			method:       http.MethodHead,
+			request:      "/EwHXdJfB",
+			statusCode:   http.StatusTemporaryRedirect,
+			location:     "https://practicum.yandex.ru/",
+			cacheControl: "private, no-cache",
+		},
+		{
+			name:         "deleted permanent redirect is not cached",
+			method:       http.MethodGet,
+			request:      "/Kp9wTzLa",
+			statusCode:   http.StatusGone,
+			cacheControl: "no-store",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.request, nil)
+
+			tt.config.Address = "localhost:8080"
+			tt.config.BaseShortURLAddress = "http://localhost"
+
+			recorder := httptest.NewRecorder()
+			router := router.NewRouter(handler.NewHandler(defaultStorage, tt.config, nil))
+
+			router.Router.ServeHTTP(recorder, request)
+
+			result := recorder.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			assert.Equal(t, tt.location, result.Header.Get("Location"))
+			assert.Equal(t, tt.cacheControl, result.Header.Get("Cache-Control"))
+		})
+	}
+}
+
+func TestRouterRedirectQuery(t *testing.T) {
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		OriginalURL: "https://practicum.yandex.ru/courses?page=3#top",
+	})
+	defaultStorage.Add(entities.URL{
+		ShortURL:     "Gm3MXqZc",
+		OriginalURL:  "https://practicum.yandex.ru/courses?page=1#top",
+		QueryMode:    entities.QueryModeDefaults,
+		DefaultQuery: "utm_medium=poster&utm_source=metro",
+	})
+	defaultStorage.Add(entities.URL{
+		ShortURL:     "Kp9wTzLa",
+		OriginalURL:  "https://practicum.yandex.ru/courses?page=1&utm_source=site#top",
+		QueryMode:    entities.QueryModePassThrough,
+		DefaultQuery: "utm_medium=poster&utm_source=metro",
+	})
+
+	tests := []struct {
+		name     string
+		request  string
+		location string
+	}{
+		{
+			name:     "ignore query by default",
+			request:  "/EwHXdJfB?utm_source=x",
+			location: "https://practicum.yandex.ru/courses?page=3#top",
+		},
+		{
+			name:     "append default parameters",
+			request:  "/Gm3MXqZc?utm_source=x",
+			location: "https://practicum.yandex.ru/courses?page=1&utm_medium=poster&utm_source=metro#top",
+		},
+		{
+			name:     "pass through request parameters",
+			request:  "/Kp9wTzLa?utm_source=x&page=2",
+			location: "https://practicum.yandex.ru/courses?page=2&utm_medium=poster&utm_source=x#top",
+		},
+		{
+			name:     "default parameters do not override destination parameters",
+			request:  "/Kp9wTzLa",
+			location: "https://practicum.yandex.ru/courses?page=1&utm_medium=poster&utm_source=site#top",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+
+			recorder := httptest.NewRecorder()
+			router := router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			}, nil))
+
+			router.Router.ServeHTTP(recorder, request)
+
+			result := recorder.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, http.StatusTemporaryRedirect, result.StatusCode)
+			assert.Equal(t, tt.location, result.Header.Get("Location"))
+		})
+	}
+}
+
+func TestRouterTargets(t *testing.T) {
+	token, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+	userID, err := auth.GetUserID(token)
+	require.NoError(t, err)
+
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		OriginalURL: "https://practicum.yandex.ru/",
+		UserID:      userID,
+		Targets: entities.Targets{
+			{Name: "app-store", URL: "https://apps.apple.com/app/practicum", Weight: 1, Device: entities.DeviceIOS},
+			{Name: "landing-a", URL: "https://practicum.yandex.ru/a", Weight: 1},
+			{Name: "landing-b", URL: "https://practicum.yandex.ru/b", Weight: 1},
+		},
+	})
+	defaultStorage.Add(entities.URL{
+		ShortURL:       "Pm8RtQwZ",
+		OriginalURL:    "https://practicum.yandex.ru/permanent",
+		UserID:         userID,
+		RedirectStatus: http.StatusPermanentRedirect,
+		FlaggedFlag:    true,
+		Targets: entities.Targets{
+			{Name: "landing-a", URL: "https://practicum.yandex.ru/permanent/a", Weight: 1},
+		},
+	})
+
+	h := handler.NewHandler(defaultStorage, config.Config{
+		Address:             "localhost:8080",
+		BaseShortURLAddress: "http://localhost",
+	}, nil)
+	router := router.NewRouter(h)
+
+	serve := func(method string, target string, userAgent string, visitor string) (string, *http.Response) {
+		request := httptest.NewRequest(method, target, nil)
+		request.Header.Set("User-Agent", userAgent)
+		if visitor != "" {
+			request.AddCookie(&http.Cookie{Name: handler.VisitorCookieName, Value: visitor})
+		}
+
+		recorder := httptest.NewRecorder()
+		router.Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+		result.Body.Close()
+
+		return result.Header.Get("Location"), result
+	}
+
+	redirect := func(userAgent string, visitor string) (string, *http.Response) {
+		return serve(http.MethodGet, "/EwHXdJfB", userAgent, visitor)
+	}
+
+	clicks := func(id string) string {
+		h.ClicksWg.Wait()
+
+		request := httptest.NewRequest(http.MethodGet, "/api/user/urls/"+id+"/clicks", nil)
+		addSessionCookie(request, token)
+
+		recorder := httptest.NewRecorder()
+		router.Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+		defer result.Body.Close()
+
+		require.Equal(t, http.StatusOK, result.StatusCode)
+
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+
+		return string(body)
+	}
+
+	t.Run("device target", func(t *testing.T) {
+		location, result := redirect("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)", "visitor")
+		assert.Equal(t, http.StatusTemporaryRedirect, result.StatusCode)
+		assert.Equal(t, "https://apps.apple.com/app/practicum", location)
+	})
+
+	t.Run("sticky weighted target", func(t *testing.T) {
+		location, result := redirect("Mozilla/5.0 (X11; Linux x86_64)", "")
+		assert.Contains(t, []string{"https://practicum.yandex.ru/a", "https://practicum.yandex.ru/b"}, location)
+
+		var visitor string
+		for _, cookie := range result.Cookies() {
+			if cookie.Name == handler.VisitorCookieName {
+				visitor = cookie.Value
+			}
+		}
+		require.NotEmpty(t, visitor)
+
+		for i := 0; i < 5; i++ {
+			nextLocation, _ := redirect("Mozilla/5.0 (X11; Linux x86_64)", visitor)
+			assert.Equal(t, location, nextLocation)
+		}
+	})
+
+	t.Run("head request is not a click", func(t *testing.T) {
+		_, result := serve(http.MethodHead, "/EwHXdJfB", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)", "visitor")
+		assert.Equal(t, http.StatusTemporaryRedirect, result.StatusCode)
+	})
+
+	t.Run("clicks by variant", func(t *testing.T) {
+		assert.Regexp(t, `^\[{"variant":"app-store","count":1},{"variant":"landing-[ab]","count":6}\]\s*$`, clicks("EwHXdJfB"))
+	})
+
+	t.Run("warning page is not a click", func(t *testing.T) {
+		_, result := serve(http.MethodGet, "/Pm8RtQwZ", "Mozilla/5.0 (X11; Linux x86_64)", "visitor")
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+
+		assert.Equal(t, "[]\n", clicks("Pm8RtQwZ"))
+	})
+
+	t.Run("permanent redirect with targets is not cached publicly", func(t *testing.T) {
+		require.NoError(t, defaultStorage.SetFlagged(context.Background(), "", "Pm8RtQwZ", false))
+
+		_, result := serve(http.MethodGet, "/Pm8RtQwZ", "Mozilla/5.0 (X11; Linux x86_64)", "visitor")
+		assert.Equal(t, http.StatusPermanentRedirect, result.StatusCode)
+		assert.Equal(t, "private, no-cache", result.Header.Get("Cache-Control"))
+	})
+
+	t.Run("invalid target device", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(
+			`{"url": "https://ya.ru", "targets": [{"url": "https://ya.ru/tv", "device": "tv"}]}`,
+		))
+
+		recorder := httptest.NewRecorder()
+		router.Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+		defer result.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+	})
+}
+
+func TestRouterShortDomains(t *testing.T) {
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		OriginalURL: "https://practicum.yandex.ru/",
+	})
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		Domain:      "go.example.com",
+		OriginalURL: "https://yandex.ru/",
+	})
+
+	type want struct {
+		code     int
+		location string
+		body     string
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		host    string
+		request string
+		body    string
+		want    want
+	}{
+		{
+			name:    "same id on default domain",
+			method:  http.MethodGet,
+			host:    "localhost",
+			request: "/EwHXdJfB",
+			want: want{
+				code:     http.StatusTemporaryRedirect,
+				location: "https://practicum.yandex.ru/",
+			},
+		},
+		{
+			name:    "same id on custom domain",
+			method:  http.MethodGet,
+			host:    "go.example.com",
+			request: "/EwHXdJfB",
+			want: want{
+				code:     http.StatusTemporaryRedirect,
+				location: "https://yandex.ru/",
+			},
+		},
+		{
+			name:    "fallback for unknown id on custom domain",
+			method:  http.MethodGet,
+			host:    "go.example.com",
+			request: "/unknown",
+			want: want{
+				code:     http.StatusFound,
+				location: "https://example.com/",
+			},
+		},
+		{
+			name:    "fallback for unknown id on default domain",
+			method:  http.MethodGet,
+			host:    "localhost",
+			request: "/unknown",
+			want: want{
+				code:     http.StatusFound,
+				location: "https://localhost/home",
+			},
+		},
+		{
+			name:    "shorten on custom domain",
+			method:  http.MethodPost,
+			host:    "localhost",
+			request: "/api/shorten",
+			body:    `{"url": "https://practicum.yandex.ru/learn/", "domain": "go.example.com"}`,
+			want: want{
+				code: http.StatusCreated,
+				body: `{"result":"http://go.example.com/`,
+			},
+		},
+		{
+			name:    "shorten on domain of request",
+			method:  http.MethodPost,
+			host:    "go.example.com",
+			request: "/api/shorten",
+			body:    `{"url": "https://practicum.yandex.ru/learn/"}`,
+			want: want{
+				code: http.StatusConflict,
+				body: `{"result":"http://go.example.com/`,
+			},
+		},
+		{
+			name:    "shorten on unknown domain",
+			method:  http.MethodPost,
+			host:    "localhost",
+			request: "/api/shorten?domain=unknown.example.com",
+			body:    `{"url": "https://practicum.yandex.ru/learn/"}`,
+			want: want{
+				code: http.StatusBadRequest,
+				body: "Unknown domain",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.request, strings.NewReader(tt.body))
+			request.Host = tt.host
+
+			recorder := httptest.NewRecorder()
+			router := router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+				ShortDomains:        []string{"go.example.com=https://example.com/", "localhost=https://localhost/home"},
+			}, nil))
+
+			router.Router.ServeHTTP(recorder, request)
+
+			result := recorder.Result()
+			defer result.Body.Close()
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want.code, result.StatusCode)
+			assert.Equal(t, tt.want.location, result.Header.Get("Location"))
+			assert.True(t, strings.HasPrefix(string(body), tt.want.body))
+		})
+	}
+}
+
+func TestRouterPages(t *testing.T) {
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "Gm3MXqZc",
+		OriginalURL: "https://yandex.ru/",
+		DeletedFlag: true,
+	})
+
+	expiresAt := time.Now().Add(-time.Hour)
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "Xp7KwVdT",
+		OriginalURL: "https://ya.ru/",
+		ExpiresAt:   &expiresAt,
+	})
+
+	templatesDir := t.TempDir()
+	require.NoError(t, os.WriteFile(
+		filepath.Join(templatesDir, "not_found.html"),
+		[]byte(`<p>No link {{.ID}} here ({{.Status}})</p>`),
+		0o644,
+	))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(templatesDir, "landing.html"),
+		[]byte(`<p>Welcome to {{.BaseURL}}</p>`),
+		0o644,
+	))
+
+	tests := []struct {
+		name        string
+		request     string
+		accept      string
+		statusCode  int
+		contentType string
+		response    string
+	}{
+		{
+			name:        "landing page from templates directory",
+			request:     "/",
+			statusCode:  http.StatusOK,
+			contentType: "text/html; charset=utf-8",
+			response:    "<p>Welcome to http://localhost</p>",
+		},
+		{
+			name:        "not found page from templates directory",
+			request:     "/notexist",
+			statusCode:  http.StatusNotFound,
+			contentType: "text/html; charset=utf-8",
+			response:    "<p>No link notexist here (404)</p>",
+		},
+		{
+			name:        "built-in gone page",
+			request:     "/Gm3MXqZc",
+			statusCode:  http.StatusGone,
+			contentType: "text/html; charset=utf-8",
+			response:    "<h1>Link deleted</h1>",
+		},
+		{
+			name:        "gone in JSON",
+			request:     "/Gm3MXqZc",
+			accept:      "application/json",
+			statusCode:  http.StatusGone,
+			contentType: "application/json",
+			response:    `{"code":"gone","message":"The short link you followed has been deleted."}`,
+		},
+		{
+			name:        "built-in expired page",
+			request:     "/Xp7KwVdT",
+			statusCode:  http.StatusGone,
+			contentType: "text/html; charset=utf-8",
+			response:    "<h1>Link expired</h1>",
+		},
+		{
+			name:        "expired in JSON",
+			request:     "/Xp7KwVdT",
+			accept:      "application/json",
+			statusCode:  http.StatusGone,
+			contentType: "application/json",
+			response:    `{"code":"expired","message":"The short link you followed has expired."}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+			if tt.accept != "" {
+				request.Header.Set("Accept", tt.accept)
+			}
+
+			recorder := httptest.NewRecorder()
+			router := router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+				TemplatesDir:        templatesDir,
+			}, nil))
+
+			router.Router.ServeHTTP(recorder, request)
+
+			result := recorder.Result()
+			defer result.Body.Close()
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			assert.Equal(t, tt.contentType, result.Header.Get("Content-Type"))
+			assert.Contains(t, string(body), tt.response)
+		})
+	}
+}
+
+func TestRouterJWKSHandler(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+
+	recorder := httptest.NewRecorder()
+	router := router.NewRouter(handler.NewHandler(nil, config.Config{
+		Address:             "localhost:8080",
+		BaseShortURLAddress: "http://localhost",
+	}, nil))
+
+	router.Router.ServeHTTP(recorder, request)
+
+	result := recorder.Result()
+	defer result.Body.Close()
+
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "application/json", result.Header.Get("Content-Type"))
+	assert.Equal(t, "public, max-age=300", result.Header.Get("Cache-Control"))
+	assert.JSONEq(t, `{"keys":[]}`, string(body), "hmac secrets must not be published")
+}
+
+func TestRouterRefreshTokenHandler(t *testing.T) {
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	token, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+	userID, err := auth.GetUserID(token)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		token      string
+		statusCode int
+	}{
+		{
+			name:       "refresh valid token",
+			token:      token,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "refresh without token",
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "refresh invalid token",
+			token:      "invalid",
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+			if tt.token != "" {
+				addSessionCookie(request, tt.token)
+			}
+
+			recorder := httptest.NewRecorder()
+			router := router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			}, nil))
+
+			router.Router.ServeHTTP(recorder, request)
+
+			result := recorder.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+
+			var responseModel models.APIAuthTokenResponse
+			require.NoError(t, json.NewDecoder(result.Body).Decode(&responseModel))
+
+			refreshedUserID, err := auth.GetUserID(responseModel.Token)
+			require.NoError(t, err)
+			assert.Equal(t, userID, refreshedUserID)
+			assert.True(t, responseModel.ExpiresAt.After(time.Now()))
+
+			cookies := result.Cookies()
+			require.NotEmpty(t, cookies)
+			assert.Equal(t, responseModel.Token, cookies[len(cookies)-1].Value)
+		})
+	}
+}
+
+func TestRouterBearerAuth(t *testing.T) {
+	token, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+	userID, err := auth.GetUserID(token)
+	require.NoError(t, err)
+
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		OriginalURL: "https://practicum.yandex.ru/",
+		UserID:      userID,
+	})
+
+	type want struct {
+		statusCode      int
+		wwwAuthenticate string
+		setCookie       bool
+	}
+
+	tests := []struct {
+		name          string
+		strict        bool
+		method        string
+		request       string
+		body          string
+		authorization string
+		cookie        string
+		want          want
+	}{
+		{
+			name:          "user urls with bearer token",
+			method:        http.MethodGet,
+			request:       "/api/user/urls",
+			authorization: "Bearer " + token,
+			want: want{
+				statusCode: http.StatusOK,
+			},
+		},
+		{
+			name:          "invalid bearer token",
+			method:        http.MethodGet,
+			request:       "/api/user/urls",
+			authorization: "Bearer invalid",
+			want: want{
+				statusCode:      http.StatusUnauthorized,
+				wwwAuthenticate: `Bearer realm="shortener", error="invalid_token"`,
+			},
+		},
+		{
+			name:    "anonymous api request",
+			method:  http.MethodPost,
+			request: "/api/shorten",
+			body:    `{"url": "https://yandex.ru/"}`,
+			want: want{
+				statusCode: http.StatusCreated,
+				setCookie:  true,
+			},
+		},
+		{
+			name:    "anonymous api request in strict mode",
+			strict:  true,
+			method:  http.MethodPost,
+			request: "/api/shorten",
+			body:    `{"url": "https://yandex.ru/"}`,
+			want: want{
+				statusCode:      http.StatusUnauthorized,
+				wwwAuthenticate: `Bearer realm="shortener"`,
+			},
+		},
+		{
+			name:    "invalid cookie in strict mode",
+			strict:  true,
+			method:  http.MethodGet,
+			request: "/api/user/urls",
+			cookie:  "invalid",
+			want: want{
+				statusCode:      http.StatusUnauthorized,
+				wwwAuthenticate: `Bearer realm="shortener", error="invalid_token"`,
+			},
+		},
+		{
+			name:          "bearer token in strict mode",
+			strict:        true,
+			method:        http.MethodPost,
+			request:       "/api/shorten",
+			body:          `{"url": "https://practicum.yandex.ru/"}`,
+			authorization: "Bearer " + token,
+			want: want{
+				statusCode: http.StatusConflict,
+			},
+		},
+		{
+			name:    "redirect in strict mode",
+			strict:  true,
+			method:  http.MethodGet,
+			request: "/EwHXdJfB",
+			want: want{
+				statusCode: http.StatusTemporaryRedirect,
+				setCookie:  true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth.SetStrictMode(tt.strict)
+			defer auth.SetStrictMode(false)
+
+			request := httptest.NewRequest(tt.method, tt.request, strings.NewReader(tt.body))
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.cookie != "" {
+				addSessionCookie(request, tt.cookie)
+			}
+
+			recorder := httptest.NewRecorder()
+			router := router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+				Address:             "localhost:8080",
+				BaseShortURLAddress: "http://localhost",
+			}, nil))
+
+			router.Router.ServeHTTP(recorder, request)
+
+			result := recorder.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.want.statusCode, result.StatusCode)
+			assert.Equal(t, tt.want.wwwAuthenticate, result.Header.Get("WWW-Authenticate"))
+			assert.Equal(t, tt.want.setCookie, tokenCookie(result) != "")
+		})
+	}
+}
+
+func TestRouterAPIKeys(t *testing.T) {
+	token, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+	userID, err := auth.GetUserID(token)
+	require.NoError(t, err)
+
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	newRouter := func() *router.Router {
+		return router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+			Address:             "localhost:8080",
+			BaseShortURLAddress: "http://localhost",
+		}, nil))
+	}
+
+	serve := func(request *http.Request) (*http.Response, []byte) {
+		recorder := httptest.NewRecorder()
+		newRouter().Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+		defer result.Body.Close()
+
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+
+		return result, body
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/api/user/keys", strings.NewReader(`{"name": "ci", "scopes": ["shorten", "shorten"]}`))
+	addSessionCookie(request, token)
+
+	result, body := serve(request)
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	var createdKey models.APIKeyResponse
+	require.NoError(t, json.Unmarshal(body, &createdKey))
+	assert.Equal(t, []string{entities.ScopeShorten}, createdKey.Scopes)
+	assert.True(t, strings.HasPrefix(createdKey.Key, createdKey.Prefix))
+
+	request = httptest.NewRequest(http.MethodGet, "/api/user/keys", nil)
+	addSessionCookie(request, token)
+
+	result, body = serve(request)
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	assert.NotContains(t, string(body), createdKey.Key, "key must be shown only once")
+	assert.Contains(t, string(body), createdKey.ID)
+
+	expiredKey, expiredPrefix, expiredHash, err := auth.GenerateAPIKey()
+	require.NoError(t, err)
+
+	expiredAt := time.Now().Add(-time.Minute)
+	require.NoError(t, defaultStorage.AddAPIKey(context.Background(), entities.APIKey{
+		ID:        "expired",
+		UserID:    userID,
+		Name:      "expired",
+		Prefix:    expiredPrefix,
+		Hash:      expiredHash,
+		Scopes:    entities.Scopes,
+		ExpiresAt: &expiredAt,
+	}))
+
+	tests := []struct {
+		name            string
+		method          string
+		request         string
+		body            string
+		apiKey          string
+		statusCode      int
+		wwwAuthenticate string
+	}{
+		{
+			name:       "shorten with api key",
+			method:     http.MethodPost,
+			request:    "/api/shorten",
+			body:       `{"url": "https://practicum.yandex.ru/"}`,
+			apiKey:     createdKey.Key,
+			statusCode: http.StatusCreated,
+		},
+		{
+			name:            "read without scope",
+			method:          http.MethodGet,
+			request:         "/api/user/urls",
+			apiKey:          createdKey.Key,
+			statusCode:      http.StatusForbidden,
+			wwwAuthenticate: `Bearer realm="shortener", error="insufficient_scope", scope="read"`,
+		},
+		{
+			name:       "create keys with api key",
+			method:     http.MethodPost,
+			request:    "/api/user/keys",
+			body:       `{"name": "escalation", "scopes": ["read"]}`,
+			apiKey:     createdKey.Key,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:            "unknown api key",
+			method:          http.MethodPost,
+			request:         "/api/shorten",
+			body:            `{"url": "https://yandex.ru/"}`,
+			apiKey:          "shk_unknown",
+			statusCode:      http.StatusUnauthorized,
+			wwwAuthenticate: `Bearer realm="shortener", error="invalid_token"`,
+		},
+		{
+			name:            "expired api key",
+			method:          http.MethodPost,
+			request:         "/api/shorten",
+			body:            `{"url": "https://yandex.ru/"}`,
+			apiKey:          expiredKey,
+			statusCode:      http.StatusUnauthorized,
+			wwwAuthenticate: `Bearer realm="shortener", error="invalid_token"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.request, strings.NewReader(tt.body))
+			request.Header.Set(middleware.APIKeyHeader, tt.apiKey)
+
+			result, _ := serve(request)
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			assert.Equal(t, tt.wwwAuthenticate, result.Header.Get("WWW-Authenticate"))
+			assert.Empty(t, result.Cookies(), "api key requests must not get a session cookie")
+		})
+	}
+
+	url, err := defaultStorage.ReadByOriginalURL(context.Background(), "", "https://practicum.yandex.ru/")
+	require.NoError(t, err)
+	assert.Equal(t, userID, url.UserID)
+
+	request = httptest.NewRequest(http.MethodDelete, "/api/user/keys/"+createdKey.ID, nil)
+	addSessionCookie(request, token)
+
+	result, _ = serve(request)
+	assert.Equal(t, http.StatusNoContent, result.StatusCode)
+
+	request = httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://yandex.ru/"}`))
+	request.Header.Set(middleware.APIKeyHeader, createdKey.Key)
+
+	result, _ = serve(request)
+	assert.Equal(t, http.StatusUnauthorized, result.StatusCode, "revoked key must not be accepted")
+}
+
+func TestRouterAPIKeysFileStorage(t *testing.T) {
+	storageConfig := config.Config{FileStoragePath: filepath.Join(t.TempDir(), "storage.json")}
+
+	token, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+
+	serve := func(defaultStorage storage.Storage, request *http.Request) (*http.Response, []byte) {
+		recorder := httptest.NewRecorder()
+		router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+			Address:             "localhost:8080",
+			BaseShortURLAddress: "http://localhost",
+		}, nil)).Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+		defer result.Body.Close()
+
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+
+		return result, body
+	}
+
+	restart := func(defaultStorage storage.Storage) storage.Storage {
+		require.NoError(t, defaultStorage.Close())
+
+		restoredStorage, err := storage.GetStorage(storageConfig)
+		require.NoError(t, err)
+
+		return restoredStorage
+	}
+
+	keyRequest := func(key string) *http.Request {
+		request := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		request.Header.Set(middleware.APIKeyHeader, key)
+
+		return request
+	}
+
+	defaultStorage, err := storage.GetStorage(storageConfig)
+	require.NoError(t, err)
+
+	request := httptest.NewRequest(http.MethodPost, "/api/user/keys", strings.NewReader(`{"name": "ci", "scopes": ["read"]}`))
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	result, body := serve(defaultStorage, request)
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	var createdKey models.APIKeyResponse
+	require.NoError(t, json.Unmarshal(body, &createdKey))
+
+	defaultStorage = restart(defaultStorage)
+
+	result, _ = serve(defaultStorage, keyRequest(createdKey.Key))
+	assert.Equal(t, http.StatusNoContent, result.StatusCode, "key must survive a restart")
+
+	request = httptest.NewRequest(http.MethodDelete, "/api/user/keys/"+createdKey.ID, nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	result, _ = serve(defaultStorage, request)
+	require.Equal(t, http.StatusNoContent, result.StatusCode)
+
+	defaultStorage = restart(defaultStorage)
+
+	result, _ = serve(defaultStorage, keyRequest(createdKey.Key))
+	assert.Equal(t, http.StatusUnauthorized, result.StatusCode, "revoked key must stay revoked after a restart")
+}
+
+func TestRouterAccounts(t *testing.T) {
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	serve := func(method string, target string, body string, token string) (*http.Response, []byte) {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			addSessionCookie(request, token)
+		}
+
+		recorder := httptest.NewRecorder()
+		router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+			Address:             "localhost:8080",
+			BaseShortURLAddress: "http://localhost",
+		}, nil)).Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+		defer result.Body.Close()
+
+		responseBody, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+
+		return result, responseBody
+	}
+
+	accountToken := func(body []byte) string {
+		var responseModel models.APIAuthTokenResponse
+		require.NoError(t, json.Unmarshal(body, &responseModel))
+
+		return responseModel.Token
+	}
+
+	anonymousToken, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+
+	result, _ := serve(http.MethodPost, "/api/shorten", `{"url": "https://practicum.yandex.ru/"}`, anonymousToken)
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	result, body := serve(http.MethodPost, "/api/auth/register", `{"login": " Alice ", "password": "correct horse"}`, anonymousToken)
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	aliceToken := accountToken(body)
+	assert.Equal(t, aliceToken, tokenCookie(result))
+
+	aliceID, err := auth.GetUserID(aliceToken)
+	require.NoError(t, err)
+
+	_, body = serve(http.MethodGet, "/api/user/urls", "", aliceToken)
+	assert.Contains(t, string(body), "https://practicum.yandex.ru/", "links of the anonymous user must move to the account")
+
+	secondAnonymousToken, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+
+	result, _ = serve(http.MethodPost, "/api/shorten", `{"url": "https://yandex.ru/"}`, secondAnonymousToken)
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	result, body = serve(http.MethodPost, "/api/auth/login", `{"login": "alice", "password": "correct horse"}`, secondAnonymousToken)
+	require.Equal(t, http.StatusOK, result.StatusCode)
+
+	loginUserID, err := auth.GetUserID(accountToken(body))
+	require.NoError(t, err)
+	assert.Equal(t, aliceID, loginUserID)
+
+	_, body = serve(http.MethodGet, "/api/user/urls", "", aliceToken)
+	assert.Contains(t, string(body), "https://practicum.yandex.ru/")
+	assert.NotContains(t, string(body), "https://yandex.ru/", "login must not take over links of the anonymous user")
+
+	_, body = serve(http.MethodGet, "/api/user/urls", "", secondAnonymousToken)
+	assert.Contains(t, string(body), "https://yandex.ru/")
+
+	result, body = serve(http.MethodPost, "/api/auth/register", `{"login": "bob", "password": "battery staple"}`, aliceToken)
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	result, _ = serve(http.MethodGet, "/api/user/urls", "", accountToken(body))
+	assert.Equal(t, http.StatusNoContent, result.StatusCode, "links of another account must not move")
+
+	tests := []struct {
+		name       string
+		request    string
+		body       string
+		statusCode int
+	}{
+		{
+			name:       "login is taken",
+			request:    "/api/auth/register",
+			body:       `{"login": "ALICE", "password": "another password"}`,
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:       "invalid login",
+			request:    "/api/auth/register",
+			body:       `{"login": "a", "password": "another password"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "short password",
+			request:    "/api/auth/register",
+			body:       `{"login": "carol", "password": "short"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "wrong password",
+			request:    "/api/auth/login",
+			body:       `{"login": "alice", "password": "wrong password"}`,
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown login",
+			request:    "/api/auth/login",
+			body:       `{"login": "mallory", "password": "correct horse"}`,
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _ := serve(http.MethodPost, tt.request, tt.body, "")
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			assert.Empty(t, tokenCookie(result), "failed sign in must not issue a token")
+		})
+	}
+}
+
+func TestRouterAccountsFileStorage(t *testing.T) {
+	storageConfig := config.Config{FileStoragePath: filepath.Join(t.TempDir(), "storage.json")}
+
+	serve := func(defaultStorage storage.Storage, method string, target string, body string, token string) (*http.Response, []byte) {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		recorder := httptest.NewRecorder()
+		router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+			Address:             "localhost:8080",
+			BaseShortURLAddress: "http://localhost",
+		}, nil)).Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+		defer result.Body.Close()
+
+		responseBody, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+
+		return result, responseBody
+	}
+
+	firstStorage, err := storage.GetStorage(storageConfig)
+	require.NoError(t, err)
+
+	info, err := os.Stat(storageConfig.FileStoragePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "storage file keeps password hashes")
+
+	anonymousToken, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+
+	result, _ := serve(firstStorage, http.MethodPost, "/api/shorten", `{"url": "https://practicum.yandex.ru/"}`, anonymousToken)
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	result, _ = serve(firstStorage, http.MethodPost, "/api/auth/register", `{"login": "alice", "password": "correct horse"}`, anonymousToken)
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	require.NoError(t, firstStorage.Close())
+
+	restoredStorage, err := storage.GetStorage(storageConfig)
+	require.NoError(t, err)
+
+	result, body := serve(restoredStorage, http.MethodPost, "/api/auth/login", `{"login": "alice", "password": "correct horse"}`, "")
+	require.Equal(t, http.StatusOK, result.StatusCode, "account must survive a restart")
+
+	var responseModel models.APIAuthTokenResponse
+	require.NoError(t, json.Unmarshal(body, &responseModel))
+
+	_, body = serve(restoredStorage, http.MethodGet, "/api/user/urls", "", responseModel.Token)
+	assert.Contains(t, string(body), "https://practicum.yandex.ru/", "merged links must stay with the account after a restart")
+}
+
+func TestRouterAdminAPI(t *testing.T) {
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	ownerID := "7f1b2e4c-0000-4000-8000-000000000001"
+	newOwnerID := "7f1b2e4c-0000-4000-8000-000000000002"
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		OriginalURL: "https://practicum.yandex.ru/",
+		UserID:      ownerID,
+	})
+
+	userToken, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+
+	serve := func(method string, target string, body string, adminToken string, token string) (*http.Response, string) {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		if adminToken != "" {
+			request.Header.Set(handler.AdminTokenHeader, adminToken)
+		}
+
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		recorder := httptest.NewRecorder()
+		router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+			Address:             "localhost:8080",
+			BaseShortURLAddress: "http://localhost",
+			AdminToken:          "secret",
+			AdminLogins:         []string{"root"},
+		}, nil)).Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+		defer result.Body.Close()
+
+		responseBody, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+
+		return result, string(responseBody)
+	}
+
+	result, _ := serve(http.MethodPost, "/api/auth/register", `{"login": "root", "password": "correct horse"}`, "", "")
+	assert.Equal(t, http.StatusForbidden, result.StatusCode, "admin account must not be registered without admin token")
+
+	result, body := serve(http.MethodPost, "/api/auth/register", `{"login": "root", "password": "correct horse"}`, "secret", "")
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	var tokenResponse models.APIAuthTokenResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &tokenResponse))
+
+	adminSession, err := auth.ParseJWTToken(tokenResponse.Token)
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleAdmin, adminSession.Role)
+
+	tests := []struct {
+		name       string
+		method     string
+		request    string
+		body       string
+		adminToken string
+		token      string
+		statusCode int
+		contains   []string
+	}{
+		{
+			name:       "lookup as regular user",
+			method:     http.MethodGet,
+			request:    "/api/admin/urls?code=EwHXdJfB",
+			token:      userToken,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "lookup by code",
+			method:     http.MethodGet,
+			request:    "/api/admin/urls?code=EwHXdJfB",
+			adminToken: "secret",
+			statusCode: http.StatusOK,
+			contains:   []string{`"user_id":"` + ownerID + `"`, `"is_disabled":false`},
+		},
+		{
+			name:       "lookup by original url with admin role",
+			method:     http.MethodGet,
+			request:    "/api/admin/urls?original_url=https://practicum.yandex.ru/",
+			token:      tokenResponse.Token,
+			statusCode: http.StatusOK,
+			contains:   []string{`"id":"EwHXdJfB"`},
+		},
+		{
+			name:       "lookup not existing url",
+			method:     http.MethodGet,
+			request:    "/api/admin/urls?code=notexist",
+			adminToken: "secret",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "disable url",
+			method:     http.MethodPut,
+			request:    "/api/admin/urls/EwHXdJfB/disable",
+			body:       `{"disabled": true}`,
+			adminToken: "secret",
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "redirect to disabled url",
+			method:     http.MethodGet,
+			request:    "/EwHXdJfB",
+			statusCode: http.StatusForbidden,
+			contains:   []string{"Link disabled"},
+		},
+		{
+			name:       "transfer to invalid user",
+			method:     http.MethodPut,
+			request:    "/api/admin/urls/EwHXdJfB/owner",
+			body:       `{"user_id": "nobody"}`,
+			adminToken: "secret",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "transfer url",
+			method:     http.MethodPut,
+			request:    "/api/admin/urls/EwHXdJfB/owner",
+			body:       `{"user_id": "` + newOwnerID + `"}`,
+			token:      tokenResponse.Token,
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "list links of new owner",
+			method:     http.MethodGet,
+			request:    "/api/admin/users/" + newOwnerID + "/urls",
+			adminToken: "secret",
+			statusCode: http.StatusOK,
+			contains:   []string{`"id":"EwHXdJfB"`, `"is_disabled":true`},
+		},
+		{
+			name:       "list links of previous owner",
+			method:     http.MethodGet,
+			request:    "/api/admin/users/" + ownerID + "/urls",
+			adminToken: "secret",
+			statusCode: http.StatusOK,
+			contains:   []string{"[]"},
+		},
+		{
+			name:       "hard delete url",
+			method:     http.MethodDelete,
+			request:    "/api/admin/urls/EwHXdJfB",
+			adminToken: "secret",
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "redirect to removed url",
+			method:     http.MethodGet,
+			request:    "/EwHXdJfB",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "hard delete removed url",
+			method:     http.MethodDelete,
+			request:    "/api/admin/urls/EwHXdJfB",
+			adminToken: "secret",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "audit log",
+			method:     http.MethodGet,
+			request:    "/api/admin/audit?limit=4",
+			adminToken: "secret",
+			statusCode: http.StatusOK,
+			contains: []string{
+				`"action":"delete"`,
+				`"action":"list_user_urls","details":"user_id=` + ownerID + `"`,
+				`"actor":"user:` + adminSession.UserID + `","action":"transfer"`,
+			},
+		},
+		{
+			name:       "audit log with invalid limit",
+			method:     http.MethodGet,
+			request:    "/api/admin/audit?limit=0",
+			adminToken: "secret",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, body := serve(tt.method, tt.request, tt.body, tt.adminToken, tt.token)
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+
+			for _, substring := range tt.contains {
+				assert.Contains(t, body, substring)
+			}
+		})
+	}
+}
+
+// addSessionCookie добавляет в запрос куки с JWT-токеном и CSRF-токен, как это делают скрипты страницы.
+func addSessionCookie(request *http.Request, token string) {
+	request.AddCookie(&http.Cookie{Name: middleware.TokenCookieName, Value: token})
+	request.AddCookie(&http.Cookie{Name: middleware.CSRFCookieName, Value: "csrf"})
+	request.Header.Set(middleware.CSRFHeader, "csrf")
+}
+
+// tokenCookie возвращает JWT-токен из куки ответа или пустую строку.
+func tokenCookie(result *http.Response) string {
+	for _, cookie := range result.Cookies() {
+		if cookie.Name == middleware.TokenCookieName {
+			return cookie.Value
+		}
+	}
+
+	return ""
+}
+
+func TestRouterAdminRoleRevoked(t *testing.T) {
+	storageConfig := config.Config{FileStoragePath: filepath.Join(t.TempDir(), "storage.json")}
+
+	defaultStorage, err := storage.GetStorage(storageConfig)
+	require.NoError(t, err)
+
+	defaultStorage.Add(entities.URL{
+		ShortURL:    "EwHXdJfB",
+		OriginalURL: "https://practicum.yandex.ru/",
+		UserID:      "owner",
+	})
+
+	serve := func(adminLogins []string, method string, target string, body string, adminToken string, token string) (*http.Response, string) {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		if adminToken != "" {
+			request.Header.Set(handler.AdminTokenHeader, adminToken)
+		}
+
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		recorder := httptest.NewRecorder()
+		router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+			Address:             "localhost:8080",
+			BaseShortURLAddress: "http://localhost",
+			AdminToken:          "secret",
+			AdminLogins:         adminLogins,
+		}, nil)).Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+		defer result.Body.Close()
+
+		responseBody, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+
+		return result, string(responseBody)
+	}
+
+	adminLogins := []string{"root"}
+
+	result, body := serve(adminLogins, http.MethodPost, "/api/auth/register", `{"login": "root", "password": "correct horse"}`, "secret", "")
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	var tokenResponse models.APIAuthTokenResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &tokenResponse))
+
+	result, _ = serve(adminLogins, http.MethodGet, "/api/admin/urls?code=EwHXdJfB", "", "", tokenResponse.Token)
+	require.Equal(t, http.StatusOK, result.StatusCode)
+
+	require.NoError(t, defaultStorage.Close())
+
+	defaultStorage, err = storage.GetStorage(storageConfig)
+	require.NoError(t, err)
+
+	result, body = serve(adminLogins, http.MethodGet, "/api/admin/audit", "", "secret", "")
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Contains(t, body, `"action":"lookup"`, "audit log must survive a restart")
+
+	result, _ = serve(nil, http.MethodGet, "/api/admin/urls?code=EwHXdJfB", "", "", tokenResponse.Token)
+	assert.Equal(t, http.StatusForbidden, result.StatusCode, "login removed from admins must lose admin rights")
+
+	result, body = serve(nil, http.MethodPost, "/api/auth/refresh", "", "", tokenResponse.Token)
+	require.Equal(t, http.StatusOK, result.StatusCode)
+
+	require.NoError(t, json.Unmarshal([]byte(body), &tokenResponse))
+
+	session, err := auth.ParseJWTToken(tokenResponse.Token)
+	require.NoError(t, err)
+	assert.Empty(t, session.Role, "renewed token must not keep a revoked role")
+}
+
+func TestRouterCookieSecurity(t *testing.T) {
+	middleware.Configure(config.Config{
+		CookieSecure:   true,
+		CookieSameSite: "strict",
+	})
+	defer middleware.Configure(config.Config{})
+
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	token, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+
+	serve := func(request *http.Request) *http.Response {
+		recorder := httptest.NewRecorder()
+		router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+			Address:             "localhost:8080",
+			BaseShortURLAddress: "http://localhost",
+		}, nil)).Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+		result.Body.Close()
+
+		return result
+	}
+
+	result := serve(httptest.NewRequest(http.MethodGet, "/api/user/urls", nil))
+
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range result.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+
+	require.Contains(t, cookies, middleware.TokenCookieName)
+	require.Contains(t, cookies, middleware.CSRFCookieName)
+
+	for _, cookie := range cookies {
+		assert.True(t, cookie.Secure, cookie.Name)
+		assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite, cookie.Name)
+		assert.Positive(t, cookie.MaxAge, cookie.Name)
+	}
+
+	assert.True(t, cookies[middleware.TokenCookieName].HttpOnly, "token must not be readable by scripts")
+	assert.False(t, cookies[middleware.CSRFCookieName].HttpOnly, "csrf token must be readable by scripts")
+
+	csrfToken := cookies[middleware.CSRFCookieName].Value
+
+	tests := []struct {
+		name          string
+		method        string
+		cookie        bool
+		csrfCookie    string
+		csrfHeader    string
+		authorization bool
+		statusCode    int
+	}{
+		{
+			name:       "cookie without csrf token",
+			method:     http.MethodPost,
+			cookie:     true,
+			csrfCookie: csrfToken,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "cookie with wrong csrf token",
+			method:     http.MethodPost,
+			cookie:     true,
+			csrfCookie: csrfToken,
+			csrfHeader: "wrong",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "csrf header without csrf cookie",
+			method:     http.MethodPost,
+			cookie:     true,
+			csrfHeader: csrfToken,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "cookie with csrf token",
+			method:     http.MethodPost,
+			cookie:     true,
+			csrfCookie: csrfToken,
+			csrfHeader: csrfToken,
+			statusCode: http.StatusCreated,
+		},
+		{
+			name:          "bearer token without csrf token",
+			method:        http.MethodPost,
+			authorization: true,
+			statusCode:    http.StatusConflict,
+		},
+		{
+			name:       "request without credentials",
+			method:     http.MethodPost,
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:       "safe method without csrf token",
+			method:     http.MethodGet,
+			cookie:     true,
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/api/shorten"
+			body := `{"url": "https://practicum.yandex.ru/"}`
+			if tt.method == http.MethodGet {
+				target = "/api/user/urls"
+				body = ""
+			}
+
+			request := httptest.NewRequest(tt.method, target, strings.NewReader(body))
+			if tt.cookie {
+				request.AddCookie(&http.Cookie{Name: middleware.TokenCookieName, Value: token})
+			}
+			if tt.csrfCookie != "" {
+				request.AddCookie(&http.Cookie{Name: middleware.CSRFCookieName, Value: tt.csrfCookie})
+			}
+			if tt.csrfHeader != "" {
+				request.Header.Set(middleware.CSRFHeader, tt.csrfHeader)
+			}
+			if tt.authorization {
+				request.Header.Set("Authorization", "Bearer "+token)
+			}
+
+			assert.Equal(t, tt.statusCode, serve(request).StatusCode)
+		})
+	}
+}
+
+func TestRouterCSRFCookieRenewal(t *testing.T) {
+	auth.SetLifetime(2*time.Second, 30*24*time.Hour)
+	defer auth.SetLifetime(0, 30*24*time.Hour)
+
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	server := httptest.NewServer(router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+		Address:             "localhost:8080",
+		BaseShortURLAddress: "http://localhost",
+	}, nil)).Router)
+	defer server.Close()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	shorten := func(originalURL string) int {
+		request, err := http.NewRequest(http.MethodPost, server.URL+"/", strings.NewReader(originalURL))
+		require.NoError(t, err)
+
+		for _, cookie := range jar.Cookies(request.URL) {
+			if cookie.Name == middleware.CSRFCookieName {
+				request.Header.Set(middleware.CSRFHeader, cookie.Value)
+			}
+		}
+
+		result, err := client.Do(request)
+		require.NoError(t, err)
+		result.Body.Close()
+
+		return result.StatusCode
+	}
+
+	result, err := client.Get(server.URL + "/")
+	require.NoError(t, err)
+	result.Body.Close()
+
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, http.StatusCreated, shorten("https://practicum.yandex.ru/1"))
+
+	// Первая куки с CSRF-токеном уже истекла, но запрос продлил ее вместе с куки токена.
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, http.StatusCreated, shorten("https://practicum.yandex.ru/2"))
+}
+
+func TestRouterLogoutHandler(t *testing.T) {
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	token, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+
+	session, err := auth.ParseJWTToken(token)
+	require.NoError(t, err)
+
+	renewedToken, err := auth.RenewJWTToken(session)
+	require.NoError(t, err)
+
+	otherToken, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+
+	serve := func(method string, target string, bearer string, cookie string) *http.Response {
+		request := httptest.NewRequest(method, target, nil)
+		if bearer != "" {
+			request.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		if cookie != "" {
+			addSessionCookie(request, cookie)
+		}
+
+		recorder := httptest.NewRecorder()
+		router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+			Address:             "localhost:8080",
+			BaseShortURLAddress: "http://localhost",
+		}, nil)).Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+		result.Body.Close()
+
+		return result
+	}
+
+	result := serve(http.MethodPost, "/api/user/logout", "", "")
+	assert.Equal(t, http.StatusUnauthorized, result.StatusCode, "logout without token")
+
+	result = serve(http.MethodPost, "/api/user/logout", "", token)
+	require.Equal(t, http.StatusNoContent, result.StatusCode)
+
+	var clearedCookie *http.Cookie
+	for _, cookie := range result.Cookies() {
+		if cookie.Name == middleware.TokenCookieName {
+			clearedCookie = cookie
+		}
+	}
+
+	require.NotNil(t, clearedCookie)
+	assert.Negative(t, clearedCookie.MaxAge, "logout must clear the token cookie")
+
+	tests := []struct {
+		name            string
+		method          string
+		request         string
+		bearer          string
+		cookie          string
+		statusCode      int
+		wwwAuthenticate string
+	}{
+		{
+			name:            "revoked token",
+			method:          http.MethodGet,
+			request:         "/api/user/urls",
+			bearer:          token,
+			statusCode:      http.StatusUnauthorized,
+			wwwAuthenticate: `Bearer realm="shortener", error="invalid_token"`,
+		},
+		{
+			name:            "renewed token of revoked session",
+			method:          http.MethodGet,
+			request:         "/api/user/urls",
+			bearer:          renewedToken,
+			statusCode:      http.StatusUnauthorized,
+			wwwAuthenticate: `Bearer realm="shortener", error="invalid_token"`,
+		},
+		{
+			name:            "refresh revoked token",
+			method:          http.MethodPost,
+			request:         "/api/auth/refresh",
+			cookie:          renewedToken,
+			statusCode:      http.StatusUnauthorized,
+			wwwAuthenticate: `Bearer realm="shortener", error="invalid_token"`,
+		},
+		{
+			name:       "token of another session",
+			method:     http.MethodGet,
+			request:    "/api/user/urls",
+			bearer:     otherToken,
+			statusCode: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := serve(tt.method, tt.request, tt.bearer, tt.cookie)
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			assert.Equal(t, tt.wwwAuthenticate, result.Header.Get("WWW-Authenticate"))
+		})
+	}
+
+	result = serve(http.MethodGet, "/api/user/urls", "", token)
+
+	newToken := tokenCookie(result)
+	require.NotEmpty(t, newToken, "revoked cookie must be replaced with a new user")
+
+	newUserID, err := auth.GetUserID(newToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, session.UserID, newUserID)
+}
+
+func TestRouterRateLimit(t *testing.T) {
+	middleware.SetRateLimitStore(ratelimit.NewMemoryStore())
+	middleware.ConfigureRateLimits(config.Config{
+		RateLimitShorten: 2,
+		RateLimitBatch:   3,
+		RateLimitImport:  1,
+	})
+	defer middleware.ConfigureRateLimits(config.Config{})
+
+	defaultStorage, err := storage.GetStorage(config.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	token, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+
+	otherToken, err := auth.BuildJWTToken()
+	require.NoError(t, err)
+
+	serve := func(target string, body string, bearer string, remoteAddr string) *http.Response {
+		request := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		request.RemoteAddr = remoteAddr
+		if bearer != "" {
+			request.Header.Set("Authorization", "Bearer "+bearer)
+		}
+
+		recorder := httptest.NewRecorder()
+		router.NewRouter(handler.NewHandler(defaultStorage, config.Config{
+			Address:             "localhost:8080",
+			BaseShortURLAddress: "http://localhost",
+		}, nil)).Router.ServeHTTP(recorder, request)
+
+		result := recorder.Result()
+		result.Body.Close()
+
+		return result
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		bearer     string
+		remoteAddr string
+		statusCode int
+		remaining  string
+		retryAfter string
+	}{
+		{
+			name:       "first shorten of user",
+			target:     "/",
+			body:       "https://practicum.yandex.ru/1",
+			bearer:     token,
+			remoteAddr: "192.0.2.1:1234",
+			statusCode: http.StatusCreated,
+			remaining:  "1",
+		},
+		{
+			name:       "second shorten of user",
+			target:     "/api/shorten",
+			body:       `{"url":"https://practicum.yandex.ru/2"}`,
+			bearer:     token,
+			remoteAddr: "192.0.2.1:1234",
+			statusCode: http.StatusCreated,
+			remaining:  "0",
+		},
+		{
+			name:       "limit exceeded",
+			target:     "/",
+			body:       "https://practicum.yandex.ru/3",
+			bearer:     token,
+			remoteAddr: "192.0.2.1:1234",
+			statusCode: http.StatusTooManyRequests,
+			remaining:  "0",
+			retryAfter: "30",
+		},
+		{
+			name:       "other user from same address",
+			target:     "/",
+			body:       "https://practicum.yandex.ru/4",
+			bearer:     otherToken,
+			remoteAddr: "192.0.2.1:1234",
+			statusCode: http.StatusCreated,
+			remaining:  "1",
+		},
+		{
+			name:       "anonymous clients limited by address",
+			target:     "/",
+			body:       "https://practicum.yandex.ru/5",
+			remoteAddr: "192.0.2.2:1234",
+			statusCode: http.StatusCreated,
+			remaining:  "1",
+		},
+		{
+			name:       "anonymous clients limited by address without cookie",
+			target:     "/",
+			body:       "https://practicum.yandex.ru/6",
+			remoteAddr: "192.0.2.2:4321",
+			statusCode: http.StatusCreated,
+			remaining:  "0",
+		},
+		{
+			name:       "batch costs one token per url",
+			target:     "/api/shorten/batch",
+			body:       `[{"correlation_id":"1","original_url":"https://practicum.yandex.ru/7"},{"correlation_id":"2","original_url":"https://practicum.yandex.ru/8"}]`,
+			bearer:     token,
+			remoteAddr: "192.0.2.1:1234",
+			statusCode: http.StatusCreated,
+			remaining:  "1",
+		},
+		{
+			name:       "batch larger than remaining",
+			target:     "/api/shorten/batch",
+			body:       `[{"correlation_id":"1","original_url":"https://practicum.yandex.ru/9"},{"correlation_id":"2","original_url":"https://practicum.yandex.ru/10"}]`,
+			bearer:     token,
+			remoteAddr: "192.0.2.1:1234",
+			statusCode: http.StatusTooManyRequests,
+			remaining:  "1",
+			retryAfter: "20",
+		},
+		{
+			name:       "batch larger than limit",
+			target:     "/api/shorten/batch",
+			body:       `[{"original_url":"https://a.ru"},{"original_url":"https://b.ru"},{"original_url":"https://c.ru"},{"original_url":"https://d.ru"}]`,
+			bearer:     otherToken,
+			remoteAddr: "192.0.2.1:1234",
+			statusCode: http.StatusRequestEntityTooLarge,
+			remaining:  "3",
+		},
+		{
+			name:       "import costs one token regardless of rows",
+			target:     "/api/shorten/import",
+			body:       "{\"original_url\":\"https://practicum.yandex.ru/12\"}\n{\"original_url\":\"https://practicum.yandex.ru/13\"}\n{\"original_url\":\"https://practicum.yandex.ru/14\"}\n{\"original_url\":\"https://practicum.yandex.ru/15\"}\n",
+			bearer:     token,
+			remoteAddr: "192.0.2.1:1234",
+			statusCode: http.StatusOK,
+			remaining:  "0",
+		},
+		{
+			name:       "import limit exceeded",
+			target:     "/api/shorten/import",
+			body:       "{\"original_url\":\"https://practicum.yandex.ru/16\"}\n",
+			bearer:     token,
+			remoteAddr: "192.0.2.1:1234",
+			statusCode: http.StatusTooManyRequests,
+			remaining:  "0",
+			retryAfter: "60",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := serve(tt.target, tt.body, tt.bearer, tt.remoteAddr)
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			assert.Equal(t, tt.remaining, result.Header.Get("RateLimit-Remaining"))
+			assert.Equal(t, tt.retryAfter, result.Header.Get("Retry-After"))
+			assert.NotEmpty(t, result.Header.Get("RateLimit-Limit"))
+			assert.NotEmpty(t, result.Header.Get("RateLimit-Reset"))
+		})
+	}
+
+	middleware.ConfigureRateLimits(config.Config{})
+
+	result := serve("/", "https://practicum.yandex.ru/11", token, "192.0.2.1:1234")
+	assert.Equal(t, http.StatusCreated, result.StatusCode, "limits are disabled by default")
+	assert.Empty(t, result.Header.Get("RateLimit-Limit"))
+}
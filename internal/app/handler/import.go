@@ -0,0 +1,563 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/VladKvetkin/shortener/internal/app/entities"
+	"github.com/VladKvetkin/shortener/internal/app/middleware"
+	"github.com/VladKvetkin/shortener/internal/app/models"
+	"github.com/VladKvetkin/shortener/internal/app/shortener"
+)
+
+const (
+	// importChunkSize - количество строк импорта, которые сокращаются одним вызовом AddBatch.
+	importChunkSize = 1000
+	// maxImportLineSize - максимальный размер строки NDJSON при импорте.
+	maxImportLineSize = 1 << 20
+
+	importStatusCreated = "created"
+	importStatusExists  = "exists"
+	importStatusInvalid = "invalid"
+	importStatusFailed  = "failed"
+	// importStatusError - последняя строка отчета, если тело импорта не удалось дочитать.
+	importStatusError = "error"
+)
+
+var (
+	// ErrEmptyOriginalURL - ошибка, которая означает, что в строке импорта нет оригинальной ссылки.
+	ErrEmptyOriginalURL = errors.New("original url is empty")
+	// ErrImportLineTooLong - ошибка, которая означает, что строка NDJSON длиннее maxImportLineSize.
+	ErrImportLineTooLong = errors.New("line is too long")
+	// ErrUnsupportedImportFormat - ошибка, которая означает, что формат импорта не поддерживается.
+	ErrUnsupportedImportFormat = errors.New("unsupported import format")
+)
+
+// importRow - строка импорта. Если строку не удалось разобрать, то err содержит причину.
+type importRow struct {
+	line   int
+	record models.APIShortenImportRecord
+	err    error
+}
+
+// importReader - интерфейс построчного чтения импорта. В конце импорта возвращает io.EOF.
+type importReader interface {
+	Read() (importRow, error)
+}
+
+type ndjsonImportReader struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func newNDJSONImportReader(r io.Reader) *ndjsonImportReader {
+	return &ndjsonImportReader{
+		reader: bufio.NewReaderSize(r, 64*1024),
+	}
+}
+
+// Read возвращает следующую непустую строку. Строка длиннее maxImportLineSize пропускается до конца
+// и возвращается с ошибкой ErrImportLineTooLong, чтобы импорт продолжился со следующей строки.
+func (r *ndjsonImportReader) Read() (importRow, error) {
+	for {
+		line, tooLong, err := r.readLine()
+		if err != nil {
+			return importRow{}, err
+		}
+
+		r.line++
+
+		if tooLong {
+			return importRow{line: r.line, err: ErrImportLineTooLong}, nil
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		row := importRow{line: r.line}
+		row.err = json.Unmarshal(line, &row.record)
+
+		return row, nil
+	}
+}
+
+// readLine читает строку целиком, не храня в памяти больше maxImportLineSize байт.
+// В конце тела возвращает io.EOF.
+func (r *ndjsonImportReader) readLine() ([]byte, bool, error) {
+	var line []byte
+
+	read := false
+	tooLong := false
+
+	for {
+		chunk, err := r.reader.ReadSlice('\n')
+		read = read || len(chunk) > 0
+
+		if !tooLong {
+			if len(line)+len(chunk) > maxImportLineSize {
+				tooLong = true
+				line = nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+
+		switch {
+		case err == nil:
+			return line, tooLong, nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF) && read:
+			return line, tooLong, nil
+		default:
+			return nil, false, err
+		}
+	}
+}
+
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+	pending []string
+}
+
+// newCSVImportReader - конструктор csvImportReader.
+// Если первая строка содержит колонку original_url, то она считается заголовком,
+// иначе оригинальная ссылка берется из первой колонки каждой строки.
+func newCSVImportReader(r io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	importReader := &csvImportReader{
+		reader:  reader,
+		columns: map[string]int{"original_url": 0},
+	}
+
+	firstRecord, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return importReader, nil
+		}
+
+		return nil, err
+	}
+
+	header := make(map[string]int, len(firstRecord))
+	for i, column := range firstRecord {
+		header[strings.TrimSpace(column)] = i
+	}
+
+	if _, ok := header["original_url"]; ok {
+		importReader.columns = header
+	} else {
+		importReader.pending = firstRecord
+	}
+
+	return importReader, nil
+}
+
+func (r *csvImportReader) Read() (importRow, error) {
+	record := r.pending
+	r.pending = nil
+
+	line := 1
+	if record == nil {
+		var err error
+
+		record, err = r.reader.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return importRow{line: parseErr.StartLine, err: err}, nil
+			}
+
+			return importRow{}, err
+		}
+
+		line, _ = r.reader.FieldPos(0)
+	}
+
+	tags := r.column(record, "tags")
+
+	row := importRow{
+		line: line,
+		record: models.APIShortenImportRecord{
+			OriginalURL: r.column(record, "original_url"),
+			URLMetadata: models.URLMetadata{
+				Title: r.column(record, "title"),
+				Notes: r.column(record, "notes"),
+			},
+		},
+	}
+
+	if tags != "" {
+		row.record.Tags = strings.Split(tags, ",")
+	}
+
+	if redirectStatus := r.column(record, "redirect_status"); redirectStatus != "" {
+		row.record.RedirectStatus, row.err = strconv.Atoi(redirectStatus)
+	}
+
+	row.record.QueryMode = r.column(record, "query_mode")
+
+	if targets := r.column(record, "targets"); targets != "" && row.err == nil {
+		row.err = json.Unmarshal([]byte(targets), &row.record.Targets)
+	}
+
+	if expiresAt := r.column(record, "expires_at"); expiresAt != "" && row.err == nil {
+		parsedExpiresAt, err := time.Parse(time.RFC3339Nano, expiresAt)
+		if err != nil {
+			row.err = err
+		} else {
+			row.record.ExpiresAt = &parsedExpiresAt
+		}
+	}
+
+	if defaultQuery := r.column(record, "default_query"); defaultQuery != "" && row.err == nil {
+		if _, err := neturl.ParseQuery(defaultQuery); err != nil {
+			row.err = err
+		} else {
+			row.record.DefaultQuery = parseDefaultQuery(defaultQuery)
+		}
+	}
+
+	return row, nil
+}
+
+func (r *csvImportReader) column(record []string, name string) string {
+	i, ok := r.columns[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+
+	return record[i]
+}
+
+// APIShortenImportHandler – функция-обработчик, которая сокращает ссылки из CSV или NDJSON, переданных в теле запроса.
+// Строки читаются потоково и сокращаются пачками через AddBatch. В ответе возвращается построчный отчет в формате NDJSON,
+// итоговые количества передаются в заголовках X-Import-Created, X-Import-Exists, X-Import-Invalid и X-Import-Failed.
+// Строки, которые не удалось разобрать, попадают в отчет как invalid. Если тело не удалось дочитать,
+// то отчет по уже обработанным строкам завершается строкой со статусом error.
+func (h *Handler) APIShortenImportHandler(res http.ResponseWriter, req *http.Request) {
+	userID, ok := req.Context().Value(middleware.UserIDKey{}).(string)
+	if !ok {
+		http.Error(res, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	domain, err := h.requestDomain(req)
+	if err != nil {
+		http.Error(res, "Unknown domain", http.StatusBadRequest)
+		return
+	}
+
+	responseController := http.NewResponseController(res)
+	if err := responseController.SetReadDeadline(time.Time{}); err != nil {
+		zap.L().Sugar().Debugw(
+			"Cannot disable read deadline for import",
+			"err", err,
+		)
+	}
+
+	reader, err := newImportReader(req)
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedImportFormat) {
+			http.Error(res, "Unsupported import format", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		http.Error(res, "Cannot read import body", http.StatusBadRequest)
+		return
+	}
+
+	// Отчет может быть большим, поэтому он копится во временном файле, а не в памяти.
+	report, err := os.CreateTemp("", "shortener-import-*.ndjson")
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	defer os.Remove(report.Name())
+	defer report.Close()
+
+	reportWriter := bufio.NewWriter(report)
+	reportEncoder := json.NewEncoder(reportWriter)
+	summary := make(map[string]int)
+
+	writeResults := func(results []models.APIShortenImportResult) error {
+		for _, result := range results {
+			summary[result.Status]++
+
+			if err := reportEncoder.Encode(result); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	chunk := make([]importRow, 0, importChunkSize)
+
+	// readErr - ошибка, после которой тело импорта нельзя дочитать. Сокращенные до нее строки уже сохранены,
+	// поэтому клиент получает отчет по ним и последнюю строку отчета с ошибкой.
+	var readErr error
+
+	for {
+		row, err := reader.Read()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				readErr = err
+			}
+
+			break
+		}
+
+		chunk = append(chunk, row)
+		if len(chunk) < importChunkSize {
+			continue
+		}
+
+		if err := writeResults(h.importChunk(req.Context(), domain.key, chunk, userID)); err != nil {
+			http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		chunk = chunk[:0]
+	}
+
+	if err := writeResults(h.importChunk(req.Context(), domain.key, chunk, userID)); err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if readErr != nil {
+		zap.L().Sugar().Warnw(
+			"Cannot read import body",
+			"err", readErr,
+			"user_id", userID,
+		)
+
+		if err := reportEncoder.Encode(models.APIShortenImportResult{
+			Status: importStatusError,
+			Error:  "Cannot read import body: " + readErr.Error(),
+		}); err != nil {
+			http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := reportWriter.Flush(); err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := report.Seek(0, io.SeekStart); err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/x-ndjson")
+	res.Header().Set("X-Import-Created", strconv.Itoa(summary[importStatusCreated]))
+	res.Header().Set("X-Import-Exists", strconv.Itoa(summary[importStatusExists]))
+	res.Header().Set("X-Import-Invalid", strconv.Itoa(summary[importStatusInvalid]))
+	res.Header().Set("X-Import-Failed", strconv.Itoa(summary[importStatusFailed]))
+	res.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(res, report); err != nil {
+		zap.L().Sugar().Errorw(
+			"Cannot send import report",
+			"err", err,
+			"user_id", userID,
+		)
+	}
+}
+
+func newImportReader(req *http.Request) (importReader, error) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+
+		switch mediaType {
+		case "text/csv":
+			format = exportFormatCSV
+		case "application/x-ndjson", "application/jsonl", "application/json", "":
+			format = exportFormatNDJSON
+		}
+	}
+
+	switch format {
+	case exportFormatCSV:
+		return newCSVImportReader(req.Body)
+	case exportFormatNDJSON:
+		return newNDJSONImportReader(req.Body), nil
+	default:
+		return nil, ErrUnsupportedImportFormat
+	}
+}
+
+// importChunk - функция, которая сокращает пачку строк импорта в домене domain и возвращает результат по каждой строке.
+func (h *Handler) importChunk(ctx context.Context, domain string, chunk []importRow, userID string) []models.APIShortenImportResult {
+	if len(chunk) == 0 {
+		return nil
+	}
+
+	results := make([]models.APIShortenImportResult, len(chunk))
+	urls := make([]entities.URL, len(chunk))
+	originalURLs := make([]string, 0, len(chunk))
+
+	for i, row := range chunk {
+		results[i] = models.APIShortenImportResult{
+			Line:        row.line,
+			OriginalURL: row.record.OriginalURL,
+		}
+
+		urls[i].Domain = domain
+
+		if err := h.prepareImportURL(&urls[i], row, userID); err != nil {
+			results[i].Status = importStatusInvalid
+			results[i].Error = err.Error()
+			continue
+		}
+
+		originalURLs = append(originalURLs, urls[i].OriginalURL)
+	}
+
+	if len(originalURLs) == 0 {
+		return results
+	}
+
+	existingURLs, err := h.storage.ReadByOriginalURLs(ctx, domain, originalURLs)
+	if err != nil {
+		return failImportChunk(results, err)
+	}
+
+	// shortURLs хранит сокращенные ссылки оригинальных ссылок, которые уже есть в базе данных или в этой пачке.
+	shortURLs := make(map[string]string, len(originalURLs))
+	for _, url := range existingURLs {
+		shortURLs[url.OriginalURL] = url.ShortURL
+	}
+
+	ids := make([]string, 0, len(originalURLs))
+	for i := range chunk {
+		if results[i].Status != "" {
+			continue
+		}
+
+		if _, ok := shortURLs[urls[i].OriginalURL]; ok {
+			continue
+		}
+
+		id, err := shortener.CreateID(urls[i].OriginalURL)
+		if err != nil {
+			return failImportChunk(results, err)
+		}
+
+		urls[i].ShortURL = id
+		ids = append(ids, id)
+	}
+
+	takenURLs, err := h.storage.ReadByIDs(ctx, domain, ids)
+	if err != nil {
+		return failImportChunk(results, err)
+	}
+
+	takenIDs := make(map[string]struct{}, len(takenURLs))
+	for _, url := range takenURLs {
+		takenIDs[url.ShortURL] = struct{}{}
+	}
+
+	newURLs := make([]entities.URL, 0, len(ids))
+	newRows := make([]int, 0, len(ids))
+
+	for i := range chunk {
+		if results[i].Status != "" {
+			continue
+		}
+
+		if shortURL, ok := shortURLs[urls[i].OriginalURL]; ok {
+			results[i].Status = importStatusExists
+			results[i].ShortURL = h.formatShortURL(domain, shortURL)
+			continue
+		}
+
+		if _, ok := takenIDs[urls[i].ShortURL]; ok {
+			id, err := h.createUniqueID(ctx, domain, urls[i].OriginalURL, takenIDs)
+			if err != nil {
+				results[i].Status = importStatusFailed
+				results[i].Error = err.Error()
+				continue
+			}
+
+			urls[i].ShortURL = id
+		}
+
+		takenIDs[urls[i].ShortURL] = struct{}{}
+		shortURLs[urls[i].OriginalURL] = urls[i].ShortURL
+
+		newURLs = append(newURLs, urls[i])
+		newRows = append(newRows, i)
+	}
+
+	if err := h.storage.AddBatch(ctx, newURLs); err != nil {
+		for _, i := range newRows {
+			results[i].Status = importStatusFailed
+			results[i].Error = err.Error()
+		}
+
+		return results
+	}
+
+	for _, i := range newRows {
+		results[i].Status = importStatusCreated
+		results[i].ShortURL = h.formatShortURL(domain, urls[i].ShortURL)
+	}
+
+	return results
+}
+
+func (h *Handler) prepareImportURL(url *entities.URL, row importRow, userID string) error {
+	if row.err != nil {
+		return row.err
+	}
+
+	if row.record.OriginalURL == "" {
+		return ErrEmptyOriginalURL
+	}
+
+	originalURL, err := h.prepareOriginalURL(row.record.OriginalURL)
+	if err != nil {
+		return err
+	}
+
+	url.OriginalURL = originalURL
+	url.UserID = userID
+
+	return h.applyMetadata(url, row.record.URLMetadata)
+}
+
+// failImportChunk - функция, которая помечает все необработанные строки пачки как неуспешные.
+func failImportChunk(results []models.APIShortenImportResult, err error) []models.APIShortenImportResult {
+	for i := range results {
+		if results[i].Status == "" {
+			results[i].Status = importStatusFailed
+			results[i].Error = err.Error()
+		}
+	}
+
+	return results
+}
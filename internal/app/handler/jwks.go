@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/VladKvetkin/shortener/internal/app/auth"
+)
+
+// jwksCacheMaxAge - время в секундах, на которое другие сервисы могут закешировать открытые ключи.
+// Оно должно быть меньше срока, в течение которого предыдущий ключ остается в наборе после ротации.
+const jwksCacheMaxAge = 300
+
+// JWKSHandler – функция-обработчик, которая отдает открытые ключи для проверки JWT-токенов в формате JWKS.
+func (h *Handler) JWKSHandler(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", jwksCacheMaxAge))
+	res.WriteHeader(http.StatusOK)
+
+	jsonEncoder := json.NewEncoder(res)
+	if err := jsonEncoder.Encode(auth.JWKS()); err != nil {
+		http.Error(res, "Cannot encode response JSON body", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"errors"
+	neturl "net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/VladKvetkin/shortener/internal/app/entities"
+	"github.com/VladKvetkin/shortener/internal/app/models"
+)
+
+const (
+	maxTitleLength = 255
+	maxNotesLength = 4096
+	maxTagLength   = 64
+	maxTagsCount   = 20
+
+	maxDefaultQueryLength = 2048
+)
+
+var (
+	// ErrInvalidMetadata - ошибка, которая означает, что метаданные сокращенной ссылки заданы неверно.
+	ErrInvalidMetadata = errors.New("invalid url metadata")
+)
+
+// applyMetadata - функция, которая проверяет метаданные и записывает их в url.
+// Теги приводятся к нижнему регистру, пустые и повторяющиеся теги отбрасываются.
+func (h *Handler) applyMetadata(url *entities.URL, metadata models.URLMetadata) error {
+	title := strings.TrimSpace(metadata.Title)
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return ErrInvalidMetadata
+	}
+
+	if utf8.RuneCountInString(metadata.Notes) > maxNotesLength {
+		return ErrInvalidMetadata
+	}
+
+	tags := make([]string, 0, len(metadata.Tags))
+	seenTags := make(map[string]struct{}, len(metadata.Tags))
+
+	for _, tag := range metadata.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return ErrInvalidMetadata
+		}
+
+		if _, ok := seenTags[tag]; ok {
+			continue
+		}
+
+		seenTags[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+
+	if len(tags) > maxTagsCount {
+		return ErrInvalidMetadata
+	}
+
+	if metadata.RedirectStatus != 0 && !isRedirectStatus(metadata.RedirectStatus) {
+		return ErrInvalidMetadata
+	}
+
+	switch metadata.QueryMode {
+	case "", entities.QueryModeIgnore, entities.QueryModeDefaults, entities.QueryModePassThrough:
+	default:
+		return ErrInvalidMetadata
+	}
+
+	if _, ok := metadata.DefaultQuery[""]; ok {
+		return ErrInvalidMetadata
+	}
+
+	defaultQuery := encodeDefaultQuery(metadata.DefaultQuery)
+	if len(defaultQuery) > maxDefaultQueryLength {
+		return ErrInvalidMetadata
+	}
+
+	targets, err := h.prepareTargets(metadata.Targets)
+	if err != nil {
+		return ErrInvalidMetadata
+	}
+
+	if metadata.ExpiresAt != nil && !metadata.ExpiresAt.After(time.Now()) {
+		return ErrInvalidMetadata
+	}
+
+	url.Title = title
+	url.Tags = tags
+	url.Notes = metadata.Notes
+	url.RedirectStatus = metadata.RedirectStatus
+	url.QueryMode = metadata.QueryMode
+	url.DefaultQuery = defaultQuery
+	url.Targets = targets
+	url.ExpiresAt = metadata.ExpiresAt
+
+	return nil
+}
+
+func userURLMetadata(url entities.URL) models.URLMetadata {
+	return models.URLMetadata{
+		Title:          url.Title,
+		Tags:           url.Tags,
+		Notes:          url.Notes,
+		RedirectStatus: url.RedirectStatus,
+		QueryMode:      url.QueryMode,
+		DefaultQuery:   parseDefaultQuery(url.DefaultQuery),
+		Targets:        url.Targets,
+		ExpiresAt:      url.ExpiresAt,
+	}
+}
+
+// encodeDefaultQuery кодирует параметры по умолчанию в строку запроса с отсортированными ключами.
+func encodeDefaultQuery(defaultQuery map[string]string) string {
+	values := make(neturl.Values, len(defaultQuery))
+	for key, value := range defaultQuery {
+		values.Set(key, value)
+	}
+
+	return values.Encode()
+}
+
+// parseDefaultQuery разбирает сохраненные параметры по умолчанию. Для повторяющихся параметров берется первое значение.
+func parseDefaultQuery(rawQuery string) map[string]string {
+	values, _ := neturl.ParseQuery(rawQuery)
+	if len(values) == 0 {
+		return nil
+	}
+
+	defaultQuery := make(map[string]string, len(values))
+	for key := range values {
+		defaultQuery[key] = values.Get(key)
+	}
+
+	return defaultQuery
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/VladKvetkin/shortener/internal/app/models"
+)
+
+// Имена страниц. Страница переопределяется файлом <имя>.html в директории шаблонов из конфигурации.
+const (
+	pageLanding  = "landing"
+	pageNotFound = "not_found"
+	pageGone     = "gone"
+	pageExpired  = "expired"
+	pageBlocked  = "blocked"
+)
+
+// defaultErrorPage - встроенный шаблон страниц ошибок.
+const defaultErrorPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex, nofollow">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+<p><a href="/">Go to the main page</a></p>
+</body>
+</html>
+`
+
+// defaultLandingPage - встроенный шаблон главной страницы.
+const defaultLandingPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>URL shortener</title>
+</head>
+<body>
+<h1>URL shortener</h1>
+<p>Send a POST request with a link to <code>{{.BaseURL}}/api/shorten</code> to get a short link.</p>
+</body>
+</html>
+`
+
+var defaultPageSources = map[string]string{
+	pageLanding:  defaultLandingPage,
+	pageNotFound: defaultErrorPage,
+	pageGone:     defaultErrorPage,
+	pageExpired:  defaultErrorPage,
+	pageBlocked:  defaultErrorPage,
+}
+
+// pageData - данные, которые передаются в шаблоны страниц.
+type pageData struct {
+	Status  int
+	Title   string
+	Message string
+	// ID - сокращенная ссылка, по которой пришел запрос. Пустая для главной страницы.
+	ID      string
+	BaseURL string
+}
+
+// loadPages - функция, которая загружает шаблоны страниц. Если dir пустой или в нем нет файла страницы,
+// то используется встроенный шаблон.
+func loadPages(dir string) (map[string]*template.Template, error) {
+	pages := make(map[string]*template.Template, len(defaultPageSources))
+
+	for name, source := range defaultPageSources {
+		if dir != "" {
+			content, err := os.ReadFile(filepath.Join(dir, name+".html"))
+			if err == nil {
+				source = string(content)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+
+		page, err := template.New(name).Parse(source)
+		if err != nil {
+			return nil, err
+		}
+
+		pages[name] = page
+	}
+
+	return pages, nil
+}
+
+// defaultPages - функция, которая возвращает встроенные шаблоны страниц.
+func defaultPages() map[string]*template.Template {
+	pages, err := loadPages("")
+	if err != nil {
+		panic(err)
+	}
+
+	return pages
+}
+
+// wantJSON - функция, которая проверяет, что клиент ожидает ответ в формате JSON.
+func wantJSON(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "application/json")
+}
+
+// LandingHandler – функция-обработчик, которая отдает главную страницу.
+func (h *Handler) LandingHandler(res http.ResponseWriter, req *http.Request) {
+	h.sendPage(res, pageLanding, http.StatusOK, pageData{
+		Status:  http.StatusOK,
+		BaseURL: h.domains.byHost(req.Host).baseURL,
+	})
+}
+
+// sendErrorPage - функция, которая отдает ошибку в формате JSON, если клиент его ожидает, иначе HTML-страницу.
+// Имя страницы используется как код ошибки в JSON.
+func (h *Handler) sendErrorPage(res http.ResponseWriter, req *http.Request, name string, data pageData) {
+	res.Header().Add("Vary", "Accept")
+
+	if wantJSON(req) {
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(data.Status)
+
+		responseModel := models.APIErrorResponse{
+			Code:    name,
+			Message: data.Message,
+		}
+
+		if err := json.NewEncoder(res).Encode(responseModel); err != nil {
+			http.Error(res, "Cannot encode response JSON body", http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	h.sendPage(res, name, data.Status, data)
+}
+
+// sendPage отрисовывает страницу целиком до отправки, чтобы ошибка в пользовательском шаблоне не оборвала ответ.
+func (h *Handler) sendPage(res http.ResponseWriter, name string, status int, data pageData) {
+	var page bytes.Buffer
+
+	if err := h.pages[name].Execute(&page, data); err != nil {
+		zap.L().Sugar().Errorw(
+			"Cannot render page",
+			"err", err,
+			"page", name,
+		)
+
+		http.Error(res, http.StatusText(status), status)
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.WriteHeader(status)
+	res.Write(page.Bytes())
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VladKvetkin/shortener/internal/app/storage"
+)
+
+const (
+	// defaultUserURLsLimit - размер страницы сокращенных ссылок пользователя по умолчанию.
+	defaultUserURLsLimit = 100
+	// maxUserURLsLimit - максимальный размер страницы сокращенных ссылок пользователя.
+	maxUserURLsLimit = 1000
+)
+
+var (
+	// ErrInvalidQuery - ошибка, которая означает, что параметры выборки заданы неверно.
+	ErrInvalidQuery = errors.New("invalid query parameters")
+)
+
+type cursorPayload struct {
+	CreatedAt int64  `json:"t"`
+	ShortURL  string `json:"s"`
+	Domain    string `json:"d,omitempty"`
+}
+
+// parseUserURLsQuery - функция, которая разбирает параметры выборки сокращенных ссылок пользователя:
+// limit, cursor, order (asc или desc), search, tag и include_deleted.
+func parseUserURLsQuery(values url.Values, userID string) (storage.UserURLsQuery, error) {
+	query := storage.UserURLsQuery{
+		UserID: userID,
+		Limit:  defaultUserURLsLimit,
+		Desc:   true,
+		Search: values.Get("search"),
+		Tag:    strings.ToLower(strings.TrimSpace(values.Get("tag"))),
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		parsedLimit, err := strconv.Atoi(limit)
+		if err != nil || parsedLimit <= 0 || parsedLimit > maxUserURLsLimit {
+			return storage.UserURLsQuery{}, ErrInvalidQuery
+		}
+
+		query.Limit = parsedLimit
+	}
+
+	switch values.Get("order") {
+	case "", "desc":
+	case "asc":
+		query.Desc = false
+	default:
+		return storage.UserURLsQuery{}, ErrInvalidQuery
+	}
+
+	if includeDeleted := values.Get("include_deleted"); includeDeleted != "" {
+		parsedIncludeDeleted, err := strconv.ParseBool(includeDeleted)
+		if err != nil {
+			return storage.UserURLsQuery{}, ErrInvalidQuery
+		}
+
+		query.IncludeDeleted = parsedIncludeDeleted
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		parsedCursor, err := decodeCursor(cursor)
+		if err != nil {
+			return storage.UserURLsQuery{}, ErrInvalidQuery
+		}
+
+		query.Cursor = &parsedCursor
+	}
+
+	return query, nil
+}
+
+func encodeCursor(cursor storage.Cursor) string {
+	payload, _ := json.Marshal(cursorPayload{
+		CreatedAt: cursor.CreatedAt.UnixNano(),
+		ShortURL:  cursor.ShortURL,
+		Domain:    cursor.Domain,
+	})
+
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func decodeCursor(cursor string) (storage.Cursor, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return storage.Cursor{}, err
+	}
+
+	var decoded cursorPayload
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		return storage.Cursor{}, err
+	}
+
+	if decoded.ShortURL == "" {
+		return storage.Cursor{}, ErrInvalidQuery
+	}
+
+	return storage.Cursor{
+		CreatedAt: time.Unix(0, decoded.CreatedAt).UTC(),
+		ShortURL:  decoded.ShortURL,
+		Domain:    decoded.Domain,
+	}, nil
+}
+
+// nextPageLink - функция, которая формирует значение заголовка Link со ссылкой на следующую страницу.
+func nextPageLink(requestURL *url.URL, cursor storage.Cursor) string {
+	values := requestURL.Query()
+	values.Set("cursor", encodeCursor(cursor))
+
+	nextURL := url.URL{
+		Path:     requestURL.Path,
+		RawQuery: values.Encode(),
+	}
+
+	return "<" + nextURL.String() + `>; rel="next"`
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/VladKvetkin/shortener/internal/app/middleware"
+	"github.com/VladKvetkin/shortener/internal/app/models"
+	"github.com/VladKvetkin/shortener/internal/app/policy"
+)
+
+// previewSuffix - суффикс сокращенной ссылки, по которому вместо перенаправления отдается предпросмотр.
+const previewSuffix = "+"
+
+// previewTemplate - страница предпросмотра сокращенной ссылки.
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex, nofollow">
+<title>Preview of {{.ShortURL}}</title>
+</head>
+<body>
+<h1>{{if .Title}}{{.Title}}{{else}}{{.ShortURL}}{{end}}</h1>
+{{- if .FlaggedFlag}}
+<p><strong>This link has been flagged as potentially unsafe.</strong></p>
+{{- end}}
+<p>This short link leads to:</p>
+<p><code>{{.OriginalURL}}</code></p>
+<p>Created: {{.CreatedAt.UTC.Format "2006-01-02 15:04:05 MST"}}</p>
+{{- if .Tags}}
+<p>Tags: {{range $i, $tag := .Tags}}{{if $i}}, {{end}}{{$tag}}{{end}}</p>
+{{- end}}
+{{- if .Notes}}
+<p>Notes: {{.Notes}}</p>
+{{- end}}
+<p><a href="{{.OriginalURL}}" rel="noopener noreferrer nofollow">Continue</a></p>
+</body>
+</html>
+`))
+
+// previewURL отдает предпросмотр сокращенной ссылки в формате JSON, если клиент его запрашивает, иначе в HTML.
+func (h *Handler) previewURL(res http.ResponseWriter, req *http.Request, domain shortDomain, id string) {
+	url, decision, err := h.resolveURL(req.Context(), domain.key, id)
+	if err != nil {
+		h.sendResolveError(res, req, id, err)
+		return
+	}
+
+	preview := models.APIURLPreviewResponse{
+		ShortURL:    h.formatShortURL(url.Domain, url.ShortURL),
+		OriginalURL: url.OriginalURL,
+		CreatedAt:   url.CreatedAt,
+		FlaggedFlag: url.FlaggedFlag || decision.Action == policy.ActionFlag,
+	}
+
+	if userID, ok := req.Context().Value(middleware.UserIDKey{}).(string); ok && userID == url.UserID {
+		preview.URLMetadata = userURLMetadata(url)
+	}
+
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Vary", "Accept, Cookie")
+
+	if wantJSON(req) {
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(res).Encode(preview); err != nil {
+			http.Error(res, "Cannot encode response JSON body", http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.WriteHeader(http.StatusOK)
+
+	if err := previewTemplate.Execute(res, preview); err != nil {
+		zap.L().Sugar().Errorw(
+			"Cannot render preview page",
+			"err", err,
+		)
+	}
+}
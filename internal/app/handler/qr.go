@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	qrFormatPNG = "png"
+	qrFormatSVG = "svg"
+
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 2048
+
+	// qrCacheMaxAge - время в секундах, на которое клиенты могут закешировать QR-код.
+	qrCacheMaxAge = 86400
+)
+
+// qrLevels - уровни коррекции ошибок, которые можно передать в параметре level.
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+type qrOptions struct {
+	size   int
+	format string
+	level  string
+}
+
+// QRHandler – функция-обработчик, которая отдает QR-код сокращенной ссылки в формате PNG или SVG.
+// Параметры запроса: size - размер в пикселях, format - png или svg, level - уровень коррекции ошибок L, M, Q или H.
+// QR-код отдается только для ссылки, по которой можно перейти: состояния ссылки проверяются так же, как при перенаправлении.
+func (h *Handler) QRHandler(res http.ResponseWriter, req *http.Request) {
+	id := chi.URLParam(req, "id")
+
+	options, err := parseQROptions(req)
+	if err != nil {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	domain, err := h.requestDomain(req)
+	if err != nil {
+		http.Error(res, "Unknown domain", http.StatusBadRequest)
+		return
+	}
+
+	url, _, err := h.resolveURL(req.Context(), domain.key, id)
+	if err != nil {
+		h.sendResolveError(res, req, id, err)
+		return
+	}
+
+	shortURL := h.formatShortURL(url.Domain, url.ShortURL)
+	etag := qrETag(shortURL, options)
+
+	res.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", qrCacheMaxAge))
+	res.Header().Set("ETag", etag)
+
+	if req.Header.Get("If-None-Match") == etag {
+		res.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	code, err := qrcode.New(shortURL, qrLevels[options.level])
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	var body []byte
+
+	switch options.format {
+	case qrFormatSVG:
+		res.Header().Set("Content-Type", "image/svg+xml")
+		body = qrSVG(code.Bitmap(), options.size)
+	default:
+		res.Header().Set("Content-Type", "image/png")
+		body, err = code.PNG(options.size)
+		if err != nil {
+			http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	res.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	res.WriteHeader(http.StatusOK)
+	res.Write(body)
+}
+
+func parseQROptions(req *http.Request) (qrOptions, error) {
+	values := req.URL.Query()
+
+	options := qrOptions{
+		size:   defaultQRSize,
+		format: qrFormatPNG,
+		level:  "M",
+	}
+
+	if size := values.Get("size"); size != "" {
+		parsedSize, err := strconv.Atoi(size)
+		if err != nil || parsedSize < minQRSize || parsedSize > maxQRSize {
+			return qrOptions{}, ErrInvalidQuery
+		}
+
+		options.size = parsedSize
+	}
+
+	if format := strings.ToLower(values.Get("format")); format != "" {
+		if format != qrFormatPNG && format != qrFormatSVG {
+			return qrOptions{}, ErrInvalidQuery
+		}
+
+		options.format = format
+	}
+
+	if level := strings.ToUpper(values.Get("level")); level != "" {
+		if _, ok := qrLevels[level]; !ok {
+			return qrOptions{}, ErrInvalidQuery
+		}
+
+		options.level = level
+	}
+
+	return options, nil
+}
+
+// qrSVG строит SVG из матрицы модулей QR-кода. Каждый темный модуль - квадрат 1x1 в системе координат viewBox.
+func qrSVG(bitmap [][]bool, size int) []byte {
+	var builder strings.Builder
+
+	fmt.Fprintf(
+		&builder,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, len(bitmap), len(bitmap),
+	)
+	fmt.Fprintf(&builder, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, len(bitmap), len(bitmap))
+
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&builder, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	builder.WriteString(`"/></svg>`)
+
+	return []byte(builder.String())
+}
+
+func qrETag(shortURL string, options qrOptions) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s|%s", shortURL, options.size, options.format, options.level)))
+
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// wantQR - функция, которая проверяет, нужно ли добавить в ответ ссылку на QR-код.
+func wantQR(req *http.Request) bool {
+	withQR, _ := strconv.ParseBool(req.URL.Query().Get("qr"))
+
+	return withQR
+}
+
+func (h *Handler) formatQRURL(domain string, id string) string {
+	return fmt.Sprintf("%s/api/qr/%s", h.domains.byKey(domain).baseURL, id)
+}
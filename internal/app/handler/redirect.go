@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+
+	"github.com/VladKvetkin/shortener/internal/app/entities"
+)
+
+// defaultRedirectStatus - код ответа при перенаправлении, если он не задан ни у ссылки, ни в конфигурации.
+const defaultRedirectStatus = http.StatusTemporaryRedirect
+
+func isRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
+
+func isPermanentRedirectStatus(status int) bool {
+	return status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+}
+
+// redirectStatus возвращает код ответа для ссылки: код ссылки, иначе код из конфигурации, иначе 307.
+func (h *Handler) redirectStatus(url entities.URL) int {
+	if url.RedirectStatus != 0 {
+		return url.RedirectStatus
+	}
+
+	if h.config.RedirectStatus != 0 {
+		return h.config.RedirectStatus
+	}
+
+	return defaultRedirectStatus
+}
+
+// destinationURL возвращает адрес перенаправления с учетом правила передачи параметров запроса ссылки.
+// Параметры запроса к сокращенной ссылке заменяют одноименные параметры оригинальной ссылки,
+// а параметры по умолчанию добавляются, только если таких параметров еще нет. Фрагмент сохраняется.
+func destinationURL(url entities.URL, requestQuery neturl.Values) string {
+	if url.QueryMode != entities.QueryModeDefaults && url.QueryMode != entities.QueryModePassThrough {
+		return url.OriginalURL
+	}
+
+	defaultQuery, _ := neturl.ParseQuery(url.DefaultQuery)
+
+	if len(defaultQuery) == 0 && (url.QueryMode != entities.QueryModePassThrough || len(requestQuery) == 0) {
+		return url.OriginalURL
+	}
+
+	parsedURL, err := neturl.Parse(url.OriginalURL)
+	if err != nil {
+		return url.OriginalURL
+	}
+
+	query := parsedURL.Query()
+
+	if url.QueryMode == entities.QueryModePassThrough {
+		for key, values := range requestQuery {
+			query[key] = values
+		}
+	}
+
+	for key, values := range defaultQuery {
+		if _, ok := query[key]; !ok {
+			query[key] = values
+		}
+	}
+
+	parsedURL.RawQuery = query.Encode()
+
+	return parsedURL.String()
+}
+
+// sendRedirect перенаправляет клиента по адресу location.
+// Без Cache-Control браузеры кешируют постоянные перенаправления бессрочно, и удаление или изменение ссылки
+// перестает на них действовать, поэтому время кеширования ограничивается RedirectMaxAge.
+// Временные перенаправления не кешируются. Перенаправления ссылок с вариантами тоже не кешируются общими кешами,
+// потому что вариант выбирается для каждого посетителя.
+func (h *Handler) sendRedirect(res http.ResponseWriter, url entities.URL, location string) {
+	status := h.redirectStatus(url)
+
+	if isPermanentRedirectStatus(status) && len(url.Targets) == 0 {
+		res.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", h.config.RedirectMaxAge))
+	} else {
+		res.Header().Set("Cache-Control", "private, no-cache")
+	}
+
+	res.Header().Set("Location", location)
+	res.WriteHeader(status)
+}
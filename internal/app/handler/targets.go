@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/VladKvetkin/shortener/internal/app/entities"
+)
+
+const (
+	// VisitorCookieName - название куки, по которой посетитель закрепляется за вариантом ссылки.
+	VisitorCookieName = "visitor_id"
+
+	// visitorCookieMaxAge - время жизни куки посетителя в секундах.
+	visitorCookieMaxAge = 365 * 24 * 60 * 60
+
+	maxTargetsCount     = 10
+	maxTargetNameLength = 64
+	maxTargetWeight     = 1000
+)
+
+// prepareTargets - функция, которая проверяет варианты ссылки, нормализует их адреса и проверяет домены по политике.
+// Вес по умолчанию равен 1, вариантам без названия присваивается название по порядковому номеру.
+func (h *Handler) prepareTargets(targets []entities.Target) (entities.Targets, error) {
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	if len(targets) > maxTargetsCount {
+		return nil, ErrInvalidMetadata
+	}
+
+	prepared := make(entities.Targets, 0, len(targets))
+	names := make(map[string]struct{}, len(targets))
+
+	for i, target := range targets {
+		if target.Weight == 0 {
+			target.Weight = 1
+		}
+
+		if target.Weight < 0 || target.Weight > maxTargetWeight {
+			return nil, ErrInvalidMetadata
+		}
+
+		switch target.Device {
+		case "", entities.DeviceIOS, entities.DeviceAndroid, entities.DeviceDesktop:
+		default:
+			return nil, ErrInvalidMetadata
+		}
+
+		target.Name = strings.TrimSpace(target.Name)
+		if target.Name == "" {
+			target.Name = "variant-" + strconv.Itoa(i+1)
+		}
+
+		if _, ok := names[target.Name]; ok || utf8.RuneCountInString(target.Name) > maxTargetNameLength {
+			return nil, ErrInvalidMetadata
+		}
+
+		names[target.Name] = struct{}{}
+
+		targetURL, err := h.prepareOriginalURL(target.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		target.URL = targetURL
+		prepared = append(prepared, target)
+	}
+
+	return prepared, nil
+}
+
+// selectTarget - функция, которая выбирает вариант ссылки для посетителя.
+// Сначала выбираются варианты для устройства посетителя, если их нет - варианты для всех устройств,
+// если нет и их - оригинальная ссылка. Среди подходящих вариантов выбор делается по весам,
+// но для одного посетителя всегда одинаково, поэтому посетитель закрепляется куки.
+func (h *Handler) selectTarget(res http.ResponseWriter, req *http.Request, url entities.URL, device string) (entities.Target, bool) {
+	if len(url.Targets) == 0 {
+		return entities.Target{}, false
+	}
+
+	candidates := make([]entities.Target, 0, len(url.Targets))
+	for _, target := range url.Targets {
+		if target.Device == device {
+			candidates = append(candidates, target)
+		}
+	}
+
+	if len(candidates) == 0 {
+		for _, target := range url.Targets {
+			if target.Device == "" {
+				candidates = append(candidates, target)
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return entities.Target{}, false
+	}
+
+	totalWeight := 0
+	for _, target := range candidates {
+		totalWeight += target.Weight
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(visitorID(res, req) + "/" + url.ShortURL))
+
+	point := int(hash.Sum64() % uint64(totalWeight))
+	for _, target := range candidates {
+		if point < target.Weight {
+			return target, true
+		}
+
+		point -= target.Weight
+	}
+
+	return candidates[len(candidates)-1], true
+}
+
+// visitorID возвращает идентификатор посетителя из куки. Если куки нет, то создает новый идентификатор.
+func visitorID(res http.ResponseWriter, req *http.Request) string {
+	if cookie, err := req.Cookie(VisitorCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	id := uuid.NewString()
+
+	http.SetCookie(res, &http.Cookie{
+		Name:     VisitorCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   visitorCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return id
+}
+
+// deviceFromUserAgent определяет устройство посетителя по заголовку User-Agent.
+func deviceFromUserAgent(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "iPod"):
+		return entities.DeviceIOS
+	case strings.Contains(userAgent, "Android"):
+		return entities.DeviceAndroid
+	default:
+		return entities.DeviceDesktop
+	}
+}
+
+// recordClick записывает переход в фоне, чтобы не задерживать перенаправление.
+func (h *Handler) recordClick(click entities.Click) {
+	h.ClicksWg.Add(1)
+
+	go func() {
+		defer h.ClicksWg.Done()
+
+		if err := h.storage.AddClick(context.Background(), click); err != nil {
+			zap.L().Sugar().Errorw(
+				"Cannot record click",
+				"err", err,
+				"short_url", click.ShortURL,
+			)
+		}
+	}()
+}
+
+func newClick(url entities.URL, variant string, device string) entities.Click {
+	return entities.Click{
+		ShortURL:  url.ShortURL,
+		Domain:    url.Domain,
+		Variant:   variant,
+		Device:    device,
+		ClickedAt: time.Now(),
+	}
+}
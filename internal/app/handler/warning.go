@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"go.uber.org/zap"
+)
+
+// warningTemplate - страница-предупреждение, которая показывается перед переходом по помеченной ссылке.
+var warningTemplate = template.Must(template.New("warning").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex, nofollow">
+<title>You are leaving for {{.Host}}</title>
+</head>
+<body>
+<h1>You are leaving for {{.Host}}</h1>
+<p>This link has been flagged as potentially unsafe. Continue only if you trust the destination:</p>
+<p><code>{{.URL}}</code></p>
+<p><a href="{{.URL}}" rel="noopener noreferrer nofollow">Continue</a></p>
+</body>
+</html>
+`))
+
+type warningPage struct {
+	Host string
+	URL  string
+}
+
+// sendWarningPage отдает страницу-предупреждение вместо перенаправления.
+// Страница не должна кешироваться, иначе после снятия пометки клиенты продолжат видеть предупреждение.
+func (h *Handler) sendWarningPage(res http.ResponseWriter, originalURL string) {
+	page := warningPage{URL: originalURL}
+	if parsedURL, err := url.Parse(originalURL); err == nil {
+		page.Host = parsedURL.Hostname()
+	}
+
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+	res.Header().Set("Pragma", "no-cache")
+	res.Header().Set("Expires", "0")
+	res.Header().Set("Referrer-Policy", "no-referrer")
+	res.WriteHeader(http.StatusOK)
+
+	if err := warningTemplate.Execute(res, page); err != nil {
+		zap.L().Sugar().Errorw(
+			"Cannot render warning page",
+			"err", err,
+		)
+	}
+}
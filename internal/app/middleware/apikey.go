@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/VladKvetkin/shortener/internal/app/auth"
+	"github.com/VladKvetkin/shortener/internal/app/entities"
+	"github.com/VladKvetkin/shortener/internal/app/storage"
+)
+
+// APIKeyHeader - заголовок, в котором передается ключ API.
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyStore - интерфейс хранилища, в котором ищутся ключи API.
+type APIKeyStore interface {
+	ReadAPIKeyByHash(ctx context.Context, hash string) (entities.APIKey, error)
+}
+
+// APIKeyScopesKey - ключ контекста, в котором хранятся права ключа API.
+// Если запрос пришел с JWT-токеном, то значения в контексте нет и пользователю доступно все.
+type APIKeyScopesKey struct{}
+
+// APIKey - функция, которая возвращает middleware аутентификации по заголовку X-API-Key.
+// Идентификатор владельца ключа записывается в контекст так же, как для JWT-токена, поэтому JWTCookie такие запросы пропускает.
+// Недействительный или просроченный ключ отклоняется с http.StatusUnauthorized.
+func APIKey(store APIKeyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			rawKey := req.Header.Get(APIKeyHeader)
+			if rawKey == "" {
+				next.ServeHTTP(resp, req)
+				return
+			}
+
+			key, err := store.ReadAPIKeyByHash(req.Context(), auth.HashAPIKey(rawKey))
+			if err != nil {
+				if errors.Is(err, storage.ErrAPIKeyNotExists) {
+					Unauthorized(resp, true)
+					return
+				}
+
+				http.Error(resp, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			if key.Expired(time.Now()) {
+				Unauthorized(resp, true)
+				return
+			}
+
+			ctx := context.WithValue(req.Context(), UserIDKey{}, key.UserID)
+			ctx = context.WithValue(ctx, APIKeyScopesKey{}, []string(key.Scopes))
+
+			next.ServeHTTP(resp, req.WithContext(ctx))
+		})
+	}
+}
+
+// RequireScope - функция, которая возвращает middleware, пропускающий запросы с ключом API, только если у ключа есть право scope.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			scopes, ok := req.Context().Value(APIKeyScopesKey{}).([]string)
+			if !ok {
+				next.ServeHTTP(resp, req)
+				return
+			}
+
+			for _, keyScope := range scopes {
+				if keyScope == scope {
+					next.ServeHTTP(resp, req)
+					return
+				}
+			}
+
+			resp.Header().Set("WWW-Authenticate", `Bearer realm="`+authRealm+`", error="insufficient_scope", scope="`+scope+`"`)
+			http.Error(resp, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		})
+	}
+}
+
+// SessionOnly - функция, которая отклоняет запросы с ключом API. Так ключ не может выпустить себе новые ключи.
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if _, ok := req.Context().Value(APIKeyScopesKey{}).([]string); ok {
+			http.Error(resp, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(resp, req)
+	})
+}
+
+// HasCredentials - функция, которая проверяет, что в запросе передан JWT-токен или ключ API.
+func HasCredentials(req *http.Request) bool {
+	if _, ok := RequestToken(req); ok {
+		return true
+	}
+
+	return req.Header.Get(APIKeyHeader) != ""
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/VladKvetkin/shortener/internal/app/auth"
+	"github.com/VladKvetkin/shortener/internal/app/config"
+)
+
+const (
+	// CSRFCookieName - имя куки с CSRF-токеном. Куки доступна скриптам страницы, чтобы они передавали токен в заголовке.
+	CSRFCookieName = "csrf_token"
+	// CSRFHeader - заголовок, в котором клиент передает CSRF-токен из куки.
+	CSRFHeader = "X-CSRF-Token"
+
+	csrfTokenBytes = 32
+)
+
+// cookieSettings - атрибуты куки из конфигурации.
+type cookieSettings struct {
+	secure   bool
+	sameSite http.SameSite
+	domain   string
+}
+
+// settings - текущие настройки куки. До вызова Configure используются SameSite=Lax без Secure.
+var settings atomic.Pointer[cookieSettings]
+
+func init() {
+	settings.Store(&cookieSettings{sameSite: http.SameSiteLaxMode})
+}
+
+// Configure - функция, которая задает атрибуты куки по конфигурации.
+func Configure(config config.Config) {
+	sameSite := http.SameSiteLaxMode
+
+	switch strings.ToLower(config.CookieSameSite) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	settings.Store(&cookieSettings{
+		secure:   config.CookieSecure || config.EnableHTTPS,
+		sameSite: sameSite,
+		domain:   config.CookieDomain,
+	})
+}
+
+// CSRF - функция, которая защищает от CSRF методом double-submit cookie.
+// Запросы с Bearer-токеном или ключом API пропускаются без изменений: браузер не подставляет их сам.
+// Остальным клиентам без куки с CSRF-токеном выдается новый токен. Пока у клиента есть куки с JWT-токеном,
+// куки с CSRF-токеном продлевается на каждом запросе вместе с ней, чтобы она не истекла раньше сессии.
+// Изменяющий запрос, аутентифицированный по куки, должен передать тот же токен в заголовке X-CSRF-Token,
+// иначе возвращается http.StatusForbidden.
+func CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if hasHeaderCredentials(req) {
+			next.ServeHTTP(resp, req)
+			return
+		}
+
+		csrfCookie, err := req.Cookie(CSRFCookieName)
+		if err != nil || csrfCookie.Value == "" {
+			csrfToken, err := newCSRFToken()
+			if err != nil {
+				http.Error(resp, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			setCookie(resp, CSRFCookieName, csrfToken, false)
+			csrfCookie = nil
+		} else if hasTokenCookie(req) {
+			setCookie(resp, CSRFCookieName, csrfCookie.Value, false)
+		}
+
+		if hasTokenCookie(req) && !isSafeMethod(req.Method) {
+			header := req.Header.Get(CSRFHeader)
+
+			if csrfCookie == nil || header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(csrfCookie.Value)) != 1 {
+				http.Error(resp, "Invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(resp, req)
+	})
+}
+
+// setCookie записывает куки с атрибутами из конфигурации на срок жизни JWT-токена.
+func setCookie(resp http.ResponseWriter, name string, value string, httpOnly bool) {
+	current := settings.Load()
+
+	http.SetCookie(resp, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   current.domain,
+		MaxAge:   int(auth.TokenLifetime().Seconds()),
+		Secure:   current.secure,
+		HttpOnly: httpOnly,
+		SameSite: current.sameSite,
+	})
+}
+
+// hasHeaderCredentials проверяет, что пользователь определяется по заголовку, а не по куки.
+func hasHeaderCredentials(req *http.Request) bool {
+	if _, ok := BearerToken(req); ok {
+		return true
+	}
+
+	return req.Header.Get(APIKeyHeader) != ""
+}
+
+// hasTokenCookie проверяет, что в запросе есть куки с JWT-токеном, которую браузер подставляет сам.
+func hasTokenCookie(req *http.Request) bool {
+	_, err := req.Cookie(TokenCookieName)
+
+	return err == nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+func newCSRFToken() (string, error) {
+	token := make([]byte, csrfTokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
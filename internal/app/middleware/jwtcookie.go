@@ -2,54 +2,272 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/VladKvetkin/shortener/internal/app/auth"
 )
 
 const TokenCookieName = "token"
 
+// AdminTokenHeader - заголовок, в котором передается токен администратора.
+const AdminTokenHeader = "X-Admin-Token"
+
+// authRealm - область аутентификации в заголовке WWW-Authenticate.
+const authRealm = "shortener"
+
 type UserIDKey struct{}
 
-// JWTCookie - функция, которая проверяет наличие JWT-токена, и если его нет, то генерирует его и записывает в куки.
-func JWTCookie(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
-		var token string
+// SessionKey - ключ контекста, в котором хранится auth.Session из JWT-токена, переданного в запросе.
+// У новых пользователей, которым токен выпущен в этом запросе, значения в контексте нет.
+type SessionKey struct{}
+
+// SessionStore - интерфейс хранилища, по которому проверяются сессии JWT-токенов.
+type SessionStore interface {
+	// IsTokenRevoked - функция, которая проверяет, что сессия JWT-токенов отозвана.
+	IsTokenRevoked(ctx context.Context, id string) (bool, error)
+	// UserRole - функция, которая возвращает текущую роль пользователя. С ней продлевается токен,
+	// поэтому отобранная роль не переходит в продленные токены.
+	UserRole(ctx context.Context, userID string) (string, error)
+}
+
+// signInPaths - пути регистрации и входа. На них токен нового пользователя не выпускается, даже без строгого режима,
+// потому что обработчик сам выпускает токен учетной записи.
+var signInPaths = map[string]bool{
+	"/api/auth/register": true,
+	"/api/auth/login":    true,
+}
+
+var (
+	errMissingToken = errors.New("missing token")
+	errInvalidToken = errors.New("invalid token")
+)
+
+// JWTCookie - функция, которая возвращает middleware, определяющий пользователя по JWT-токену
+// из заголовка Authorization: Bearer или из куки. Токены отозванных сессий считаются недействительными.
+// Недействительный Bearer-токен отклоняется с http.StatusUnauthorized.
+// Если токена в куки нет или он недействителен, то генерируется токен нового пользователя и записывается в куки,
+// кроме запросов к API в строгом режиме: на них тоже возвращается http.StatusUnauthorized.
+// Если до истечения токена из куки осталось мало времени, то он продлевается для того же пользователя с его текущей ролью.
+// Запросы, пользователь которых уже определен по ключу API, пропускаются без изменений.
+// На регистрацию и вход пользователь определяется, только если передан действительный токен.
+// Запросы к API администратора с токеном администратора пропускаются без пользователя, токен проверяет обработчик.
+func JWTCookie(store SessionStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			if _, ok := req.Context().Value(UserIDKey{}).(string); ok {
+				next.ServeHTTP(resp, req)
+				return
+			}
 
-		tokenCookie, err := req.Cookie(TokenCookieName)
+			if req.Header.Get(AdminTokenHeader) != "" && strings.HasPrefix(req.URL.Path, "/api/admin/") {
+				next.ServeHTTP(resp, req)
+				return
+			}
 
-		if err != nil {
-			token, err = auth.BuildJWTToken()
-			if err != nil {
-				http.Error(resp, "Cannot build JWT for user", http.StatusBadRequest)
+			if signInPaths[req.URL.Path] {
+				if token, ok := RequestToken(req); ok {
+					if session, err := verifySession(req.Context(), store, token); err == nil {
+						req = withSession(req, session)
+					}
+				}
+
+				next.ServeHTTP(resp, req)
 				return
 			}
-		} else {
-			token = tokenCookie.Value
-			_, err := auth.GetUserID(token)
-			if err != nil {
-				token, err = auth.BuildJWTToken()
+
+			if token, ok := BearerToken(req); ok {
+				session, err := verifySession(req.Context(), store, token)
 				if err != nil {
-					http.Error(resp, "Cannot build JWT for user", http.StatusBadRequest)
+					if errors.Is(err, errInvalidToken) {
+						Unauthorized(resp, true)
+						return
+					}
+
+					http.Error(resp, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 					return
 				}
+
+				next.ServeHTTP(resp, withSession(req, session))
+				return
 			}
-		}
 
-		userID, err := auth.GetUserID(token)
-		if err != nil {
-			http.Error(resp, "Invalid JWT", http.StatusBadRequest)
-			return
-		}
+			token, session, err := cookieSession(req, store)
+			switch {
+			case err == nil:
+				req = withSession(req, session)
+			case errors.Is(err, errMissingToken), errors.Is(err, errInvalidToken):
+				if auth.StrictMode() && isAPIRequest(req) {
+					Unauthorized(resp, errors.Is(err, errInvalidToken))
+					return
+				}
 
-		req = req.WithContext(context.WithValue(req.Context(), UserIDKey{}, userID))
+				token, session.UserID, err = newSession()
+				if err != nil {
+					http.Error(resp, "Cannot build JWT for user", http.StatusInternalServerError)
+					return
+				}
+
+				req = withUserID(req, session.UserID)
+			default:
+				http.Error(resp, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
 
-		http.SetCookie(resp, &http.Cookie{
-			Name:  TokenCookieName,
-			Value: token,
-			Path:  "/",
+			SetTokenCookie(resp, token)
+
+			next.ServeHTTP(resp, req)
 		})
+	}
+}
+
+// BearerToken - функция, которая возвращает JWT-токен из заголовка Authorization: Bearer.
+func BearerToken(req *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+
+	return token, token != ""
+}
+
+// RequestToken - функция, которая возвращает JWT-токен, переданный в запросе: сначала из заголовка Authorization, затем из куки.
+func RequestToken(req *http.Request) (string, bool) {
+	if token, ok := BearerToken(req); ok {
+		return token, true
+	}
+
+	tokenCookie, err := req.Cookie(TokenCookieName)
+	if err != nil {
+		return "", false
+	}
 
-		next.ServeHTTP(resp, req)
+	return tokenCookie.Value, true
+}
+
+// ClearTokenCookie - функция, которая удаляет куки с JWT-токеном.
+func ClearTokenCookie(resp http.ResponseWriter) {
+	current := settings.Load()
+
+	http.SetCookie(resp, &http.Cookie{
+		Name:     TokenCookieName,
+		Path:     "/",
+		Domain:   current.domain,
+		MaxAge:   -1,
+		Secure:   current.secure,
+		HttpOnly: true,
+		SameSite: current.sameSite,
 	})
 }
+
+// SetTokenCookie - функция, которая записывает JWT-токен в куки, недоступную скриптам страницы.
+// Атрибуты Secure, SameSite и Domain берутся из конфигурации.
+func SetTokenCookie(resp http.ResponseWriter, token string) {
+	setCookie(resp, TokenCookieName, token, true)
+}
+
+// Unauthorized - функция, которая отвечает http.StatusUnauthorized с заголовком WWW-Authenticate (RFC 6750).
+func Unauthorized(resp http.ResponseWriter, invalidToken bool) {
+	challenge := `Bearer realm="` + authRealm + `"`
+	if invalidToken {
+		challenge += `, error="invalid_token"`
+	}
+
+	resp.Header().Set("WWW-Authenticate", challenge)
+	http.Error(resp, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// isAPIRequest проверяет, что запрос обращается к API, а не открывает страницу или сокращенную ссылку.
+func isAPIRequest(req *http.Request) bool {
+	if strings.HasPrefix(req.URL.Path, "/api/") {
+		return true
+	}
+
+	return req.Method != http.MethodGet && req.Method != http.MethodHead
+}
+
+func withUserID(req *http.Request, userID string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), UserIDKey{}, userID))
+}
+
+func withSession(req *http.Request, session auth.Session) *http.Request {
+	ctx := context.WithValue(req.Context(), UserIDKey{}, session.UserID)
+	ctx = context.WithValue(ctx, SessionKey{}, session)
+
+	return req.WithContext(ctx)
+}
+
+// verifySession проверяет токен и то, что его сессия не отозвана.
+// Если токен недействителен, то возвращается errInvalidToken, иначе ошибка хранилища.
+func verifySession(ctx context.Context, store SessionStore, token string) (auth.Session, error) {
+	session, err := auth.ParseJWTToken(token)
+	if err != nil {
+		return auth.Session{}, errInvalidToken
+	}
+
+	if session.ID == "" {
+		return session, nil
+	}
+
+	revoked, err := store.IsTokenRevoked(ctx, session.ID)
+	if err != nil {
+		return auth.Session{}, err
+	}
+
+	if revoked {
+		return auth.Session{}, errInvalidToken
+	}
+
+	return session, nil
+}
+
+// cookieSession возвращает токен из куки, при необходимости продленный, и сессию пользователя.
+// Если роль пользователя не удалось определить, то токен не продлевается.
+func cookieSession(req *http.Request, store SessionStore) (string, auth.Session, error) {
+	tokenCookie, err := req.Cookie(TokenCookieName)
+	if err != nil {
+		return "", auth.Session{}, errMissingToken
+	}
+
+	session, err := verifySession(req.Context(), store, tokenCookie.Value)
+	if err != nil {
+		return "", auth.Session{}, err
+	}
+
+	if !session.NeedsRenewal() {
+		return tokenCookie.Value, session, nil
+	}
+
+	role, err := store.UserRole(req.Context(), session.UserID)
+	if err != nil {
+		return tokenCookie.Value, session, nil
+	}
+
+	renewedSession := session
+	renewedSession.Role = role
+
+	renewedToken, err := auth.RenewJWTToken(renewedSession)
+	if err != nil {
+		return tokenCookie.Value, session, nil
+	}
+
+	return renewedToken, renewedSession, nil
+}
+
+// newSession выпускает токен для нового пользователя.
+func newSession() (string, string, error) {
+	token, err := auth.BuildJWTToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	userID, err := auth.GetUserID(token)
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, userID, nil
+}
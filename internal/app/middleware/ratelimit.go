@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/VladKvetkin/shortener/internal/app/auth"
+	"github.com/VladKvetkin/shortener/internal/app/config"
+	"github.com/VladKvetkin/shortener/internal/app/ratelimit"
+)
+
+// RateLimitClass - группа запросов с общим ограничением частоты.
+type RateLimitClass string
+
+const (
+	// RateLimitRedirect - переходы по сокращенным ссылкам.
+	RateLimitRedirect RateLimitClass = "redirect"
+	// RateLimitShorten - сокращение одной ссылки.
+	RateLimitShorten RateLimitClass = "shorten"
+	// RateLimitBatch - сокращение пачки ссылок, каждая ссылка пачки стоит один токен.
+	RateLimitBatch RateLimitClass = "batch"
+	// RateLimitImport - импорт ссылок. Тело импорта не читается, поэтому запрос стоит один токен независимо от размера.
+	RateLimitImport RateLimitClass = "import"
+	// RateLimitDelete - удаление ссылок.
+	RateLimitDelete RateLimitClass = "delete"
+)
+
+const (
+	// rateLimitPeriod - период, за который разрешается заданное в конфигурации количество запросов.
+	rateLimitPeriod = time.Minute
+	// maxBatchBodySize - максимальный размер тела пачки, которое ограничитель читает, чтобы посчитать ее стоимость.
+	maxBatchBodySize = 8 << 20
+)
+
+// rateLimiter - хранилище корзин и ограничения групп запросов.
+type rateLimiter struct {
+	store  ratelimit.Store
+	limits map[RateLimitClass]ratelimit.Limit
+}
+
+// limiter - текущий ограничитель. До вызова ConfigureRateLimits ограничений нет.
+var limiter atomic.Pointer[rateLimiter]
+
+func init() {
+	limiter.Store(&rateLimiter{store: ratelimit.NewMemoryStore()})
+}
+
+// SetRateLimitStore - функция, которая задает хранилище корзин, например общее для нескольких экземпляров приложения.
+// По умолчанию корзины хранятся в памяти процесса.
+func SetRateLimitStore(store ratelimit.Store) {
+	current := limiter.Load()
+
+	limiter.Store(&rateLimiter{store: store, limits: current.limits})
+}
+
+// ConfigureRateLimits - функция, которая задает ограничения групп запросов по конфигурации.
+func ConfigureRateLimits(config config.Config) {
+	limit := func(perPeriod int) ratelimit.Limit {
+		return ratelimit.Limit{Burst: perPeriod, Period: rateLimitPeriod}
+	}
+
+	current := limiter.Load()
+
+	limiter.Store(&rateLimiter{
+		store: current.store,
+		limits: map[RateLimitClass]ratelimit.Limit{
+			RateLimitRedirect: limit(config.RateLimitRedirect),
+			RateLimitShorten:  limit(config.RateLimitShorten),
+			RateLimitBatch:    limit(config.RateLimitBatch),
+			RateLimitImport:   limit(config.RateLimitImport),
+			RateLimitDelete:   limit(config.RateLimitDelete),
+		},
+	})
+}
+
+// RateLimit - функция, которая возвращает middleware, ограничивающий частоту запросов группы class.
+// Запросы с JWT-токеном или ключом API считаются по пользователю, остальные - по IP-адресу клиента,
+// потому что новый пользователь без токена создается на каждый запрос.
+// В ответ добавляются заголовки RateLimit-Limit, RateLimit-Remaining и RateLimit-Reset.
+// Если токенов не хватает, то запрос отклоняется с http.StatusTooManyRequests и заголовком Retry-After,
+// а пачка, которая больше ограничения или больше maxBatchBodySize, - с http.StatusRequestEntityTooLarge.
+// Если хранилище корзин недоступно, то запрос пропускается, чтобы сбой ограничителя не останавливал сервис.
+func RateLimit(class RateLimitClass) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			current := limiter.Load()
+
+			limit := current.limits[class]
+			if !limit.Enabled() {
+				next.ServeHTTP(resp, req)
+				return
+			}
+
+			cost := 1
+			if class == RateLimitBatch {
+				var err error
+
+				cost, err = batchSize(resp, req)
+				if err != nil {
+					var maxBytesErr *http.MaxBytesError
+					if errors.As(err, &maxBytesErr) {
+						http.Error(resp, "Batch exceeds rate limit", http.StatusRequestEntityTooLarge)
+						return
+					}
+
+					http.Error(resp, "Cannot read request body", http.StatusBadRequest)
+					return
+				}
+			}
+
+			result, err := current.store.Take(req.Context(), string(class)+":"+rateLimitKey(req), limit, cost)
+			if err != nil {
+				zap.L().Sugar().Warnw(
+					"Cannot check rate limit",
+					"class", class,
+					"err", err,
+				)
+
+				next.ServeHTTP(resp, req)
+				return
+			}
+
+			resp.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			resp.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			resp.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+
+			if !result.Allowed {
+				if result.RetryAfter < 0 {
+					http.Error(resp, "Batch exceeds rate limit", http.StatusRequestEntityTooLarge)
+					return
+				}
+
+				resp.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				http.Error(resp, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
+
+// rateLimitKey возвращает ключ корзины клиента: идентификатор пользователя, если он передал JWT-токен или ключ API,
+// иначе IP-адрес.
+func rateLimitKey(req *http.Request) string {
+	_, hasSession := req.Context().Value(SessionKey{}).(auth.Session)
+	_, hasAPIKey := req.Context().Value(APIKeyScopesKey{}).([]string)
+
+	if userID, ok := req.Context().Value(UserIDKey{}).(string); ok && (hasSession || hasAPIKey) {
+		return "user:" + userID
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// batchSize возвращает количество элементов в JSON-массиве из тела запроса и оставляет тело для обработчика.
+// Если тело не массив или массив пустой, то запрос стоит один токен, а ошибку формата вернет обработчик.
+func batchSize(resp http.ResponseWriter, req *http.Request) (int, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(resp, req.Body, maxBatchBodySize))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil || len(items) == 0 {
+		return 1, nil
+	}
+
+	return len(items), nil
+}
+
+// ceilSeconds округляет d вверх до целых секунд.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -2,40 +2,264 @@
 
 package models
 
+import (
+	"time"
+
+	"github.com/VladKvetkin/shortener/internal/app/entities"
+)
+
 // APIShortenRequest - структура, которая описывает тело запроса для обработчика APIShortenHandler.
 type APIShortenRequest struct {
 	URL string `json:"url"`
+	// Domain - домен сокращенной ссылки. Если не задан, то используется параметр domain или домен запроса.
+	Domain string `json:"domain,omitempty"`
+	URLMetadata
+}
+
+// URLMetadata - структура, которая описывает метаданные сокращенной ссылки, которые задает пользователь.
+type URLMetadata struct {
+	Title string   `json:"title,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	Notes string   `json:"notes,omitempty"`
+	// RedirectStatus - код ответа при перенаправлении: 301, 302, 307 или 308.
+	RedirectStatus int `json:"redirect_status,omitempty"`
+	// QueryMode - правило передачи параметров запроса при перенаправлении: ignore, defaults или passthrough.
+	QueryMode string `json:"query_mode,omitempty"`
+	// DefaultQuery - параметры, например UTM-метки, которые добавляются к оригинальной ссылке при перенаправлении.
+	DefaultQuery map[string]string `json:"default_query,omitempty"`
+	// Targets - варианты оригинальной ссылки с весами и устройствами.
+	Targets []entities.Target `json:"targets,omitempty"`
+	// ExpiresAt - время, после которого переход по ссылке запрещен.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 // APIShortenResponse - структура, которая описывает тело ответа обработчика APIShortenHandler.
 type APIShortenResponse struct {
 	Result string `json:"result"`
+	// QR - ссылка на QR-код сокращенной ссылки, заполняется при запросе с параметром qr=true.
+	QR string `json:"qr,omitempty"`
 }
 
 // FileStorageRecord - структура, которая описывает формат сохранения сокращенных ссылок пользователя в файл.
+// Файл дописывается при каждом изменении ссылки, при восстановлении побеждает последняя запись.
 type FileStorageRecord struct {
 	UUID        string `json:"uuid"`
 	ShortURL    string `json:"short_url"`
+	Domain      string `json:"domain,omitempty"`
 	OriginalURL string `json:"original_url"`
+	UserID      string `json:"user_id,omitempty"`
+	DeletedFlag bool   `json:"is_deleted,omitempty"`
+	FlaggedFlag bool   `json:"is_flagged,omitempty"`
+	// DisabledFlag - признак, что ссылку отключил администратор.
+	DisabledFlag bool `json:"is_disabled,omitempty"`
+	// RemovedFlag - признак, что ссылка удалена безвозвратно. Запись с этим признаком удаляет ссылку при восстановлении.
+	RemovedFlag bool      `json:"is_removed,omitempty"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Notes       string    `json:"notes,omitempty"`
+	// RedirectStatus - код ответа при перенаправлении, 0 - код из конфигурации.
+	RedirectStatus int               `json:"redirect_status,omitempty"`
+	QueryMode      string            `json:"query_mode,omitempty"`
+	DefaultQuery   string            `json:"default_query,omitempty"`
+	Targets        []entities.Target `json:"targets,omitempty"`
+	ExpiresAt      *time.Time        `json:"expires_at,omitempty"`
+	// User - учетная запись. Если задана, то запись сохраняет учетную запись, а не ссылку.
+	User *FileStorageUser `json:"user,omitempty"`
+	// APIKey - ключ API. Если задан, то запись сохраняет ключ API, а не ссылку.
+	APIKey *FileStorageAPIKey `json:"api_key,omitempty"`
+	// AuditEntry - запись журнала действий администратора. Если задана, то запись сохраняет ее, а не ссылку.
+	AuditEntry *FileStorageAuditEntry `json:"audit_entry,omitempty"`
+}
+
+// FileStorageUser - структура, которая описывает формат сохранения учетной записи в файл.
+type FileStorageUser struct {
+	ID           string    `json:"id"`
+	Login        string    `json:"login"`
+	PasswordHash string    `json:"password_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// FileStorageAPIKey - структура, которая описывает формат сохранения ключа API в файл.
+type FileStorageAPIKey struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Name      string     `json:"name,omitempty"`
+	Prefix    string     `json:"prefix"`
+	Hash      string     `json:"key_hash"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// RevokedFlag - признак, что ключ отозван. Запись с этим признаком удаляет ключ при восстановлении.
+	RevokedFlag bool `json:"is_revoked,omitempty"`
+}
+
+// FileStorageAuditEntry - структура, которая описывает формат сохранения записи журнала действий администратора в файл.
+type FileStorageAuditEntry struct {
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Domain    string    `json:"domain,omitempty"`
+	ShortURL  string    `json:"short_url,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // APIShortenBatchRequest - структура, которая описывает тело запроса для обработчика APIShortenBatchHandler.
 type APIShortenBatchRequest struct {
 	CorrelationID string `json:"correlation_id"`
 	OriginalURL   string `json:"original_url"`
+	URLMetadata
 }
 
 // APIShortenBatchResponse - структура, которая описывает тело ответа обработчика APIShortenBatchHandler.
 type APIShortenBatchResponse struct {
 	CorrelationID string `json:"correlation_id"`
 	ShortURL      string `json:"short_url"`
+	QR            string `json:"qr,omitempty"`
+	// Conflict - признак, что оригинальная ссылка уже была сокращена и возвращена существующая сокращенная ссылка.
+	Conflict bool `json:"conflict,omitempty"`
 }
 
 // APIUserURLResponse - структура, которая описывает тело ответа обработчика APIUserURLHandler.
 type APIUserURLResponse struct {
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	DeletedFlag bool      `json:"is_deleted,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	URLMetadata
 }
 
 // APIUserDeleteURLRequest - тип, который описывает тело запроса для обработчика APIUserDeleteURLHandler.
 type APIUserDeleteURLRequest []string
+
+// APIUserUpdateURLRequest - структура, которая описывает тело запроса для обработчика UpdateUserURLHandler.
+type APIUserUpdateURLRequest struct {
+	URL string `json:"url"`
+}
+
+// APIUserURLHistoryResponse - структура, которая описывает элемент тела ответа обработчика GetUserURLHistoryHandler.
+type APIUserURLHistoryResponse struct {
+	OriginalURL string    `json:"original_url"`
+	ChangedAt   time.Time `json:"changed_at"`
+}
+
+// APIUserURLExportRecord - структура, которая описывает строку выгрузки обработчика ExportUserURLsHandler.
+type APIUserURLExportRecord struct {
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	DeletedFlag bool      `json:"is_deleted"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	URLMetadata
+}
+
+// APIShortenImportRecord - структура, которая описывает строку тела запроса для обработчика APIShortenImportHandler.
+type APIShortenImportRecord struct {
+	OriginalURL string `json:"original_url"`
+	URLMetadata
+}
+
+// APIShortenImportResult - структура, которая описывает строку отчета обработчика APIShortenImportHandler.
+type APIShortenImportResult struct {
+	Line        int    `json:"line"`
+	Status      string `json:"status"`
+	OriginalURL string `json:"original_url,omitempty"`
+	ShortURL    string `json:"short_url,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// APIURLPreviewResponse - структура, которая описывает тело ответа предпросмотра сокращенной ссылки.
+// Метаданные заполняются, только если ссылку просматривает ее владелец.
+type APIURLPreviewResponse struct {
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	CreatedAt   time.Time `json:"created_at"`
+	FlaggedFlag bool      `json:"is_flagged,omitempty"`
+	URLMetadata
+}
+
+// APIAdminFlagURLRequest - структура, которая описывает тело запроса для обработчика AdminFlagURLHandler.
+type APIAdminFlagURLRequest struct {
+	Flagged bool `json:"flagged"`
+}
+
+// APIAdminDisableURLRequest - структура, которая описывает тело запроса для обработчика AdminDisableURLHandler.
+type APIAdminDisableURLRequest struct {
+	Disabled bool `json:"disabled"`
+}
+
+// APIAdminTransferURLRequest - структура, которая описывает тело запроса для обработчика AdminTransferURLHandler.
+type APIAdminTransferURLRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// APIAdminURLResponse - структура, которая описывает сокращенную ссылку в ответах API администратора.
+type APIAdminURLResponse struct {
+	ID           string    `json:"id"`
+	ShortURL     string    `json:"short_url"`
+	Domain       string    `json:"domain,omitempty"`
+	OriginalURL  string    `json:"original_url"`
+	UserID       string    `json:"user_id"`
+	DeletedFlag  bool      `json:"is_deleted"`
+	FlaggedFlag  bool      `json:"is_flagged"`
+	DisabledFlag bool      `json:"is_disabled"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// APIAdminAuditEntryResponse - структура, которая описывает элемент тела ответа обработчика AdminAuditLogHandler.
+type APIAdminAuditEntryResponse struct {
+	ID        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Domain    string    `json:"domain,omitempty"`
+	ShortURL  string    `json:"short_url,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIUserURLClicksResponse - структура, которая описывает элемент тела ответа обработчика GetUserURLClicksHandler.
+type APIUserURLClicksResponse struct {
+	Variant string `json:"variant"`
+	Count   int64  `json:"count"`
+}
+
+// APIErrorResponse - структура, которая описывает тело ответа с ошибкой проверки запроса.
+type APIErrorResponse struct {
+	Code          string `json:"code"`
+	Message       string `json:"message"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// APIAuthTokenResponse - структура, которая описывает ответ с новым JWT-токеном.
+type APIAuthTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// APIAuthCredentialsRequest - структура, которая описывает тело запроса обработчиков RegisterHandler и LoginHandler.
+type APIAuthCredentialsRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// APIKeyCreateRequest - структура, которая описывает тело запроса обработчика CreateAPIKeyHandler.
+type APIKeyCreateRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresAt - время, после которого ключ не принимается. Если не задано, то ключ бессрочный.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKeyResponse - структура, которая описывает ключ API в ответах обработчиков ключей API.
+type APIKeyResponse struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	// Key - сам ключ, возвращается только при создании.
+	Key       string     `json:"key,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,359 @@
+// Package policy отвечает за правила блокировки и разрешения доменов оригинальных ссылок.
+//
+// Правила загружаются из текстового файла, по одному правилу в строке:
+//
+//	# комментарий
+//	block example.com          - домен целиком
+//	block *.phishing.example   - все поддомены
+//	block re:^login-.*\.com$   - регулярное выражение для хоста
+//	block 203.0.113.0/24       - подсеть для ссылок с IP-адресом
+//	flag *.suspicious.example  - показывать страницу-предупреждение перед переходом
+//	allow safe.phishing.example
+//	default block              - блокировать все, что не разрешено явно
+//
+// Разрешающие правила имеют приоритет над остальными, блокирующие - над предупреждающими.
+// По умолчанию все, что не заблокировано, разрешено.
+// Файл перечитывается при изменении, если запущен Engine.Watch.
+
+package policy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Action - действие, которое политика применяет к ссылке.
+type Action string
+
+const (
+	// ActionAllow - ссылку можно сокращать и открывать.
+	ActionAllow Action = "allow"
+	// ActionBlock - ссылку нельзя сокращать и открывать.
+	ActionBlock Action = "block"
+	// ActionFlag - ссылку можно сокращать, но перед переходом показывается предупреждение.
+	ActionFlag Action = "flag"
+)
+
+var (
+	// ErrInvalidRule - ошибка, которая означает, что правило в файле политики задано неверно.
+	ErrInvalidRule = errors.New("invalid policy rule")
+)
+
+// BlockedError - ошибка, которая означает, что домен ссылки заблокирован политикой.
+type BlockedError struct {
+	Host string
+	Rule string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("domain %q is blocked", e.Host)
+}
+
+// Decision - структура, которая описывает решение политики для хоста.
+type Decision struct {
+	Action Action
+	// Rule - правило, которое сработало. Пустое, если сработало действие по умолчанию.
+	Rule string
+}
+
+type matcher interface {
+	match(host string, ip net.IP) bool
+}
+
+type exactMatcher string
+
+func (m exactMatcher) match(host string, ip net.IP) bool {
+	return host == string(m)
+}
+
+// suffixMatcher хранит суффикс вида ".example.com" и совпадает со всеми поддоменами.
+type suffixMatcher string
+
+func (m suffixMatcher) match(host string, ip net.IP) bool {
+	return strings.HasSuffix(host, string(m))
+}
+
+type regexpMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m regexpMatcher) match(host string, ip net.IP) bool {
+	return m.re.MatchString(host)
+}
+
+type cidrMatcher struct {
+	network *net.IPNet
+}
+
+func (m cidrMatcher) match(host string, ip net.IP) bool {
+	return ip != nil && m.network.Contains(ip)
+}
+
+type rule struct {
+	action  Action
+	source  string
+	matcher matcher
+}
+
+type ruleSet struct {
+	rules         []rule
+	defaultAction Action
+}
+
+func (rs *ruleSet) evaluate(host string) Decision {
+	ip := net.ParseIP(host)
+
+	decision := Decision{Action: rs.defaultAction}
+
+	for _, rule := range rs.rules {
+		if !rule.matcher.match(host, ip) {
+			continue
+		}
+
+		if rule.action == ActionAllow {
+			return Decision{Action: ActionAllow, Rule: rule.source}
+		}
+
+		if decision.Rule == "" || (rule.action == ActionBlock && decision.Action != ActionBlock) {
+			decision = Decision{Action: rule.action, Rule: rule.source}
+		}
+	}
+
+	return decision
+}
+
+// Engine - структура, которая проверяет хосты ссылок по правилам из файла.
+// Nil *Engine разрешает все ссылки.
+type Engine struct {
+	path    string
+	mu      sync.RWMutex
+	rules   *ruleSet
+	modTime time.Time
+	size    int64
+}
+
+// NewEngine - конструктор Engine. Если path пустой, то Engine разрешает все ссылки.
+func NewEngine(path string) (*Engine, error) {
+	engine := &Engine{
+		path:  path,
+		rules: &ruleSet{defaultAction: ActionAllow},
+	}
+
+	if path == "" {
+		return engine, nil
+	}
+
+	if err := engine.reload(); err != nil {
+		return nil, err
+	}
+
+	return engine, nil
+}
+
+// Evaluate - функция, которая возвращает решение политики для хоста.
+func (e *Engine) Evaluate(host string) Decision {
+	if e == nil {
+		return Decision{Action: ActionAllow}
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+
+	return rules.evaluate(host)
+}
+
+// EvaluateURL - функция, которая возвращает решение политики для хоста оригинальной ссылки.
+func (e *Engine) EvaluateURL(rawURL string) (Decision, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	return e.Evaluate(parsedURL.Hostname()), nil
+}
+
+// Check - функция, которая проверяет оригинальную ссылку.
+// Если домен ссылки заблокирован, то возвращается *BlockedError.
+func (e *Engine) Check(rawURL string) error {
+	decision, err := e.EvaluateURL(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if decision.Action == ActionBlock {
+		parsedURL, _ := url.Parse(rawURL)
+
+		return &BlockedError{
+			Host: parsedURL.Hostname(),
+			Rule: decision.Rule,
+		}
+	}
+
+	return nil
+}
+
+// Watch - функция, которая раз в interval проверяет файл правил и перечитывает его, если он изменился.
+// Если новый файл содержит ошибки, то продолжают действовать предыдущие правила.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	if e == nil || e.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := e.changed()
+			if err != nil || !changed {
+				continue
+			}
+
+			if err := e.reload(); err != nil {
+				zap.L().Sugar().Errorw(
+					"Cannot reload policy",
+					"err", err,
+					"path", e.path,
+				)
+				continue
+			}
+
+			zap.L().Info("Policy reloaded", zap.String("path", e.path))
+		}
+	}
+}
+
+func (e *Engine) changed() (bool, error) {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return false, err
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return !info.ModTime().Equal(e.modTime) || info.Size() != e.size, nil
+}
+
+func (e *Engine) reload() error {
+	file, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	rules, err := parseRules(file)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rules = rules
+	e.modTime = info.ModTime()
+	e.size = info.Size()
+
+	return nil
+}
+
+func parseRules(r io.Reader) (*ruleSet, error) {
+	rules := &ruleSet{defaultAction: ActionAllow}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: line %d", ErrInvalidRule, lineNumber)
+		}
+
+		action, pattern := Action(fields[0]), fields[1]
+
+		if action == "default" {
+			switch Action(pattern) {
+			case ActionAllow, ActionBlock:
+				rules.defaultAction = Action(pattern)
+			default:
+				return nil, fmt.Errorf("%w: line %d", ErrInvalidRule, lineNumber)
+			}
+			continue
+		}
+
+		if action != ActionAllow && action != ActionBlock && action != ActionFlag {
+			return nil, fmt.Errorf("%w: line %d", ErrInvalidRule, lineNumber)
+		}
+
+		matcher, err := newMatcher(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidRule, lineNumber, err)
+		}
+
+		rules.rules = append(rules.rules, rule{
+			action:  action,
+			source:  line,
+			matcher: matcher,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func newMatcher(pattern string) (matcher, error) {
+	switch {
+	case strings.HasPrefix(pattern, "re:"):
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, "re:"))
+		if err != nil {
+			return nil, err
+		}
+
+		return regexpMatcher{re: re}, nil
+	case strings.HasPrefix(pattern, "*."):
+		return suffixMatcher(strings.ToLower(strings.TrimPrefix(pattern, "*"))), nil
+	case strings.Contains(pattern, "/"):
+		_, network, err := net.ParseCIDR(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		return cidrMatcher{network: network}, nil
+	default:
+		return exactMatcher(strings.TrimSuffix(strings.ToLower(pattern), ".")), nil
+	}
+}
@@ -0,0 +1,80 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineEvaluate(t *testing.T) {
+	rules, err := parseRules(strings.NewReader(`
+# phishing
+block evil.example
+block *.phishing.example
+block re:^login-[a-z]+\.com$
+block 203.0.113.0/24
+flag *.example
+allow safe.phishing.example
+`))
+	require.NoError(t, err)
+
+	engine := &Engine{rules: rules}
+
+	tests := []struct {
+		name string
+		host string
+		want Action
+	}{
+		{name: "exact domain", host: "Evil.Example.", want: ActionBlock},
+		{name: "subdomain of exact domain", host: "www.evil.example", want: ActionFlag},
+		{name: "wildcard subdomain", host: "a.b.phishing.example", want: ActionBlock},
+		{name: "wildcard base domain", host: "phishing.example", want: ActionFlag},
+		{name: "allowed exception", host: "safe.phishing.example", want: ActionAllow},
+		{name: "regexp", host: "login-bank.com", want: ActionBlock},
+		{name: "ip in cidr", host: "203.0.113.10", want: ActionBlock},
+		{name: "ip outside cidr", host: "198.51.100.10", want: ActionAllow},
+		{name: "unknown domain", host: "practicum.yandex.ru", want: ActionAllow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, engine.Evaluate(tt.host).Action)
+		})
+	}
+}
+
+func TestParseRulesInvalid(t *testing.T) {
+	for _, rules := range []string{"deny example.com", "block re:(", "block 10.0.0.0/99", "default maybe", "block"} {
+		_, err := parseRules(strings.NewReader(rules))
+		assert.ErrorIs(t, err, ErrInvalidRule, rules)
+	}
+}
+
+func TestEngineWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	require.NoError(t, os.WriteFile(path, []byte("block evil.example\n"), 0600))
+
+	engine, err := NewEngine(path)
+	require.NoError(t, err)
+
+	var blockedErr *BlockedError
+	require.ErrorAs(t, engine.Check("https://evil.example/login"), &blockedErr)
+	assert.Equal(t, "block evil.example", blockedErr.Rule)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go engine.Watch(ctx, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte("default block\nallow evil.example\n"), 0600))
+
+	assert.Eventually(t, func() bool {
+		return engine.Check("https://evil.example/") == nil && engine.Check("https://yandex.ru/") != nil
+	}, time.Second, 10*time.Millisecond)
+}
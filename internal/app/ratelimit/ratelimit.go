@@ -0,0 +1,165 @@
+// Package ratelimit отвечает за ограничение частоты запросов по алгоритму token bucket.
+//
+// У каждого ключа (пользователя или IP-адреса) есть корзина на Limit.Burst токенов,
+// которая равномерно пополняется до полной за Limit.Period. Запрос забирает из корзины
+// столько токенов, сколько он стоит, и отклоняется, если токенов не хватает.
+// Корзины хранятся в Store: в памяти процесса или в общем хранилище нескольких экземпляров приложения.
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrInvalidCost - ошибка, которая означает, что стоимость запроса не положительная.
+var ErrInvalidCost = errors.New("invalid rate limit cost")
+
+// Limit - ограничение частоты запросов.
+type Limit struct {
+	// Burst - емкость корзины: сколько токенов можно потратить сразу.
+	Burst int
+	// Period - время, за которое пустая корзина пополняется до полной.
+	Period time.Duration
+}
+
+// Enabled - функция, которая проверяет, что ограничение задано.
+func (l Limit) Enabled() bool {
+	return l.Burst > 0 && l.Period > 0
+}
+
+// interval возвращает время, за которое в корзину добавляется один токен.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Burst)
+}
+
+// Result - результат попытки забрать токены из корзины.
+type Result struct {
+	// Allowed - токенов хватило, и они списаны.
+	Allowed bool
+	// Limit - емкость корзины.
+	Limit int
+	// Remaining - количество токенов, оставшееся в корзине.
+	Remaining int
+	// RetryAfter - время, через которое токенов хватит на запрос. Нулевое, если запрос разрешен.
+	// Если стоимость запроса больше емкости корзины, то запрос не будет разрешен никогда и RetryAfter равно -1.
+	RetryAfter time.Duration
+	// ResetAfter - время, через которое корзина пополнится до полной.
+	ResetAfter time.Duration
+}
+
+// Store - интерфейс хранилища корзин. Take должен атомарно пополнить корзину key
+// и списать из нее cost токенов, если их хватает.
+// Реализация для общего хранилища, например Redis, позволяет разделить ограничения между экземплярами приложения.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, cost int) (Result, error)
+}
+
+// bucket - корзина, в которой хранится время, когда она станет полной.
+// Такое представление не требует периодического пополнения: корзина полна, если это время уже прошло.
+type bucket struct {
+	fullAt time.Time
+}
+
+// purgeInterval - период, с которым MemoryStore удаляет полные корзины.
+const purgeInterval = time.Minute
+
+// MemoryStore - хранилище корзин в памяти процесса. Корзины, которые пополнились до полной, удаляются,
+// поэтому память занимают только клиенты, которые недавно отправляли запросы.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]bucket
+	lastPurge time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore - конструктор MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]bucket),
+		now:     time.Now,
+	}
+}
+
+// Take - функция, которая списывает cost токенов из корзины key.
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit, cost int) (Result, error) {
+	if cost <= 0 {
+		return Result{}, ErrInvalidCost
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.purge(now)
+
+	fullAt := s.buckets[key].fullAt
+	if fullAt.Before(now) {
+		fullAt = now
+	}
+
+	result, fullAt := take(now, fullAt, limit, cost)
+	if result.Allowed {
+		s.buckets[key] = bucket{fullAt: fullAt}
+	}
+
+	return result, nil
+}
+
+// purge удаляет полные корзины не чаще, чем раз в purgeInterval.
+func (s *MemoryStore) purge(now time.Time) {
+	if now.Sub(s.lastPurge) < purgeInterval {
+		return
+	}
+
+	for key, b := range s.buckets {
+		if !b.fullAt.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+
+	s.lastPurge = now
+}
+
+// take списывает cost токенов из корзины, которая станет полной в fullAt (не раньше now),
+// и возвращает результат и новое время заполнения корзины.
+func take(now time.Time, fullAt time.Time, limit Limit, cost int) (Result, time.Time) {
+	interval := limit.interval()
+	result := Result{Limit: limit.Burst}
+
+	if cost > limit.Burst {
+		result.Remaining = remaining(now, fullAt, limit)
+		result.RetryAfter = -1
+		result.ResetAfter = fullAt.Sub(now)
+
+		return result, fullAt
+	}
+
+	newFullAt := fullAt.Add(time.Duration(cost) * interval)
+	if allowedAt := newFullAt.Add(-limit.Period); allowedAt.After(now) {
+		result.Remaining = remaining(now, fullAt, limit)
+		result.RetryAfter = allowedAt.Sub(now)
+		result.ResetAfter = fullAt.Sub(now)
+
+		return result, fullAt
+	}
+
+	result.Allowed = true
+	result.Remaining = remaining(now, newFullAt, limit)
+	result.ResetAfter = newFullAt.Sub(now)
+
+	return result, newFullAt
+}
+
+// remaining возвращает количество целых токенов в корзине, которая станет полной в fullAt.
+func remaining(now time.Time, fullAt time.Time, limit Limit) int {
+	missing := int(math.Ceil(float64(fullAt.Sub(now)) / float64(limit.interval())))
+	if missing > limit.Burst {
+		return 0
+	}
+
+	return limit.Burst - missing
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	store := NewMemoryStore()
+	store.now = func() time.Time { return current }
+
+	limit := Limit{Burst: 3, Period: 3 * time.Minute}
+
+	type step struct {
+		name      string
+		advance   time.Duration
+		key       string
+		cost      int
+		allowed   bool
+		remaining int
+		retry     time.Duration
+		reset     time.Duration
+	}
+
+	steps := []step{
+		{name: "first request", key: "a", cost: 1, allowed: true, remaining: 2, reset: time.Minute},
+		{name: "second request", key: "a", cost: 1, allowed: true, remaining: 1, reset: 2 * time.Minute},
+		{name: "batch larger than remaining", key: "a", cost: 2, allowed: false, remaining: 1, retry: time.Minute, reset: 2 * time.Minute},
+		{name: "other key has own bucket", key: "b", cost: 3, allowed: true, remaining: 0, reset: 3 * time.Minute},
+		{name: "last token", key: "a", cost: 1, allowed: true, remaining: 0, reset: 3 * time.Minute},
+		{name: "empty bucket", key: "a", cost: 1, allowed: false, remaining: 0, retry: time.Minute, reset: 3 * time.Minute},
+		{name: "partly refilled", advance: 30 * time.Second, key: "a", cost: 1, allowed: false, remaining: 0, retry: 30 * time.Second, reset: 150 * time.Second},
+		{name: "one token refilled", advance: 30 * time.Second, key: "a", cost: 1, allowed: true, remaining: 0, reset: 3 * time.Minute},
+		{name: "cost larger than burst", key: "c", cost: 4, allowed: false, remaining: 3, retry: -1},
+		{name: "fully refilled", advance: 3 * time.Minute, key: "a", cost: 1, allowed: true, remaining: 2, reset: time.Minute},
+	}
+
+	for _, s := range steps {
+		current = current.Add(s.advance)
+
+		result, err := store.Take(context.Background(), s.key, limit, s.cost)
+		require.NoError(t, err, s.name)
+
+		assert.Equal(t, Result{
+			Allowed:    s.allowed,
+			Limit:      limit.Burst,
+			Remaining:  s.remaining,
+			RetryAfter: s.retry,
+			ResetAfter: s.reset,
+		}, result, s.name)
+	}
+
+	_, err := store.Take(context.Background(), "a", limit, 0)
+	assert.ErrorIs(t, err, ErrInvalidCost)
+}
+
+func TestMemoryStorePurge(t *testing.T) {
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	store := NewMemoryStore()
+	store.now = func() time.Time { return current }
+
+	limit := Limit{Burst: 10, Period: time.Minute}
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := store.Take(context.Background(), key, limit, 1)
+		require.NoError(t, err)
+	}
+
+	assert.Len(t, store.buckets, 3)
+
+	current = current.Add(2 * purgeInterval)
+
+	_, err := store.Take(context.Background(), "d", limit, 1)
+	require.NoError(t, err)
+
+	assert.Len(t, store.buckets, 1, "full buckets must be removed")
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/go-chi/chi"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 
+	"github.com/VladKvetkin/shortener/internal/app/entities"
 	"github.com/VladKvetkin/shortener/internal/app/handler"
 	"github.com/VladKvetkin/shortener/internal/app/middleware"
 )
@@ -32,23 +33,72 @@ func NewRouter(handler *handler.Handler) *Router {
 
 	chiRouter.Use(
 		middleware.DecompressBodyReader,
-		middleware.JWTCookie,
+		middleware.APIKey(handler.APIKeyStore()),
+		middleware.CSRF,
+		middleware.JWTCookie(handler.SessionStore()),
 		middleware.Logger,
-		chiMiddleware.Compress(gzip.BestSpeed, "application/json", "text/html"),
+		chiMiddleware.Compress(gzip.BestSpeed, "application/json", "text/html", "image/svg+xml"),
 	)
 
 	chiRouter.Route("/", func(r chi.Router) {
-		r.Post("/", http.HandlerFunc(handler.PostHandler))
+		r.Get("/", http.HandlerFunc(handler.LandingHandler))
+		r.Get("/.well-known/jwks.json", http.HandlerFunc(handler.JWKSHandler))
+		r.With(middleware.RequireScope(entities.ScopeShorten), middleware.RateLimit(middleware.RateLimitShorten)).
+			Post("/", http.HandlerFunc(handler.PostHandler))
 		r.Route("/api", func(r chi.Router) {
 			r.Route("/shorten", func(r chi.Router) {
-				r.Post("/", http.HandlerFunc(handler.APIShortenHandler))
-				r.Post("/batch", http.HandlerFunc(handler.APIShortenBatchHandler))
+				r.Use(middleware.RequireScope(entities.ScopeShorten))
+				r.With(middleware.RateLimit(middleware.RateLimitShorten)).Post("/", http.HandlerFunc(handler.APIShortenHandler))
+				r.With(middleware.RateLimit(middleware.RateLimitBatch)).Post("/batch", http.HandlerFunc(handler.APIShortenBatchHandler))
+				r.With(middleware.RateLimit(middleware.RateLimitImport)).Post("/import", http.HandlerFunc(handler.APIShortenImportHandler))
 			})
 
-			r.Get("/user/urls", http.HandlerFunc(handler.GetUserUrlsHandler))
-			r.Delete("/user/urls", http.HandlerFunc(handler.DeleteUserUrlsHandler))
+			r.Route("/user/urls", func(r chi.Router) {
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireScope(entities.ScopeRead))
+					r.Get("/", http.HandlerFunc(handler.GetUserUrlsHandler))
+					r.Get("/export", http.HandlerFunc(handler.ExportUserURLsHandler))
+					r.Get("/{id}/history", http.HandlerFunc(handler.GetUserURLHistoryHandler))
+					r.Get("/{id}/clicks", http.HandlerFunc(handler.GetUserURLClicksHandler))
+				})
+				r.With(middleware.RequireScope(entities.ScopeDelete), middleware.RateLimit(middleware.RateLimitDelete)).
+					Delete("/", http.HandlerFunc(handler.DeleteUserUrlsHandler))
+				r.With(middleware.RequireScope(entities.ScopeShorten)).Patch("/{id}", http.HandlerFunc(handler.UpdateUserURLHandler))
+			})
+
+			r.With(middleware.SessionOnly).Post("/user/logout", http.HandlerFunc(handler.LogoutHandler))
+
+			r.Route("/user/keys", func(r chi.Router) {
+				r.Use(middleware.SessionOnly)
+				r.Post("/", http.HandlerFunc(handler.CreateAPIKeyHandler))
+				r.Get("/", http.HandlerFunc(handler.GetAPIKeysHandler))
+				r.Delete("/{id}", http.HandlerFunc(handler.DeleteAPIKeyHandler))
+			})
+
+			r.Get("/qr/{id}", http.HandlerFunc(handler.QRHandler))
+			r.Post("/auth/refresh", http.HandlerFunc(handler.RefreshTokenHandler))
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.SessionOnly)
+				r.Post("/auth/register", http.HandlerFunc(handler.RegisterHandler))
+				r.Post("/auth/login", http.HandlerFunc(handler.LoginHandler))
+			})
+
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(handler.AdminOnly)
+				r.Get("/urls", http.HandlerFunc(handler.AdminLookupURLHandler))
+				r.Put("/urls/{id}/flag", http.HandlerFunc(handler.AdminFlagURLHandler))
+				r.Put("/urls/{id}/disable", http.HandlerFunc(handler.AdminDisableURLHandler))
+				r.Put("/urls/{id}/owner", http.HandlerFunc(handler.AdminTransferURLHandler))
+				r.Delete("/urls/{id}", http.HandlerFunc(handler.AdminDeleteURLHandler))
+				r.Get("/users/{userID}/urls", http.HandlerFunc(handler.AdminGetUserURLsHandler))
+				r.Get("/audit", http.HandlerFunc(handler.AdminAuditLogHandler))
+			})
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RateLimit(middleware.RateLimitRedirect))
+			r.Get("/{id}", http.HandlerFunc(handler.GetHandler))
+			r.Head("/{id}", http.HandlerFunc(handler.GetHandler))
 		})
-		r.Get("/{id}", http.HandlerFunc(handler.GetHandler))
 		r.Get("/ping", http.HandlerFunc(handler.PingHandler))
 	})
 
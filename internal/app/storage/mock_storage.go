@@ -7,6 +7,7 @@ package storage
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 
@@ -50,6 +51,34 @@ func (mr *MockStorageMockRecorder) Add(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockStorage)(nil).Add), arg0)
 }
 
+// AddAPIKey mocks base method.
+func (m *MockStorage) AddAPIKey(arg0 context.Context, arg1 entities.APIKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddAPIKey", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddAPIKey indicates an expected call of AddAPIKey.
+func (mr *MockStorageMockRecorder) AddAPIKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAPIKey", reflect.TypeOf((*MockStorage)(nil).AddAPIKey), arg0, arg1)
+}
+
+// AddAuditEntry mocks base method.
+func (m *MockStorage) AddAuditEntry(arg0 context.Context, arg1 entities.AuditEntry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddAuditEntry", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddAuditEntry indicates an expected call of AddAuditEntry.
+func (mr *MockStorageMockRecorder) AddAuditEntry(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAuditEntry", reflect.TypeOf((*MockStorage)(nil).AddAuditEntry), arg0, arg1)
+}
+
 // AddBatch mocks base method.
 func (m *MockStorage) AddBatch(arg0 context.Context, arg1 []entities.URL) error {
 	m.ctrl.T.Helper()
@@ -64,6 +93,34 @@ func (mr *MockStorageMockRecorder) AddBatch(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBatch", reflect.TypeOf((*MockStorage)(nil).AddBatch), arg0, arg1)
 }
 
+// AddClick mocks base method.
+func (m *MockStorage) AddClick(arg0 context.Context, arg1 entities.Click) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddClick", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddClick indicates an expected call of AddClick.
+func (mr *MockStorageMockRecorder) AddClick(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddClick", reflect.TypeOf((*MockStorage)(nil).AddClick), arg0, arg1)
+}
+
+// AddUser mocks base method.
+func (m *MockStorage) AddUser(arg0 context.Context, arg1 entities.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddUser", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddUser indicates an expected call of AddUser.
+func (mr *MockStorageMockRecorder) AddUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUser", reflect.TypeOf((*MockStorage)(nil).AddUser), arg0, arg1)
+}
+
 // Close mocks base method.
 func (m *MockStorage) Close() error {
 	m.ctrl.T.Helper()
@@ -78,33 +135,150 @@ func (mr *MockStorageMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStorage)(nil).Close))
 }
 
+// DeleteAPIKey mocks base method.
+func (m *MockStorage) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAPIKey", ctx, userID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAPIKey indicates an expected call of DeleteAPIKey.
+func (mr *MockStorageMockRecorder) DeleteAPIKey(ctx, userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAPIKey", reflect.TypeOf((*MockStorage)(nil).DeleteAPIKey), ctx, userID, id)
+}
+
 // DeleteBatch mocks base method.
-func (m *MockStorage) DeleteBatch(arg0 context.Context, arg1 []string, arg2 string) error {
+func (m *MockStorage) DeleteBatch(ctx context.Context, domain string, shortURLs []string, userID string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteBatch", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "DeleteBatch", ctx, domain, shortURLs, userID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteBatch indicates an expected call of DeleteBatch.
-func (mr *MockStorageMockRecorder) DeleteBatch(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) DeleteBatch(ctx, domain, shortURLs, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBatch", reflect.TypeOf((*MockStorage)(nil).DeleteBatch), ctx, domain, shortURLs, userID)
+}
+
+// GetAuditLog mocks base method.
+func (m *MockStorage) GetAuditLog(ctx context.Context, limit int) ([]entities.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuditLog", ctx, limit)
+	ret0, _ := ret[0].([]entities.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAuditLog indicates an expected call of GetAuditLog.
+func (mr *MockStorageMockRecorder) GetAuditLog(ctx, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuditLog", reflect.TypeOf((*MockStorage)(nil).GetAuditLog), ctx, limit)
+}
+
+// GetClickStats mocks base method.
+func (m *MockStorage) GetClickStats(ctx context.Context, domain, shortURL string) ([]entities.ClickStat, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClickStats", ctx, domain, shortURL)
+	ret0, _ := ret[0].([]entities.ClickStat)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetClickStats indicates an expected call of GetClickStats.
+func (mr *MockStorageMockRecorder) GetClickStats(ctx, domain, shortURL interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBatch", reflect.TypeOf((*MockStorage)(nil).DeleteBatch), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClickStats", reflect.TypeOf((*MockStorage)(nil).GetClickStats), ctx, domain, shortURL)
 }
 
-// GetUserURLs mocks base method.
-func (m *MockStorage) GetUserURLs(arg0 context.Context, arg1 string) ([]entities.URL, error) {
+// GetURLHistory mocks base method.
+func (m *MockStorage) GetURLHistory(ctx context.Context, domain, shortURL string) ([]entities.URLHistory, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserURLs", arg0, arg1)
+	ret := m.ctrl.Call(m, "GetURLHistory", ctx, domain, shortURL)
+	ret0, _ := ret[0].([]entities.URLHistory)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetURLHistory indicates an expected call of GetURLHistory.
+func (mr *MockStorageMockRecorder) GetURLHistory(ctx, domain, shortURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetURLHistory", reflect.TypeOf((*MockStorage)(nil).GetURLHistory), ctx, domain, shortURL)
+}
+
+// GetUserAPIKeys mocks base method.
+func (m *MockStorage) GetUserAPIKeys(ctx context.Context, userID string) ([]entities.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserAPIKeys", ctx, userID)
+	ret0, _ := ret[0].([]entities.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserAPIKeys indicates an expected call of GetUserAPIKeys.
+func (mr *MockStorageMockRecorder) GetUserAPIKeys(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserAPIKeys", reflect.TypeOf((*MockStorage)(nil).GetUserAPIKeys), ctx, userID)
+}
+
+// GetUserURLsPage mocks base method.
+func (m *MockStorage) GetUserURLsPage(arg0 context.Context, arg1 UserURLsQuery) ([]entities.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserURLsPage", arg0, arg1)
 	ret0, _ := ret[0].([]entities.URL)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetUserURLs indicates an expected call of GetUserURLs.
-func (mr *MockStorageMockRecorder) GetUserURLs(arg0, arg1 interface{}) *gomock.Call {
+// GetUserURLsPage indicates an expected call of GetUserURLsPage.
+func (mr *MockStorageMockRecorder) GetUserURLsPage(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserURLs", reflect.TypeOf((*MockStorage)(nil).GetUserURLs), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserURLsPage", reflect.TypeOf((*MockStorage)(nil).GetUserURLsPage), arg0, arg1)
+}
+
+// IsTokenRevoked mocks base method.
+func (m *MockStorage) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsTokenRevoked", ctx, id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsTokenRevoked indicates an expected call of IsTokenRevoked.
+func (mr *MockStorageMockRecorder) IsTokenRevoked(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsTokenRevoked", reflect.TypeOf((*MockStorage)(nil).IsTokenRevoked), ctx, id)
+}
+
+// IterateUserURLs mocks base method.
+func (m *MockStorage) IterateUserURLs(ctx context.Context, query UserURLsQuery, fn func(entities.URL) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IterateUserURLs", ctx, query, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// IterateUserURLs indicates an expected call of IterateUserURLs.
+func (mr *MockStorageMockRecorder) IterateUserURLs(ctx, query, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IterateUserURLs", reflect.TypeOf((*MockStorage)(nil).IterateUserURLs), ctx, query, fn)
+}
+
+// MergeUser mocks base method.
+func (m *MockStorage) MergeUser(ctx context.Context, fromUserID, toUserID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeUser", ctx, fromUserID, toUserID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MergeUser indicates an expected call of MergeUser.
+func (mr *MockStorageMockRecorder) MergeUser(ctx, fromUserID, toUserID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeUser", reflect.TypeOf((*MockStorage)(nil).MergeUser), ctx, fromUserID, toUserID)
 }
 
 // Ping mocks base method.
@@ -121,17 +295,191 @@ func (mr *MockStorageMockRecorder) Ping() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockStorage)(nil).Ping))
 }
 
+// ReadAPIKeyByHash mocks base method.
+func (m *MockStorage) ReadAPIKeyByHash(ctx context.Context, hash string) (entities.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadAPIKeyByHash", ctx, hash)
+	ret0, _ := ret[0].(entities.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadAPIKeyByHash indicates an expected call of ReadAPIKeyByHash.
+func (mr *MockStorageMockRecorder) ReadAPIKeyByHash(ctx, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadAPIKeyByHash", reflect.TypeOf((*MockStorage)(nil).ReadAPIKeyByHash), ctx, hash)
+}
+
 // ReadByID mocks base method.
-func (m *MockStorage) ReadByID(arg0 context.Context, arg1 string) (entities.URL, error) {
+func (m *MockStorage) ReadByID(ctx context.Context, domain, id string) (entities.URL, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ReadByID", arg0, arg1)
+	ret := m.ctrl.Call(m, "ReadByID", ctx, domain, id)
 	ret0, _ := ret[0].(entities.URL)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // ReadByID indicates an expected call of ReadByID.
-func (mr *MockStorageMockRecorder) ReadByID(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) ReadByID(ctx, domain, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadByID", reflect.TypeOf((*MockStorage)(nil).ReadByID), ctx, domain, id)
+}
+
+// ReadByIDs mocks base method.
+func (m *MockStorage) ReadByIDs(ctx context.Context, domain string, ids []string) ([]entities.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadByIDs", ctx, domain, ids)
+	ret0, _ := ret[0].([]entities.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadByIDs indicates an expected call of ReadByIDs.
+func (mr *MockStorageMockRecorder) ReadByIDs(ctx, domain, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadByIDs", reflect.TypeOf((*MockStorage)(nil).ReadByIDs), ctx, domain, ids)
+}
+
+// ReadByOriginalURL mocks base method.
+func (m *MockStorage) ReadByOriginalURL(ctx context.Context, domain, originalURL string) (entities.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadByOriginalURL", ctx, domain, originalURL)
+	ret0, _ := ret[0].(entities.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadByOriginalURL indicates an expected call of ReadByOriginalURL.
+func (mr *MockStorageMockRecorder) ReadByOriginalURL(ctx, domain, originalURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadByOriginalURL", reflect.TypeOf((*MockStorage)(nil).ReadByOriginalURL), ctx, domain, originalURL)
+}
+
+// ReadByOriginalURLs mocks base method.
+func (m *MockStorage) ReadByOriginalURLs(ctx context.Context, domain string, originalURLs []string) ([]entities.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadByOriginalURLs", ctx, domain, originalURLs)
+	ret0, _ := ret[0].([]entities.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadByOriginalURLs indicates an expected call of ReadByOriginalURLs.
+func (mr *MockStorageMockRecorder) ReadByOriginalURLs(ctx, domain, originalURLs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadByOriginalURLs", reflect.TypeOf((*MockStorage)(nil).ReadByOriginalURLs), ctx, domain, originalURLs)
+}
+
+// ReadUserByID mocks base method.
+func (m *MockStorage) ReadUserByID(ctx context.Context, id string) (entities.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadUserByID", ctx, id)
+	ret0, _ := ret[0].(entities.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadUserByID indicates an expected call of ReadUserByID.
+func (mr *MockStorageMockRecorder) ReadUserByID(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadUserByID", reflect.TypeOf((*MockStorage)(nil).ReadUserByID), ctx, id)
+}
+
+// ReadUserByLogin mocks base method.
+func (m *MockStorage) ReadUserByLogin(ctx context.Context, login string) (entities.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadUserByLogin", ctx, login)
+	ret0, _ := ret[0].(entities.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadUserByLogin indicates an expected call of ReadUserByLogin.
+func (mr *MockStorageMockRecorder) ReadUserByLogin(ctx, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadUserByLogin", reflect.TypeOf((*MockStorage)(nil).ReadUserByLogin), ctx, login)
+}
+
+// Remove mocks base method.
+func (m *MockStorage) Remove(ctx context.Context, domain, shortURL string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Remove", ctx, domain, shortURL)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Remove indicates an expected call of Remove.
+func (mr *MockStorageMockRecorder) Remove(ctx, domain, shortURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockStorage)(nil).Remove), ctx, domain, shortURL)
+}
+
+// RevokeToken mocks base method.
+func (m *MockStorage) RevokeToken(ctx context.Context, id string, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeToken", ctx, id, expiresAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeToken indicates an expected call of RevokeToken.
+func (mr *MockStorageMockRecorder) RevokeToken(ctx, id, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeToken", reflect.TypeOf((*MockStorage)(nil).RevokeToken), ctx, id, expiresAt)
+}
+
+// SetDisabled mocks base method.
+func (m *MockStorage) SetDisabled(ctx context.Context, domain, shortURL string, disabled bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDisabled", ctx, domain, shortURL, disabled)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDisabled indicates an expected call of SetDisabled.
+func (mr *MockStorageMockRecorder) SetDisabled(ctx, domain, shortURL, disabled interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDisabled", reflect.TypeOf((*MockStorage)(nil).SetDisabled), ctx, domain, shortURL, disabled)
+}
+
+// SetFlagged mocks base method.
+func (m *MockStorage) SetFlagged(ctx context.Context, domain, shortURL string, flagged bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetFlagged", ctx, domain, shortURL, flagged)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetFlagged indicates an expected call of SetFlagged.
+func (mr *MockStorageMockRecorder) SetFlagged(ctx, domain, shortURL, flagged interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetFlagged", reflect.TypeOf((*MockStorage)(nil).SetFlagged), ctx, domain, shortURL, flagged)
+}
+
+// SetOwner mocks base method.
+func (m *MockStorage) SetOwner(ctx context.Context, domain, shortURL, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetOwner", ctx, domain, shortURL, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetOwner indicates an expected call of SetOwner.
+func (mr *MockStorageMockRecorder) SetOwner(ctx, domain, shortURL, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetOwner", reflect.TypeOf((*MockStorage)(nil).SetOwner), ctx, domain, shortURL, userID)
+}
+
+// UpdateOriginalURL mocks base method.
+func (m *MockStorage) UpdateOriginalURL(ctx context.Context, domain, shortURL, userID, originalURL string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOriginalURL", ctx, domain, shortURL, userID, originalURL)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOriginalURL indicates an expected call of UpdateOriginalURL.
+func (mr *MockStorageMockRecorder) UpdateOriginalURL(ctx, domain, shortURL, userID, originalURL interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadByID", reflect.TypeOf((*MockStorage)(nil).ReadByID), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOriginalURL", reflect.TypeOf((*MockStorage)(nil).UpdateOriginalURL), ctx, domain, shortURL, userID, originalURL)
 }
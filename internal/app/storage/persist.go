@@ -17,8 +17,21 @@ type Persister interface {
 	Restore(storage *MemStorage) error
 	// Save - функция, которая сохраняет состояние базы данных.
 	Save(entities.URL) error
+	// Remove - функция, которая сохраняет безвозвратное удаление сокращенной ссылки.
+	Remove(entities.URL) error
+	// SaveUser - функция, которая сохраняет учетную запись.
+	SaveUser(entities.User) error
+	// SaveAPIKey - функция, которая сохраняет ключ API.
+	SaveAPIKey(entities.APIKey) error
+	// RemoveAPIKey - функция, которая сохраняет отзыв ключа API.
+	RemoveAPIKey(entities.APIKey) error
+	// SaveAuditEntry - функция, которая сохраняет запись журнала действий администратора.
+	SaveAuditEntry(entities.AuditEntry) error
 }
 
+// fileStorageMode - права файла хранилища. В файле хранятся хеши паролей и ключей API, поэтому он доступен только владельцу.
+const fileStorageMode = 0600
+
 // FilePersister - структура сохранения состояния базы данных в файл.
 type FilePersister struct {
 	filePath string
@@ -31,7 +44,7 @@ func newPersister(filePath string) Persister {
 }
 
 func (fr *FilePersister) Restore(storage *MemStorage) error {
-	file, err := os.OpenFile(fr.filePath, os.O_RDONLY|os.O_CREATE, 0666)
+	file, err := os.OpenFile(fr.filePath, os.O_RDONLY|os.O_CREATE, fileStorageMode)
 	if err != nil {
 		return err
 	}
@@ -47,10 +60,57 @@ func (fr *FilePersister) Restore(storage *MemStorage) error {
 			return err
 		}
 
+		if record.User != nil {
+			storage.addUserWithoutPersisterSave(entities.User{
+				ID:           record.User.ID,
+				Login:        record.User.Login,
+				PasswordHash: record.User.PasswordHash,
+				CreatedAt:    record.User.CreatedAt,
+			})
+			continue
+		}
+
+		if record.AuditEntry != nil {
+			storage.addAuditEntryWithoutPersisterSave(entities.AuditEntry{
+				Actor:     record.AuditEntry.Actor,
+				Action:    record.AuditEntry.Action,
+				Domain:    record.AuditEntry.Domain,
+				ShortURL:  record.AuditEntry.ShortURL,
+				Details:   record.AuditEntry.Details,
+				CreatedAt: record.AuditEntry.CreatedAt,
+			})
+			continue
+		}
+
+		if record.APIKey != nil {
+			storage.restoreAPIKey(*record.APIKey)
+			continue
+		}
+
+		if record.RemovedFlag {
+			storage.removeWithoutPersisterSave(record.Domain, record.ShortURL)
+			continue
+		}
+
 		storage.AddWithoutPersisterSave(entities.URL{
-			UUID:        record.UUID,
-			ShortURL:    record.ShortURL,
-			OriginalURL: record.OriginalURL,
+			UUID:           record.UUID,
+			ShortURL:       record.ShortURL,
+			Domain:         record.Domain,
+			OriginalURL:    record.OriginalURL,
+			UserID:         record.UserID,
+			DeletedFlag:    record.DeletedFlag,
+			FlaggedFlag:    record.FlaggedFlag,
+			DisabledFlag:   record.DisabledFlag,
+			CreatedAt:      record.CreatedAt,
+			UpdatedAt:      record.UpdatedAt,
+			Title:          record.Title,
+			Tags:           record.Tags,
+			Notes:          record.Notes,
+			RedirectStatus: record.RedirectStatus,
+			QueryMode:      record.QueryMode,
+			DefaultQuery:   record.DefaultQuery,
+			Targets:        record.Targets,
+			ExpiresAt:      record.ExpiresAt,
 		})
 	}
 
@@ -62,21 +122,107 @@ func (fr *FilePersister) Restore(storage *MemStorage) error {
 }
 
 func (fr *FilePersister) Save(url entities.URL) error {
-	file, err := os.OpenFile(fr.filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		return err
-	}
-
-	defer file.Close()
+	return fr.write(
+		models.FileStorageRecord{
+			UUID:           uuid.NewString(),
+			ShortURL:       url.ShortURL,
+			Domain:         url.Domain,
+			OriginalURL:    url.OriginalURL,
+			UserID:         url.UserID,
+			DeletedFlag:    url.DeletedFlag,
+			FlaggedFlag:    url.FlaggedFlag,
+			DisabledFlag:   url.DisabledFlag,
+			CreatedAt:      url.CreatedAt,
+			UpdatedAt:      url.UpdatedAt,
+			Title:          url.Title,
+			Tags:           url.Tags,
+			Notes:          url.Notes,
+			RedirectStatus: url.RedirectStatus,
+			QueryMode:      url.QueryMode,
+			DefaultQuery:   url.DefaultQuery,
+			Targets:        url.Targets,
+			ExpiresAt:      url.ExpiresAt,
+		},
+	)
+}
 
-	jsonRecord, err := json.Marshal(
+func (fr *FilePersister) Remove(url entities.URL) error {
+	return fr.write(
 		models.FileStorageRecord{
 			UUID:        uuid.NewString(),
 			ShortURL:    url.ShortURL,
-			OriginalURL: url.OriginalURL,
+			Domain:      url.Domain,
+			RemovedFlag: true,
+		},
+	)
+}
+
+func (fr *FilePersister) SaveUser(user entities.User) error {
+	return fr.write(
+		models.FileStorageRecord{
+			UUID: uuid.NewString(),
+			User: &models.FileStorageUser{
+				ID:           user.ID,
+				Login:        user.Login,
+				PasswordHash: user.PasswordHash,
+				CreatedAt:    user.CreatedAt,
+			},
+		},
+	)
+}
+
+func (fr *FilePersister) SaveAPIKey(key entities.APIKey) error {
+	return fr.writeAPIKey(key, false)
+}
+
+func (fr *FilePersister) RemoveAPIKey(key entities.APIKey) error {
+	return fr.writeAPIKey(key, true)
+}
+
+func (fr *FilePersister) writeAPIKey(key entities.APIKey, revoked bool) error {
+	return fr.write(
+		models.FileStorageRecord{
+			UUID: uuid.NewString(),
+			APIKey: &models.FileStorageAPIKey{
+				ID:          key.ID,
+				UserID:      key.UserID,
+				Name:        key.Name,
+				Prefix:      key.Prefix,
+				Hash:        key.Hash,
+				Scopes:      key.Scopes,
+				CreatedAt:   key.CreatedAt,
+				ExpiresAt:   key.ExpiresAt,
+				RevokedFlag: revoked,
+			},
+		},
+	)
+}
+
+func (fr *FilePersister) SaveAuditEntry(entry entities.AuditEntry) error {
+	return fr.write(
+		models.FileStorageRecord{
+			UUID: uuid.NewString(),
+			AuditEntry: &models.FileStorageAuditEntry{
+				Actor:     entry.Actor,
+				Action:    entry.Action,
+				Domain:    entry.Domain,
+				ShortURL:  entry.ShortURL,
+				Details:   entry.Details,
+				CreatedAt: entry.CreatedAt,
+			},
 		},
 	)
+}
+
+func (fr *FilePersister) write(record models.FileStorageRecord) error {
+	file, err := os.OpenFile(fr.filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, fileStorageMode)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
 
+	jsonRecord, err := json.Marshal(record)
 	if err != nil {
 		return err
 	}
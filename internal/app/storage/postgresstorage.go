@@ -2,14 +2,38 @@ package storage
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
+	"go.uber.org/zap"
 
 	"github.com/VladKvetkin/shortener/internal/app/entities"
 )
 
+// uniqueViolationCode - код ошибки PostgreSQL при нарушении ограничения уникальности.
+const uniqueViolationCode = "23505"
+
+// urlShortURLIndex - уникальный индекс сокращенных ссылок в пределах домена.
+const urlShortURLIndex = "url_domain_short_url_key"
+
+// urlColumns - список колонок таблицы url, которые читаются в entities.URL.
+const urlColumns = "id, short_url, domain, original_url, user_id, is_deleted, is_flagged, is_disabled, created_at, updated_at, title, tags, notes, redirect_status, query_mode, default_query, targets, expires_at"
+
+// apiKeyColumns - список колонок таблицы api_key, которые читаются в entities.APIKey.
+const apiKeyColumns = "id, user_id, name, prefix, key_hash, scopes, created_at, expires_at"
+
+// userColumns - список колонок таблицы users, которые читаются в entities.User.
+const userColumns = "id, login, password_hash, created_at"
+
+// likeEscaper экранирует спецсимволы шаблона LIKE.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 // PostgresStorage - структура базы данных PostgreSQL
 type PostgresStorage struct {
 	db *sqlx.DB
@@ -28,23 +52,105 @@ func newPostgresStorage(db *sqlx.DB) (Storage, error) {
 	return storage, nil
 }
 
-func (s *PostgresStorage) GetUserURLs(ctx context.Context, userID string) ([]entities.URL, error) {
-	var userURLs []entities.URL
+func (s *PostgresStorage) GetUserURLsPage(ctx context.Context, query UserURLsQuery) ([]entities.URL, error) {
+	userURLs := []entities.URL{}
 
-	err := s.db.SelectContext(ctx, &userURLs, "SELECT original_url, short_url FROM url WHERE user_id = $1;", userID)
-	if err != nil {
+	sqlQuery, args := userURLsSQL(query)
+
+	if err := s.db.SelectContext(ctx, &userURLs, sqlQuery, args...); err != nil {
 		return nil, err
 	}
 
 	return userURLs, nil
 }
 
-func (s *PostgresStorage) ReadByID(ctx context.Context, id string) (entities.URL, error) {
+func (s *PostgresStorage) IterateUserURLs(ctx context.Context, query UserURLsQuery, fn func(entities.URL) error) error {
+	sqlQuery, args := userURLsSQL(query)
+
+	rows, err := s.db.QueryxContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var url entities.URL
+
+		if err := rows.StructScan(&url); err != nil {
+			return err
+		}
+
+		if err := fn(url); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// userURLsSQL - функция, которая строит SQL-запрос выборки сокращенных ссылок пользователя по UserURLsQuery.
+func userURLsSQL(query UserURLsQuery) (string, []interface{}) {
+	conditions := []string{"user_id = $1"}
+	args := []interface{}{query.UserID}
+
+	if !query.IncludeDeleted {
+		conditions = append(conditions, "is_deleted = FALSE")
+	}
+
+	if query.Search != "" {
+		args = append(args, "%"+likeEscaper.Replace(query.Search)+"%")
+		conditions = append(conditions, fmt.Sprintf("original_url LIKE $%d", len(args)))
+	}
+
+	if query.Tag != "" {
+		args = append(args, pq.Array([]string{query.Tag}))
+		conditions = append(conditions, fmt.Sprintf("tags @> $%d", len(args)))
+	}
+
+	order := "ASC"
+	comparison := ">"
+	if query.Desc {
+		order = "DESC"
+		comparison = "<"
+	}
+
+	if query.Cursor != nil {
+		args = append(args, query.Cursor.CreatedAt, query.Cursor.ShortURL, query.Cursor.Domain)
+		conditions = append(conditions, fmt.Sprintf(
+			"(created_at, short_url, domain) %s ($%d, $%d, $%d)",
+			comparison, len(args)-2, len(args)-1, len(args),
+		))
+	}
+
+	sqlQuery := fmt.Sprintf(
+		"SELECT %s FROM url WHERE %s ORDER BY created_at %s, short_url %s, domain %s",
+		urlColumns, strings.Join(conditions, " AND "), order, order, order,
+	)
+
+	if query.Limit > 0 {
+		args = append(args, query.Limit)
+		sqlQuery += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	return sqlQuery, args
+}
+
+func (s *PostgresStorage) ReadByID(ctx context.Context, domain string, id string) (entities.URL, error) {
 	var url entities.URL
 
-	row := s.db.QueryRowxContext(ctx, "SELECT id, short_url, original_url, user_id, is_deleted FROM url WHERE short_url = $1;", id)
+	err := s.db.GetContext(ctx, &url, "SELECT "+urlColumns+" FROM url WHERE domain = $1 AND short_url = $2;", domain, id)
+	if err != nil {
+		return entities.URL{}, ErrIDNotExists
+	}
+
+	return url, nil
+}
+
+func (s *PostgresStorage) ReadByOriginalURL(ctx context.Context, domain string, originalURL string) (entities.URL, error) {
+	var url entities.URL
 
-	err := row.Scan(&url.UUID, &url.ShortURL, &url.OriginalURL, &url.UserID, &url.DeletedFlag)
+	err := s.db.GetContext(ctx, &url, "SELECT "+urlColumns+" FROM url WHERE domain = $1 AND original_url = $2;", domain, originalURL)
 	if err != nil {
 		return entities.URL{}, ErrIDNotExists
 	}
@@ -52,6 +158,119 @@ func (s *PostgresStorage) ReadByID(ctx context.Context, id string) (entities.URL
 	return url, nil
 }
 
+func (s *PostgresStorage) ReadByIDs(ctx context.Context, domain string, ids []string) ([]entities.URL, error) {
+	urls := []entities.URL{}
+
+	err := s.db.SelectContext(ctx, &urls, "SELECT "+urlColumns+" FROM url WHERE domain = $1 AND short_url = ANY($2);", domain, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+func (s *PostgresStorage) ReadByOriginalURLs(ctx context.Context, domain string, originalURLs []string) ([]entities.URL, error) {
+	urls := []entities.URL{}
+
+	err := s.db.SelectContext(
+		ctx,
+		&urls,
+		"SELECT "+urlColumns+" FROM url WHERE domain = $1 AND original_url = ANY($2);",
+		domain, pq.Array(originalURLs),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+func (s *PostgresStorage) UpdateOriginalURL(ctx context.Context, domain string, shortURL string, userID string, originalURL string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var url entities.URL
+
+	row := tx.QueryRowxContext(
+		ctx,
+		"SELECT original_url, user_id, is_deleted FROM url WHERE domain = $1 AND short_url = $2 FOR UPDATE;",
+		domain, shortURL,
+	)
+	if err := row.Scan(&url.OriginalURL, &url.UserID, &url.DeletedFlag); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrIDNotExists
+		}
+
+		return err
+	}
+
+	if url.UserID != userID {
+		return ErrURLNotOwned
+	}
+
+	if url.DeletedFlag {
+		return ErrURLDeleted
+	}
+
+	if url.OriginalURL == originalURL {
+		return nil
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`
+			INSERT INTO url_history (short_url, domain, original_url, changed_at)
+			VALUES ($1, $2, $3, NOW());
+		`,
+		shortURL, domain, url.OriginalURL,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`
+			UPDATE url SET original_url = $1, updated_at = NOW() WHERE domain = $2 AND short_url = $3;
+		`,
+		originalURL, domain, shortURL,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode {
+			return ErrOriginalURLExists
+		}
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStorage) GetURLHistory(ctx context.Context, domain string, shortURL string) ([]entities.URLHistory, error) {
+	history := []entities.URLHistory{}
+
+	err := s.db.SelectContext(
+		ctx,
+		&history,
+		`
+			SELECT short_url, original_url, changed_at FROM url_history
+			WHERE domain = $1 AND short_url = $2
+			ORDER BY changed_at DESC, id DESC;
+		`,
+		domain, shortURL,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
 func (s *PostgresStorage) AddBatch(ctx context.Context, urls []entities.URL) error {
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -62,28 +281,298 @@ func (s *PostgresStorage) AddBatch(ctx context.Context, urls []entities.URL) err
 		_, err := tx.ExecContext(
 			ctx,
 			`
-				INSERT INTO url (id, short_url, original_url, user_id)
-				VALUES ($1, $2, $3, $4);
+				INSERT INTO url (id, short_url, domain, original_url, user_id, title, tags, notes, redirect_status, query_mode, default_query, targets, expires_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13);
 			`,
-			uuid.NewString(), url.ShortURL, url.OriginalURL, url.UserID,
+			uuid.NewString(), url.ShortURL, url.Domain, url.OriginalURL, url.UserID, url.Title, tags(url), url.Notes, url.RedirectStatus,
+			url.QueryMode, url.DefaultQuery, url.Targets, url.ExpiresAt,
 		)
 
 		if err != nil {
 			tx.Rollback()
-			return err
+			return insertURLError(err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStorage) DeleteBatch(ctx context.Context, domain string, shortURLs []string, userID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`
+			UPDATE url SET is_deleted = TRUE WHERE user_id = $1 AND domain = $2 AND short_url = ANY($3)
+		`,
+		userID, domain, pq.Array(shortURLs),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) SetFlagged(ctx context.Context, domain string, shortURL string, flagged bool) error {
+	return s.updateURL(
+		ctx,
+		`
+			UPDATE url SET is_flagged = $1, updated_at = NOW() WHERE domain = $2 AND short_url = $3
+		`,
+		flagged, domain, shortURL,
+	)
+}
+
+func (s *PostgresStorage) SetDisabled(ctx context.Context, domain string, shortURL string, disabled bool) error {
+	return s.updateURL(
+		ctx,
+		`
+			UPDATE url SET is_disabled = $1, updated_at = NOW() WHERE domain = $2 AND short_url = $3
+		`,
+		disabled, domain, shortURL,
+	)
+}
+
+func (s *PostgresStorage) SetOwner(ctx context.Context, domain string, shortURL string, userID string) error {
+	return s.updateURL(
+		ctx,
+		`
+			UPDATE url SET user_id = $1, updated_at = NOW() WHERE domain = $2 AND short_url = $3
+		`,
+		userID, domain, shortURL,
+	)
+}
+
+func (s *PostgresStorage) Remove(ctx context.Context, domain string, shortURL string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM url WHERE domain = $1 AND short_url = $2;", domain, shortURL)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrIDNotExists
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM url_history WHERE domain = $1 AND short_url = $2;", domain, shortURL); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM url_click WHERE domain = $1 AND short_url = $2;", domain, shortURL); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateURL выполняет запрос изменения одной сокращенной ссылки. Если ссылка не найдена, то возвращается ErrIDNotExists.
+func (s *PostgresStorage) updateURL(ctx context.Context, query string, args ...interface{}) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrIDNotExists
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) AddClick(ctx context.Context, click entities.Click) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`
+			INSERT INTO url_click (short_url, domain, variant, device, clicked_at)
+			VALUES ($1, $2, $3, $4, $5);
+		`,
+		click.ShortURL, click.Domain, click.Variant, click.Device, click.ClickedAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) GetClickStats(ctx context.Context, domain string, shortURL string) ([]entities.ClickStat, error) {
+	stats := make([]entities.ClickStat, 0)
+
+	err := s.db.SelectContext(
+		ctx,
+		&stats,
+		`
+			SELECT variant, COUNT(*) AS count FROM url_click
+			WHERE domain = $1 AND short_url = $2
+			GROUP BY variant ORDER BY variant;
+		`,
+		domain, shortURL,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func (s *PostgresStorage) AddAPIKey(ctx context.Context, key entities.APIKey) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`
+			INSERT INTO api_key (id, user_id, name, prefix, key_hash, scopes, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7);
+		`,
+		key.ID, key.UserID, key.Name, key.Prefix, key.Hash, key.Scopes, key.ExpiresAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) GetUserAPIKeys(ctx context.Context, userID string) ([]entities.APIKey, error) {
+	keys := make([]entities.APIKey, 0)
+
+	err := s.db.SelectContext(
+		ctx,
+		&keys,
+		"SELECT "+apiKeyColumns+" FROM api_key WHERE user_id = $1 ORDER BY created_at, id;",
+		userID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (s *PostgresStorage) ReadAPIKeyByHash(ctx context.Context, hash string) (entities.APIKey, error) {
+	var key entities.APIKey
+
+	err := s.db.GetContext(ctx, &key, "SELECT "+apiKeyColumns+" FROM api_key WHERE key_hash = $1;", hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.APIKey{}, ErrAPIKeyNotExists
+		}
+
+		return entities.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+func (s *PostgresStorage) DeleteAPIKey(ctx context.Context, userID string, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM api_key WHERE id = $1 AND user_id = $2;", id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrAPIKeyNotExists
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) AddUser(ctx context.Context, user entities.User) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO users (id, login, password_hash) VALUES ($1, $2, $3);",
+		user.ID, user.Login, user.PasswordHash,
+	)
+
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode {
+			return ErrUserExists
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) ReadUserByLogin(ctx context.Context, login string) (entities.User, error) {
+	return s.readUser(ctx, "login", login)
+}
+
+func (s *PostgresStorage) ReadUserByID(ctx context.Context, id string) (entities.User, error) {
+	return s.readUser(ctx, "id", id)
+}
+
+func (s *PostgresStorage) readUser(ctx context.Context, column string, value string) (entities.User, error) {
+	var user entities.User
+
+	err := s.db.GetContext(ctx, &user, "SELECT "+userColumns+" FROM users WHERE "+column+" = $1;", value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.User{}, ErrUserNotExists
 		}
+
+		return entities.User{}, err
+	}
+
+	return user, nil
+}
+
+func (s *PostgresStorage) MergeUser(ctx context.Context, fromUserID string, toUserID string) error {
+	if fromUserID == toUserID {
+		return nil
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE url SET user_id = $1 WHERE user_id = $2;", toUserID, fromUserID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE api_key SET user_id = $1 WHERE user_id = $2;", toUserID, fromUserID); err != nil {
+		return err
 	}
 
 	return tx.Commit()
 }
 
-func (s *PostgresStorage) DeleteBatch(ctx context.Context, shortURLs []string, userID string) error {
+func (s *PostgresStorage) AddAuditEntry(ctx context.Context, entry entities.AuditEntry) error {
 	_, err := s.db.ExecContext(
 		ctx,
 		`
-			UPDATE url SET is_deleted = TRUE WHERE user_id = $1 AND short_url = ANY($2)
+			INSERT INTO admin_audit (actor, action, domain, short_url, details)
+			VALUES ($1, $2, $3, $4, $5);
 		`,
-		userID, pq.Array(shortURLs),
+		entry.Actor, entry.Action, entry.Domain, entry.ShortURL, entry.Details,
 	)
 
 	if err != nil {
@@ -93,23 +582,99 @@ func (s *PostgresStorage) DeleteBatch(ctx context.Context, shortURLs []string, u
 	return nil
 }
 
+func (s *PostgresStorage) GetAuditLog(ctx context.Context, limit int) ([]entities.AuditEntry, error) {
+	entries := make([]entities.AuditEntry, 0)
+
+	err := s.db.SelectContext(
+		ctx,
+		&entries,
+		"SELECT id, actor, action, domain, short_url, details, created_at FROM admin_audit ORDER BY id DESC LIMIT $1;",
+		limit,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (s *PostgresStorage) RevokeToken(ctx context.Context, id string, expiresAt time.Time) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM revoked_token WHERE expires_at <= NOW();"); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`
+			INSERT INTO revoked_token (id, expires_at) VALUES ($1, $2)
+			ON CONFLICT (id) DO UPDATE SET expires_at = GREATEST(revoked_token.expires_at, EXCLUDED.expires_at);
+		`,
+		id, expiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStorage) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	var revoked bool
+
+	err := s.db.GetContext(
+		ctx,
+		&revoked,
+		"SELECT EXISTS (SELECT 1 FROM revoked_token WHERE id = $1 AND expires_at > NOW());",
+		id,
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
 func (s *PostgresStorage) Add(url entities.URL) error {
 	_, err := s.db.ExecContext(
 		context.Background(),
 		`
-			INSERT INTO url (id, short_url, original_url, user_id)
-			VALUES ($1, $2, $3, $4);
+			INSERT INTO url (id, short_url, domain, original_url, user_id, title, tags, notes, redirect_status, query_mode, default_query, targets, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13);
 		`,
-		uuid.NewString(), url.ShortURL, url.OriginalURL, url.UserID,
+		uuid.NewString(), url.ShortURL, url.Domain, url.OriginalURL, url.UserID, url.Title, tags(url), url.Notes, url.RedirectStatus,
+		url.QueryMode, url.DefaultQuery, url.Targets, url.ExpiresAt,
 	)
 
 	if err != nil {
-		return err
+		return insertURLError(err)
 	}
 
 	return nil
 }
 
+// insertURLError заменяет нарушение уникальности при добавлении ссылки на ErrIDExists или ErrOriginalURLExists.
+func insertURLError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != uniqueViolationCode {
+		return err
+	}
+
+	if pqErr.Constraint == urlShortURLIndex {
+		return ErrIDExists
+	}
+
+	return ErrOriginalURLExists
+}
+
 func (s *PostgresStorage) Ping() error {
 	return s.db.Ping()
 }
@@ -118,14 +683,51 @@ func (s *PostgresStorage) Close() error {
 	return s.db.Close()
 }
 
+// tags возвращает теги url, пустой массив вместо nil, так как колонка tags NOT NULL.
+func tags(url entities.URL) pq.StringArray {
+	if url.Tags == nil {
+		return pq.StringArray{}
+	}
+
+	return url.Tags
+}
+
 func (s *PostgresStorage) createTables(ctx context.Context) error {
 	if err := s.createTableURL(ctx); err != nil {
 		return err
 	}
 
+	if err := s.createTableURLHistory(ctx); err != nil {
+		return err
+	}
+
+	if err := s.createTableURLClick(ctx); err != nil {
+		return err
+	}
+
+	if err := s.createTableAPIKey(ctx); err != nil {
+		return err
+	}
+
+	if err := s.createTableUsers(ctx); err != nil {
+		return err
+	}
+
+	if err := s.createTableAdminAudit(ctx); err != nil {
+		return err
+	}
+
+	if err := s.createTableRevokedToken(ctx); err != nil {
+		return err
+	}
+
+	s.createSearchIndex(ctx)
+
 	return nil
 }
 
+// createTableURL создает таблицу url. Время хранится с часовым поясом: время без него сравнивается
+// с курсором выборки со сдвигом на часовой пояс сессии, и страницы пропускают или повторяют ссылки.
 func (s PostgresStorage) createTableURL(ctx context.Context) error {
 	_, err := s.db.ExecContext(
 		ctx,
@@ -133,10 +735,202 @@ func (s PostgresStorage) createTableURL(ctx context.Context) error {
 		CREATE TABLE IF NOT EXISTS url (
 			id VARCHAR(36) PRIMARY KEY,
 			short_url VARCHAR(255) NOT NULL,
-			original_url TEXT NOT NULL UNIQUE,
+			original_url TEXT NOT NULL,
 			user_id VARCHAR(36) NOT NULL,
 			is_deleted BOOLEAN DEFAULT FALSE
 		);
+
+		ALTER TABLE url ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+		ALTER TABLE url ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+		ALTER TABLE url ADD COLUMN IF NOT EXISTS title VARCHAR(255) NOT NULL DEFAULT '';
+		ALTER TABLE url ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+		ALTER TABLE url ADD COLUMN IF NOT EXISTS notes TEXT NOT NULL DEFAULT '';
+		ALTER TABLE url ADD COLUMN IF NOT EXISTS is_flagged BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE url ADD COLUMN IF NOT EXISTS redirect_status INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE url ADD COLUMN IF NOT EXISTS query_mode VARCHAR(16) NOT NULL DEFAULT '';
+		ALTER TABLE url ADD COLUMN IF NOT EXISTS default_query TEXT NOT NULL DEFAULT '';
+		ALTER TABLE url ADD COLUMN IF NOT EXISTS targets JSONB NOT NULL DEFAULT '[]';
+		ALTER TABLE url ADD COLUMN IF NOT EXISTS domain VARCHAR(255) NOT NULL DEFAULT '';
+		ALTER TABLE url ADD COLUMN IF NOT EXISTS is_disabled BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE url ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+		ALTER TABLE url ALTER COLUMN updated_at TYPE TIMESTAMPTZ, ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+
+		ALTER TABLE url DROP CONSTRAINT IF EXISTS url_original_url_key;
+		DROP INDEX IF EXISTS url_short_url_idx;
+		DROP INDEX IF EXISTS url_domain_short_url_idx;
+		DROP INDEX IF EXISTS url_user_id_created_at_idx;
+
+		CREATE UNIQUE INDEX IF NOT EXISTS url_domain_original_url_idx ON url (domain, original_url);
+		CREATE UNIQUE INDEX IF NOT EXISTS url_domain_short_url_key ON url (domain, short_url);
+		CREATE INDEX IF NOT EXISTS url_user_id_created_at_domain_idx ON url (user_id, created_at, short_url, domain);
+		CREATE INDEX IF NOT EXISTS url_tags_idx ON url USING GIN (tags);
+		`,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createSearchIndex создает триграммный индекс для поиска по подстроке оригинальной ссылки.
+// Для расширения pg_trgm нужны права, поэтому при ошибке поиск продолжает работать без индекса.
+func (s PostgresStorage) createSearchIndex(ctx context.Context) {
+	_, err := s.db.ExecContext(
+		ctx,
+		`
+		CREATE EXTENSION IF NOT EXISTS pg_trgm;
+		CREATE INDEX IF NOT EXISTS url_original_url_trgm_idx ON url USING GIN (original_url gin_trgm_ops);
+		`,
+	)
+
+	if err != nil {
+		zap.L().Sugar().Warnw(
+			"Cannot create search index",
+			"err", err,
+		)
+	}
+}
+
+func (s PostgresStorage) createTableURLHistory(ctx context.Context) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`
+		CREATE TABLE IF NOT EXISTS url_history (
+			id BIGSERIAL PRIMARY KEY,
+			short_url VARCHAR(255) NOT NULL,
+			original_url TEXT NOT NULL,
+			changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+
+		ALTER TABLE url_history ADD COLUMN IF NOT EXISTS domain VARCHAR(255) NOT NULL DEFAULT '';
+		ALTER TABLE url_history ALTER COLUMN changed_at TYPE TIMESTAMPTZ;
+
+		DROP INDEX IF EXISTS url_history_short_url_idx;
+		CREATE INDEX IF NOT EXISTS url_history_domain_short_url_idx ON url_history (domain, short_url);
+		`,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s PostgresStorage) createTableURLClick(ctx context.Context) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`
+		CREATE TABLE IF NOT EXISTS url_click (
+			id BIGSERIAL PRIMARY KEY,
+			short_url VARCHAR(255) NOT NULL,
+			variant VARCHAR(64) NOT NULL DEFAULT '',
+			device VARCHAR(16) NOT NULL DEFAULT '',
+			clicked_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+
+		ALTER TABLE url_click ADD COLUMN IF NOT EXISTS domain VARCHAR(255) NOT NULL DEFAULT '';
+		ALTER TABLE url_click ALTER COLUMN clicked_at TYPE TIMESTAMPTZ;
+
+		DROP INDEX IF EXISTS url_click_short_url_idx;
+		CREATE INDEX IF NOT EXISTS url_click_domain_short_url_idx ON url_click (domain, short_url, variant);
+		`,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s PostgresStorage) createTableAPIKey(ctx context.Context) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`
+		CREATE TABLE IF NOT EXISTS api_key (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL,
+			name VARCHAR(64) NOT NULL,
+			prefix VARCHAR(16) NOT NULL,
+			key_hash CHAR(64) NOT NULL UNIQUE,
+			scopes TEXT[] NOT NULL DEFAULT '{}',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMPTZ
+		);
+
+		ALTER TABLE api_key ALTER COLUMN created_at TYPE TIMESTAMPTZ, ALTER COLUMN expires_at TYPE TIMESTAMPTZ;
+
+		CREATE INDEX IF NOT EXISTS api_key_user_id_idx ON api_key (user_id, created_at);
+		`,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s PostgresStorage) createTableUsers(ctx context.Context) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`
+		CREATE TABLE IF NOT EXISTS users (
+			id VARCHAR(36) PRIMARY KEY,
+			login VARCHAR(64) NOT NULL UNIQUE,
+			password_hash VARCHAR(60) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+
+		ALTER TABLE users ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+		`,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s PostgresStorage) createTableAdminAudit(ctx context.Context) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`
+		CREATE TABLE IF NOT EXISTS admin_audit (
+			id BIGSERIAL PRIMARY KEY,
+			actor VARCHAR(64) NOT NULL,
+			action VARCHAR(32) NOT NULL,
+			domain VARCHAR(255) NOT NULL DEFAULT '',
+			short_url VARCHAR(255) NOT NULL DEFAULT '',
+			details TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+
+		ALTER TABLE admin_audit ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+		`,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s PostgresStorage) createTableRevokedToken(ctx context.Context) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`
+		CREATE TABLE IF NOT EXISTS revoked_token (
+			id VARCHAR(36) PRIMARY KEY,
+			expires_at TIMESTAMPTZ NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS revoked_token_expires_at_idx ON revoked_token (expires_at);
 		`,
 	)
 
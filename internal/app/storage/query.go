@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"strings"
+	"time"
+
+	"github.com/VladKvetkin/shortener/internal/app/entities"
+)
+
+// UserURLsQuery - структура, которая описывает параметры выборки сокращенных ссылок пользователя.
+type UserURLsQuery struct {
+	// UserID - идентификатор пользователя.
+	UserID string
+	// Limit - максимальное количество ссылок в выборке.
+	Limit int
+	// Cursor - позиция, после которой начинается выборка. Если nil, то выборка начинается с начала.
+	Cursor *Cursor
+	// Desc - сортировка по времени создания от новых к старым.
+	Desc bool
+	// Search - подстрока, которую должна содержать оригинальная ссылка.
+	Search string
+	// Tag - тег, который должен быть у ссылки.
+	Tag string
+	// IncludeDeleted - включать ли в выборку удаленные ссылки.
+	IncludeDeleted bool
+}
+
+// Cursor - структура, которая описывает позицию в выборке сокращенных ссылок пользователя.
+// Позиция задается временем создания, сокращенной ссылкой и доменом последнего элемента предыдущей страницы:
+// одна и та же сокращенная ссылка может быть в нескольких доменах.
+type Cursor struct {
+	CreatedAt time.Time
+	ShortURL  string
+	Domain    string
+}
+
+// after - функция, которая проверяет, что ссылка url идет в выборке после курсора.
+func (c Cursor) after(url entities.URL, desc bool) bool {
+	return compareURLs(url, entities.URL{CreatedAt: c.CreatedAt, ShortURL: c.ShortURL, Domain: c.Domain}, desc) > 0
+}
+
+// compareURLs - функция, которая сравнивает порядок ссылок first и second в выборке:
+// по времени создания, затем по сокращенной ссылке и по домену.
+func compareURLs(first entities.URL, second entities.URL, desc bool) int {
+	result := 0
+
+	switch {
+	case !first.CreatedAt.Equal(second.CreatedAt):
+		result = 1
+		if first.CreatedAt.Before(second.CreatedAt) {
+			result = -1
+		}
+	case first.ShortURL != second.ShortURL:
+		result = strings.Compare(first.ShortURL, second.ShortURL)
+	default:
+		result = strings.Compare(first.Domain, second.Domain)
+	}
+
+	if desc {
+		return -result
+	}
+
+	return result
+}
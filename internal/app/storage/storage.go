@@ -5,44 +5,147 @@ package storage
 import (
 	"context"
 	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/VladKvetkin/shortener/internal/app/entities"
+	"github.com/VladKvetkin/shortener/internal/app/models"
 )
 
 var (
 	// ErrIDNotExists - ошибка, которая означает, что сокращенная ссылка не найдена в базе данных.
 	ErrIDNotExists = errors.New("id not exists")
+	// ErrURLNotOwned - ошибка, которая означает, что сокращенная ссылка принадлежит другому пользователю.
+	ErrURLNotOwned = errors.New("url is owned by another user")
+	// ErrURLDeleted - ошибка, которая означает, что сокращенная ссылка удалена.
+	ErrURLDeleted = errors.New("url is deleted")
+	// ErrIDExists - ошибка, которая означает, что сокращенная ссылка уже занята.
+	ErrIDExists = errors.New("id already exists")
+	// ErrURLDisabled - ошибка, которая означает, что сокращенную ссылку отключил администратор.
+	ErrURLDisabled = errors.New("url is disabled")
+	// ErrURLExpired - ошибка, которая означает, что срок действия сокращенной ссылки истек.
+	ErrURLExpired = errors.New("url is expired")
+	// ErrOriginalURLExists - ошибка, которая означает, что оригинальная ссылка уже сокращена.
+	ErrOriginalURLExists = errors.New("original url already exists")
+	// ErrAPIKeyNotExists - ошибка, которая означает, что ключ API не найден в базе данных.
+	ErrAPIKeyNotExists = errors.New("api key not exists")
+	// ErrUserExists - ошибка, которая означает, что учетная запись с таким логином уже есть.
+	ErrUserExists = errors.New("user already exists")
+	// ErrUserNotExists - ошибка, которая означает, что учетная запись не найдена в базе данных.
+	ErrUserNotExists = errors.New("user not exists")
 )
 
 // Storage - интерфейс базы данных приложения.
+// Сокращенные ссылки уникальны в пределах домена, domain - хост домена или пустая строка для домена по умолчанию.
 type Storage interface {
 	// ReadByID - функция для получения entities.URL из базы данных.
-	ReadByID(context.Context, string) (entities.URL, error)
+	ReadByID(ctx context.Context, domain string, id string) (entities.URL, error)
+	// ReadByOriginalURL - функция для получения entities.URL по оригинальной ссылке из базы данных.
+	ReadByOriginalURL(ctx context.Context, domain string, originalURL string) (entities.URL, error)
+	// ReadByIDs - функция для получения entities.URL по массиву сокращенных ссылок из базы данных.
+	// Сокращенные ссылки, которых нет в базе данных, пропускаются.
+	ReadByIDs(ctx context.Context, domain string, ids []string) ([]entities.URL, error)
+	// ReadByOriginalURLs - функция для получения entities.URL по массиву оригинальных ссылок из базы данных.
+	// Оригинальные ссылки, которых нет в базе данных, пропускаются.
+	ReadByOriginalURLs(ctx context.Context, domain string, originalURLs []string) ([]entities.URL, error)
 	// Add - функция для добавления entities.URL в базу данных.
+	// Если сокращенная ссылка уже занята, то возвращается ErrIDExists, если оригинальная ссылка уже сокращена - ErrOriginalURLExists.
 	Add(entities.URL) error
 	// Ping - функция для проверки работоспособности базы данных.
 	Ping() error
 	// AddBatch - функция для добавления массива entities.URL в базу данных.
+	// Массив добавляется целиком или не добавляется вовсе, ошибки те же, что у Add.
 	AddBatch(context.Context, []entities.URL) error
 	// DeleteBatch - функция для удаления сокращенных ссылок из базы данных.
-	DeleteBatch(context.Context, []string, string) error
+	DeleteBatch(ctx context.Context, domain string, shortURLs []string, userID string) error
+	// UpdateOriginalURL - функция для изменения оригинальной ссылки у сокращенной ссылки пользователя.
+	// Предыдущая оригинальная ссылка сохраняется в истории изменений.
+	UpdateOriginalURL(ctx context.Context, domain string, shortURL string, userID string, originalURL string) error
+	// GetURLHistory - функция для получения истории изменений оригинальной ссылки, от новых к старым.
+	GetURLHistory(ctx context.Context, domain string, shortURL string) ([]entities.URLHistory, error)
+	// SetFlagged - функция для установки и снятия признака, что перед переходом по ссылке нужно показать предупреждение.
+	SetFlagged(ctx context.Context, domain string, shortURL string, flagged bool) error
+	// SetDisabled - функция для отключения и включения сокращенной ссылки администратором.
+	SetDisabled(ctx context.Context, domain string, shortURL string, disabled bool) error
+	// SetOwner - функция для передачи сокращенной ссылки другому пользователю.
+	SetOwner(ctx context.Context, domain string, shortURL string, userID string) error
+	// Remove - функция для безвозвратного удаления сокращенной ссылки вместе с историей и переходами.
+	Remove(ctx context.Context, domain string, shortURL string) error
+	// AddClick - функция для записи перехода по сокращенной ссылке.
+	AddClick(context.Context, entities.Click) error
+	// GetClickStats - функция для получения количества переходов по сокращенной ссылке в разрезе вариантов.
+	GetClickStats(ctx context.Context, domain string, shortURL string) ([]entities.ClickStat, error)
 	// Close - функция для закрытия соединения с базой данных.
 	Close() error
-	// ReadByID - функция для получения массива entities.URL из базы данных.
-	GetUserURLs(context.Context, string) ([]entities.URL, error)
+	// GetUserURLsPage - функция для получения страницы entities.URL пользователя,
+	// отсортированной по времени создания и отфильтрованной по UserURLsQuery.
+	GetUserURLsPage(context.Context, UserURLsQuery) ([]entities.URL, error)
+	// IterateUserURLs - функция, которая по очереди передает в fn entities.URL пользователя, отобранные по UserURLsQuery,
+	// не загружая всю выборку в память. Если fn возвращает ошибку, обход прекращается и ошибка возвращается.
+	IterateUserURLs(ctx context.Context, query UserURLsQuery, fn func(entities.URL) error) error
+	// AddAPIKey - функция для добавления ключа API пользователя в базу данных.
+	AddAPIKey(context.Context, entities.APIKey) error
+	// GetUserAPIKeys - функция для получения ключей API пользователя, от старых к новым.
+	GetUserAPIKeys(ctx context.Context, userID string) ([]entities.APIKey, error)
+	// ReadAPIKeyByHash - функция для получения ключа API по его хешу.
+	ReadAPIKeyByHash(ctx context.Context, hash string) (entities.APIKey, error)
+	// DeleteAPIKey - функция для отзыва ключа API пользователя.
+	// Если у пользователя нет ключа с таким идентификатором, то возвращается ErrAPIKeyNotExists.
+	DeleteAPIKey(ctx context.Context, userID string, id string) error
+	// AddUser - функция для добавления учетной записи. Если логин занят, то возвращается ErrUserExists.
+	AddUser(context.Context, entities.User) error
+	// ReadUserByLogin - функция для получения учетной записи по логину.
+	ReadUserByLogin(ctx context.Context, login string) (entities.User, error)
+	// ReadUserByID - функция для получения учетной записи по идентификатору пользователя.
+	ReadUserByID(ctx context.Context, id string) (entities.User, error)
+	// MergeUser - функция, которая передает сокращенные ссылки и ключи API пользователя fromUserID пользователю toUserID.
+	MergeUser(ctx context.Context, fromUserID string, toUserID string) error
+	// AddAuditEntry - функция для записи действия администратора в журнал.
+	AddAuditEntry(context.Context, entities.AuditEntry) error
+	// GetAuditLog - функция для получения последних limit записей журнала действий администратора, от новых к старым.
+	GetAuditLog(ctx context.Context, limit int) ([]entities.AuditEntry, error)
+	// RevokeToken - функция для отзыва сессии JWT-токенов с идентификатором id.
+	// Запись об отзыве хранится до expiresAt, после этого все токены сессии уже истекли.
+	RevokeToken(ctx context.Context, id string, expiresAt time.Time) error
+	// IsTokenRevoked - функция для проверки, что сессия JWT-токенов с идентификатором id отозвана.
+	IsTokenRevoked(ctx context.Context, id string) (bool, error)
+}
+
+// urlKey - ключ сокращенной или оригинальной ссылки в пределах домена.
+type urlKey struct {
+	domain string
+	value  string
 }
 
 // MemStorage - структура базы данных, которая хранит данные в мапе.
 type MemStorage struct {
-	storage   map[string]string
+	mu        sync.RWMutex
+	storage   map[urlKey]entities.URL
+	originals map[urlKey]string
+	users     map[string]map[urlKey]struct{}
+	history   map[urlKey][]entities.URLHistory
+	clicks    map[urlKey]map[string]int64
+	apiKeys   map[string]entities.APIKey
+	accounts  map[string]entities.User
+	audit     []entities.AuditEntry
+	revoked   map[string]time.Time
 	persister Persister
 }
 
 func newMemStorage(persister Persister) Storage {
 	storage := &MemStorage{
-		storage:   make(map[string]string),
+		storage:   make(map[urlKey]entities.URL),
+		originals: make(map[urlKey]string),
+		users:     make(map[string]map[urlKey]struct{}),
+		history:   make(map[urlKey][]entities.URLHistory),
+		clicks:    make(map[urlKey]map[string]int64),
+		apiKeys:   make(map[string]entities.APIKey),
+		accounts:  make(map[string]entities.User),
+		revoked:   make(map[string]time.Time),
 		persister: persister,
 	}
 
@@ -56,42 +159,509 @@ func newMemStorage(persister Persister) Storage {
 	return storage
 }
 
-func (s *MemStorage) GetUserURLs(ctx context.Context, userID string) ([]entities.URL, error) {
-	return nil, nil
+func (s *MemStorage) GetUserURLsPage(ctx context.Context, query UserURLsQuery) ([]entities.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.selectUserURLs(query), nil
+}
+
+func (s *MemStorage) IterateUserURLs(ctx context.Context, query UserURLsQuery, fn func(entities.URL) error) error {
+	s.mu.RLock()
+	userURLs := s.selectUserURLs(query)
+	s.mu.RUnlock()
+
+	for _, url := range userURLs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(url); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (s *MemStorage) ReadByID(ctx context.Context, id string) (entities.URL, error) {
-	url, ok := s.storage[id]
+func (s *MemStorage) selectUserURLs(query UserURLsQuery) []entities.URL {
+	userURLs := make([]entities.URL, 0)
+	for key := range s.users[query.UserID] {
+		url := s.storage[key]
+
+		if url.DeletedFlag && !query.IncludeDeleted {
+			continue
+		}
+
+		if query.Search != "" && !strings.Contains(url.OriginalURL, query.Search) {
+			continue
+		}
+
+		if query.Tag != "" && !hasTag(url, query.Tag) {
+			continue
+		}
+
+		if query.Cursor != nil && !query.Cursor.after(url, query.Desc) {
+			continue
+		}
+
+		userURLs = append(userURLs, url)
+	}
+
+	sort.Slice(userURLs, func(i, j int) bool {
+		return compareURLs(userURLs[i], userURLs[j], query.Desc) < 0
+	})
+
+	if query.Limit > 0 && len(userURLs) > query.Limit {
+		userURLs = userURLs[:query.Limit]
+	}
+
+	return userURLs
+}
+
+func (s *MemStorage) ReadByID(ctx context.Context, domain string, id string) (entities.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	url, ok := s.storage[urlKey{domain, id}]
+	if !ok {
+		return entities.URL{}, ErrIDNotExists
+	}
+
+	return url, nil
+}
+
+func (s *MemStorage) ReadByOriginalURL(ctx context.Context, domain string, originalURL string) (entities.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.originals[urlKey{domain, originalURL}]
 	if !ok {
 		return entities.URL{}, ErrIDNotExists
 	}
 
-	return entities.URL{
-		ShortURL:    id,
-		OriginalURL: url,
-	}, nil
+	return s.storage[urlKey{domain, id}], nil
+}
+
+func (s *MemStorage) ReadByIDs(ctx context.Context, domain string, ids []string) ([]entities.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	urls := make([]entities.URL, 0, len(ids))
+	for _, id := range ids {
+		if url, ok := s.storage[urlKey{domain, id}]; ok {
+			urls = append(urls, url)
+		}
+	}
+
+	return urls, nil
+}
+
+func (s *MemStorage) ReadByOriginalURLs(ctx context.Context, domain string, originalURLs []string) ([]entities.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	urls := make([]entities.URL, 0, len(originalURLs))
+	for _, originalURL := range originalURLs {
+		if id, ok := s.originals[urlKey{domain, originalURL}]; ok {
+			urls = append(urls, s.storage[urlKey{domain, id}])
+		}
+	}
+
+	return urls, nil
 }
 
 func (s *MemStorage) AddBatch(ctx context.Context, urls []entities.URL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shortURLs := make(map[urlKey]struct{}, len(urls))
+	originalURLs := make(map[urlKey]struct{}, len(urls))
+
 	for _, url := range urls {
-		s.Add(url)
+		if err := s.checkNew(url); err != nil {
+			return err
+		}
+
+		shortKey := urlKey{url.Domain, url.ShortURL}
+		if _, ok := shortURLs[shortKey]; ok {
+			return ErrIDExists
+		}
+
+		originalKey := urlKey{url.Domain, url.OriginalURL}
+		if _, ok := originalURLs[originalKey]; ok {
+			return ErrOriginalURLExists
+		}
+
+		shortURLs[shortKey] = struct{}{}
+		originalURLs[originalKey] = struct{}{}
+	}
+
+	for _, url := range urls {
+		s.add(url)
 	}
 
 	return nil
 }
 
-func (s *MemStorage) DeleteBatch(ctx context.Context, shortURLs []string, userID string) error {
+func (s *MemStorage) DeleteBatch(ctx context.Context, domain string, shortURLs []string, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	for _, shortURL := range shortURLs {
-		delete(s.storage, shortURL)
+		key := urlKey{domain, shortURL}
+
+		url, ok := s.storage[key]
+		if !ok || url.UserID != userID || url.DeletedFlag {
+			continue
+		}
+
+		url.DeletedFlag = true
+		url.UpdatedAt = time.Now()
+		s.storage[key] = url
+
+		s.save(url)
 	}
 
 	return nil
 }
 
-func (s *MemStorage) Add(url entities.URL) error {
-	s.storage[url.ShortURL] = url.OriginalURL
+func (s *MemStorage) UpdateOriginalURL(ctx context.Context, domain string, shortURL string, userID string, originalURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if err := s.persister.Save(url); err != nil {
+	url, ok := s.storage[urlKey{domain, shortURL}]
+	if !ok {
+		return ErrIDNotExists
+	}
+
+	if url.UserID != userID {
+		return ErrURLNotOwned
+	}
+
+	if url.DeletedFlag {
+		return ErrURLDeleted
+	}
+
+	if url.OriginalURL == originalURL {
+		return nil
+	}
+
+	if _, ok := s.originals[urlKey{domain, originalURL}]; ok {
+		return ErrOriginalURLExists
+	}
+
+	updatedAt := time.Now()
+	s.archive(url, updatedAt)
+
+	url.OriginalURL = originalURL
+	url.UpdatedAt = updatedAt
+	s.put(url)
+	s.save(url)
+
+	return nil
+}
+
+func (s *MemStorage) SetFlagged(ctx context.Context, domain string, shortURL string, flagged bool) error {
+	return s.modify(domain, shortURL, func(url *entities.URL) bool {
+		if url.FlaggedFlag == flagged {
+			return false
+		}
+
+		url.FlaggedFlag = flagged
+
+		return true
+	})
+}
+
+func (s *MemStorage) SetDisabled(ctx context.Context, domain string, shortURL string, disabled bool) error {
+	return s.modify(domain, shortURL, func(url *entities.URL) bool {
+		if url.DisabledFlag == disabled {
+			return false
+		}
+
+		url.DisabledFlag = disabled
+
+		return true
+	})
+}
+
+func (s *MemStorage) SetOwner(ctx context.Context, domain string, shortURL string, userID string) error {
+	return s.modify(domain, shortURL, func(url *entities.URL) bool {
+		if url.UserID == userID {
+			return false
+		}
+
+		url.UserID = userID
+
+		return true
+	})
+}
+
+// modify применяет change к сокращенной ссылке и сохраняет ее, если change вернул true.
+func (s *MemStorage) modify(domain string, shortURL string, change func(*entities.URL) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	url, ok := s.storage[urlKey{domain, shortURL}]
+	if !ok {
+		return ErrIDNotExists
+	}
+
+	if !change(&url) {
+		return nil
+	}
+
+	url.UpdatedAt = time.Now()
+
+	s.put(url)
+	s.save(url)
+
+	return nil
+}
+
+func (s *MemStorage) Remove(ctx context.Context, domain string, shortURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	url, ok := s.storage[urlKey{domain, shortURL}]
+	if !ok {
+		return ErrIDNotExists
+	}
+
+	s.remove(domain, shortURL)
+
+	if err := s.persister.Remove(url); err != nil {
+		zap.L().Sugar().Errorw(
+			"Cannot save data to persister",
+			"err", err,
+		)
+	}
+
+	return nil
+}
+
+// removeWithoutPersisterSave - функция, которая безвозвратно удаляет сокращенную ссылку без сохранения в Persister.
+func (s *MemStorage) removeWithoutPersisterSave(domain string, shortURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(domain, shortURL)
+}
+
+func (s *MemStorage) remove(domain string, shortURL string) {
+	key := urlKey{domain, shortURL}
+
+	url, ok := s.storage[key]
+	if !ok {
+		return
+	}
+
+	delete(s.storage, key)
+	delete(s.users[url.UserID], key)
+	delete(s.history, key)
+	delete(s.clicks, key)
+
+	if s.originals[urlKey{domain, url.OriginalURL}] == shortURL {
+		delete(s.originals, urlKey{domain, url.OriginalURL})
+	}
+}
+
+// AddAuditEntry - функция для записи действия администратора в журнал. Запись сохраняется в Persister.
+func (s *MemStorage) AddAuditEntry(ctx context.Context, entry entities.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	s.appendAuditEntry(entry)
+
+	if err := s.persister.SaveAuditEntry(entry); err != nil {
+		zap.L().Sugar().Errorw(
+			"Cannot save data to persister",
+			"err", err,
+		)
+	}
+
+	return nil
+}
+
+// addAuditEntryWithoutPersisterSave - функция, которая добавляет запись в журнал без сохранения в Persister.
+func (s *MemStorage) addAuditEntryWithoutPersisterSave(entry entities.AuditEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.appendAuditEntry(entry)
+}
+
+// appendAuditEntry добавляет запись в конец журнала. Идентификатор - номер записи в журнале.
+func (s *MemStorage) appendAuditEntry(entry entities.AuditEntry) {
+	entry.ID = int64(len(s.audit) + 1)
+	s.audit = append(s.audit, entry)
+}
+
+func (s *MemStorage) GetAuditLog(ctx context.Context, limit int) ([]entities.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]entities.AuditEntry, 0, limit)
+	for i := len(s.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, s.audit[i])
+	}
+
+	return entries, nil
+}
+
+// AddClick - функция для записи перехода по сокращенной ссылке.
+// MemStorage хранит только количество переходов по вариантам, в файл переходы не сохраняются.
+func (s *MemStorage) AddClick(ctx context.Context, click entities.Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := urlKey{click.Domain, click.ShortURL}
+
+	variants, ok := s.clicks[key]
+	if !ok {
+		variants = make(map[string]int64)
+		s.clicks[key] = variants
+	}
+
+	variants[click.Variant]++
+
+	return nil
+}
+
+func (s *MemStorage) GetClickStats(ctx context.Context, domain string, shortURL string) ([]entities.ClickStat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	variants := s.clicks[urlKey{domain, shortURL}]
+
+	stats := make([]entities.ClickStat, 0, len(variants))
+	for variant, count := range variants {
+		stats = append(stats, entities.ClickStat{Variant: variant, Count: count})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Variant < stats[j].Variant
+	})
+
+	return stats, nil
+}
+
+// AddAPIKey - функция для добавления ключа API пользователя. Ключ сохраняется в Persister.
+func (s *MemStorage) AddAPIKey(ctx context.Context, key entities.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+
+	s.apiKeys[key.Hash] = key
+	s.saveAPIKey(key)
+
+	return nil
+}
+
+// restoreAPIKey - функция, которая восстанавливает ключ API из Persister или удаляет отозванный ключ.
+func (s *MemStorage) restoreAPIKey(record models.FileStorageAPIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record.RevokedFlag {
+		delete(s.apiKeys, record.Hash)
+		return
+	}
+
+	s.apiKeys[record.Hash] = entities.APIKey{
+		ID:        record.ID,
+		UserID:    record.UserID,
+		Name:      record.Name,
+		Prefix:    record.Prefix,
+		Hash:      record.Hash,
+		Scopes:    record.Scopes,
+		CreatedAt: record.CreatedAt,
+		ExpiresAt: record.ExpiresAt,
+	}
+}
+
+func (s *MemStorage) GetUserAPIKeys(ctx context.Context, userID string) ([]entities.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]entities.APIKey, 0)
+	for _, key := range s.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys, nil
+}
+
+func (s *MemStorage) ReadAPIKeyByHash(ctx context.Context, hash string) (entities.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.apiKeys[hash]
+	if !ok {
+		return entities.APIKey{}, ErrAPIKeyNotExists
+	}
+
+	return key, nil
+}
+
+func (s *MemStorage) DeleteAPIKey(ctx context.Context, userID string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, key := range s.apiKeys {
+		if key.ID == id && key.UserID == userID {
+			delete(s.apiKeys, hash)
+
+			if err := s.persister.RemoveAPIKey(key); err != nil {
+				zap.L().Sugar().Errorw(
+					"Cannot save data to persister",
+					"err", err,
+				)
+			}
+
+			return nil
+		}
+	}
+
+	return ErrAPIKeyNotExists
+}
+
+// AddUser - функция для добавления учетной записи. Учетная запись сохраняется в Persister.
+func (s *MemStorage) AddUser(ctx context.Context, user entities.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, account := range s.accounts {
+		if account.Login == user.Login {
+			return ErrUserExists
+		}
+	}
+
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+
+	s.accounts[user.ID] = user
+
+	if err := s.persister.SaveUser(user); err != nil {
 		zap.L().Sugar().Errorw(
 			"Cannot save data to persister",
 			"err", err,
@@ -101,18 +671,238 @@ func (s *MemStorage) Add(url entities.URL) error {
 	return nil
 }
 
+// addUserWithoutPersisterSave - функция, которая добавляет учетную запись без сохранения в Persister.
+func (s *MemStorage) addUserWithoutPersisterSave(user entities.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accounts[user.ID] = user
+}
+
+func (s *MemStorage) ReadUserByLogin(ctx context.Context, login string) (entities.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, account := range s.accounts {
+		if account.Login == login {
+			return account, nil
+		}
+	}
+
+	return entities.User{}, ErrUserNotExists
+}
+
+func (s *MemStorage) ReadUserByID(ctx context.Context, id string) (entities.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account, ok := s.accounts[id]
+	if !ok {
+		return entities.User{}, ErrUserNotExists
+	}
+
+	return account, nil
+}
+
+// MergeUser - функция, которая передает сокращенные ссылки и ключи API пользователя fromUserID пользователю toUserID.
+// Ссылки и ключи API с новым владельцем сохраняются в Persister.
+func (s *MemStorage) MergeUser(ctx context.Context, fromUserID string, toUserID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if fromUserID == toUserID {
+		return nil
+	}
+
+	for key := range s.users[fromUserID] {
+		url := s.storage[key]
+		url.UserID = toUserID
+
+		s.put(url)
+		s.save(url)
+	}
+
+	for hash, key := range s.apiKeys {
+		if key.UserID == fromUserID {
+			key.UserID = toUserID
+			s.apiKeys[hash] = key
+			s.saveAPIKey(key)
+		}
+	}
+
+	return nil
+}
+
+// RevokeToken - функция для отзыва сессии JWT-токенов. MemStorage хранит отзывы только в памяти
+// и при каждом отзыве удаляет записи, срок которых прошел.
+func (s *MemStorage) RevokeToken(ctx context.Context, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for revokedID, revokedUntil := range s.revoked {
+		if !now.Before(revokedUntil) {
+			delete(s.revoked, revokedID)
+		}
+	}
+
+	s.revoked[id] = expiresAt
+
+	return nil
+}
+
+func (s *MemStorage) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revokedUntil, ok := s.revoked[id]
+
+	return ok && time.Now().Before(revokedUntil), nil
+}
+
+func (s *MemStorage) GetURLHistory(ctx context.Context, domain string, shortURL string) ([]entities.URLHistory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := s.history[urlKey{domain, shortURL}]
+
+	result := make([]entities.URLHistory, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		result = append(result, history[i])
+	}
+
+	return result, nil
+}
+
+func (s *MemStorage) Add(url entities.URL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkNew(url); err != nil {
+		return err
+	}
+
+	s.add(url)
+
+	return nil
+}
+
+// checkNew проверяет, что сокращенная ссылка свободна, а оригинальная ссылка еще не сокращена.
+func (s *MemStorage) checkNew(url entities.URL) error {
+	if _, ok := s.storage[urlKey{url.Domain, url.ShortURL}]; ok {
+		return ErrIDExists
+	}
+
+	if _, ok := s.originals[urlKey{url.Domain, url.OriginalURL}]; ok {
+		return ErrOriginalURLExists
+	}
+
+	return nil
+}
+
+// add добавляет новую сокращенную ссылку и сохраняет ее в Persister.
+func (s *MemStorage) add(url entities.URL) {
+	if url.CreatedAt.IsZero() {
+		url.CreatedAt = time.Now()
+	}
+
+	if url.UpdatedAt.IsZero() {
+		url.UpdatedAt = url.CreatedAt
+	}
+
+	s.put(url)
+	s.save(url)
+}
+
 func (s *MemStorage) Ping() error {
 	return nil
 }
 
 func (s *MemStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.storage = nil
+	s.originals = nil
+	s.users = nil
+	s.history = nil
+	s.apiKeys = nil
+	s.accounts = nil
+	s.audit = nil
+	s.revoked = nil
 
 	return nil
 }
 
+// AddWithoutPersisterSave - функция, которая добавляет entities.URL без сохранения в Persister.
+// Если сокращенная ссылка уже есть, то ее состояние заменяется, а смена оригинальной ссылки попадает в историю.
 func (s *MemStorage) AddWithoutPersisterSave(url entities.URL) error {
-	s.storage[url.ShortURL] = url.OriginalURL
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.storage[urlKey{url.Domain, url.ShortURL}]; ok && current.OriginalURL != url.OriginalURL {
+		s.archive(current, url.UpdatedAt)
+	}
+
+	s.put(url)
 
 	return nil
 }
+
+func (s *MemStorage) put(url entities.URL) {
+	key := urlKey{url.Domain, url.ShortURL}
+
+	if current, ok := s.storage[key]; ok && current.UserID != url.UserID {
+		delete(s.users[current.UserID], key)
+	}
+
+	s.storage[key] = url
+	s.originals[urlKey{url.Domain, url.OriginalURL}] = url.ShortURL
+
+	if _, ok := s.users[url.UserID]; !ok {
+		s.users[url.UserID] = make(map[urlKey]struct{})
+	}
+
+	s.users[url.UserID][key] = struct{}{}
+}
+
+// archive сохраняет текущую оригинальную ссылку url в историю и убирает ее из индекса оригинальных ссылок.
+func (s *MemStorage) archive(url entities.URL, changedAt time.Time) {
+	key := urlKey{url.Domain, url.ShortURL}
+
+	s.history[key] = append(s.history[key], entities.URLHistory{
+		ShortURL:    url.ShortURL,
+		OriginalURL: url.OriginalURL,
+		ChangedAt:   changedAt,
+	})
+
+	delete(s.originals, urlKey{url.Domain, url.OriginalURL})
+}
+
+func hasTag(url entities.URL, tag string) bool {
+	for _, urlTag := range url.Tags {
+		if urlTag == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *MemStorage) saveAPIKey(key entities.APIKey) {
+	if err := s.persister.SaveAPIKey(key); err != nil {
+		zap.L().Sugar().Errorw(
+			"Cannot save data to persister",
+			"err", err,
+		)
+	}
+}
+
+func (s *MemStorage) save(url entities.URL) {
+	if err := s.persister.Save(url); err != nil {
+		zap.L().Sugar().Errorw(
+			"Cannot save data to persister",
+			"err", err,
+		)
+	}
+}
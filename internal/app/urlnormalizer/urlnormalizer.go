@@ -0,0 +1,153 @@
+// Package urlnormalizer отвечает за проверку и приведение к каноническому виду оригинальных ссылок перед сокращением.
+// Эквивалентные ссылки после нормализации совпадают, поэтому получают одну и ту же сокращенную ссылку.
+
+package urlnormalizer
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	// CodeEmpty - код ошибки, когда ссылка пустая.
+	CodeEmpty = "empty_url"
+	// CodeMalformed - код ошибки, когда ссылку не удалось разобрать.
+	CodeMalformed = "malformed_url"
+	// CodeNotAbsolute - код ошибки, когда ссылка не абсолютная.
+	CodeNotAbsolute = "not_absolute_url"
+	// CodeSchemeNotAllowed - код ошибки, когда схема ссылки не разрешена.
+	CodeSchemeNotAllowed = "scheme_not_allowed"
+	// CodeInvalidHost - код ошибки, когда хост ссылки некорректный.
+	CodeInvalidHost = "invalid_host"
+)
+
+// DefaultAllowedSchemes - схемы, которые разрешены, если в конфигурации схемы не заданы.
+var DefaultAllowedSchemes = []string{"http", "https"}
+
+// defaultPorts - порты по умолчанию, которые убираются из ссылки.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// ValidationError - ошибка проверки ссылки, которая содержит машиночитаемый код.
+type ValidationError struct {
+	Code    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func newValidationError(code string, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Normalizer - структура, которая проверяет и нормализует ссылки.
+type Normalizer struct {
+	allowedSchemes map[string]struct{}
+	profile        *idna.Profile
+}
+
+// NewNormalizer - конструктор Normalizer. Если allowedSchemes пустой, то используются DefaultAllowedSchemes.
+func NewNormalizer(allowedSchemes []string) *Normalizer {
+	if len(allowedSchemes) == 0 {
+		allowedSchemes = DefaultAllowedSchemes
+	}
+
+	schemes := make(map[string]struct{}, len(allowedSchemes))
+	for _, scheme := range allowedSchemes {
+		schemes[strings.ToLower(strings.TrimSpace(scheme))] = struct{}{}
+	}
+
+	return &Normalizer{
+		allowedSchemes: schemes,
+		profile:        idna.Lookup,
+	}
+}
+
+// Normalize - функция, которая проверяет ссылку и возвращает ее канонический вид:
+// без пробелов по краям, со схемой и хостом в нижнем регистре, хостом в punycode,
+// без порта по умолчанию, с непустым путем и отсортированными параметрами запроса.
+// Если ссылка не проходит проверку, то возвращается *ValidationError.
+func (n *Normalizer) Normalize(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", newValidationError(CodeEmpty, "url is empty")
+	}
+
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", newValidationError(CodeMalformed, "url is malformed")
+	}
+
+	if parsedURL.Scheme == "" {
+		return "", newValidationError(CodeNotAbsolute, "url must be absolute")
+	}
+
+	parsedURL.Scheme = strings.ToLower(parsedURL.Scheme)
+	if _, ok := n.allowedSchemes[parsedURL.Scheme]; !ok {
+		return "", newValidationError(CodeSchemeNotAllowed, "scheme %q is not allowed", parsedURL.Scheme)
+	}
+
+	if parsedURL.Opaque != "" || parsedURL.Host == "" {
+		return "", newValidationError(CodeNotAbsolute, "url must contain host")
+	}
+
+	host, err := n.normalizeHost(parsedURL.Hostname())
+	if err != nil {
+		return "", err
+	}
+
+	port := parsedURL.Port()
+	if port == defaultPorts[parsedURL.Scheme] {
+		port = ""
+	}
+
+	if port != "" {
+		parsedURL.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		parsedURL.Host = "[" + host + "]"
+	} else {
+		parsedURL.Host = host
+	}
+
+	if parsedURL.Path == "" {
+		parsedURL.Path = "/"
+		parsedURL.RawPath = ""
+	}
+
+	if parsedURL.RawQuery != "" {
+		parsedURL.RawQuery = parsedURL.Query().Encode()
+	}
+
+	parsedURL.ForceQuery = false
+
+	return parsedURL.String(), nil
+}
+
+func (n *Normalizer) normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", newValidationError(CodeInvalidHost, "url host is empty")
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+
+	asciiHost, err := n.profile.ToASCII(strings.TrimSuffix(strings.ToLower(host), "."))
+	if err != nil {
+		return "", newValidationError(CodeInvalidHost, "url host %q is invalid", host)
+	}
+
+	return asciiHost, nil
+}
@@ -0,0 +1,85 @@
+package urlnormalizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		errCode string
+	}{
+		{
+			name: "already canonical url",
+			url:  "https://practicum.yandex.ru/",
+			want: "https://practicum.yandex.ru/",
+		},
+		{
+			name: "url with spaces, upper case host, default port and empty path",
+			url:  "  HTTPS://Practicum.Yandex.RU:443  ",
+			want: "https://practicum.yandex.ru/",
+		},
+		{
+			name: "url with not default port and unsorted query",
+			url:  "http://example.com:8080/path?b=2&a=1&a=0#top",
+			want: "http://example.com:8080/path?a=1&a=0&b=2#top",
+		},
+		{
+			name: "url with idn host",
+			url:  "http://пример.рф/путь",
+			want: "http://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C",
+		},
+		{
+			name: "url with ipv6 host",
+			url:  "http://[::1]:80/",
+			want: "http://[::1]/",
+		},
+		{
+			name:    "empty url",
+			url:     "   ",
+			errCode: CodeEmpty,
+		},
+		{
+			name:    "relative url",
+			url:     "/path/to/page",
+			errCode: CodeNotAbsolute,
+		},
+		{
+			name:    "javascript url",
+			url:     "javascript:alert(1)",
+			errCode: CodeSchemeNotAllowed,
+		},
+		{
+			name:    "url without host",
+			url:     "http:///path",
+			errCode: CodeNotAbsolute,
+		},
+		{
+			name:    "url with invalid host",
+			url:     "http://exa_mple.com/",
+			errCode: CodeInvalidHost,
+		},
+	}
+
+	normalizer := NewNormalizer(nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizer.Normalize(tt.url)
+			if tt.errCode != "" {
+				var validationErr *ValidationError
+				require.ErrorAs(t, err, &validationErr)
+				assert.Equal(t, tt.errCode, validationErr.Code)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}